@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
 
@@ -13,37 +14,34 @@ type SmartContract struct {
 	contractapi.Contract
 }
 
-// Asset describes basic details of what makes up a simple asset
+// maxPageSize is the largest page size of GetAllAssetsPaged
+const maxPageSize = 100
+
+// Asset describes basic details of what makes up a simple asset. RedactedFields lists the fields
+// that have been removed from an asset returned to a client by the field rules of the policy, and
+// is not stored.
 type Asset struct {
-	ID             string `json:"ID"`
-	Color          string `json:"color"`
-	Size           int    `json:"size"`
-	Owner          string `json:"owner"`
-	AppraisedValue int    `json:"appraisedValue"`
+	ID             string   `json:"ID"`
+	Color          string   `json:"color"`
+	Size           int      `json:"size"`
+	Owner          string   `json:"owner"`
+	AppraisedValue int      `json:"appraisedValue"`
+	RedactedFields []string `json:"redactedFields,omitempty" metadata:",optional"`
+}
+
+// AssetPage is a page of assets returned by GetAllAssetsPaged. Records only contains the assets
+// that the client is authorized to read, so may contain fewer assets than FetchedRecordsCount.
+type AssetPage struct {
+	Records             []*Asset `json:"records"`
+	FetchedRecordsCount int32    `json:"fetchedRecordsCount"`
+	Bookmark            string   `json:"bookmark"`
 }
 
 // CreateAsset issues a new asset to the world state with given details.
 func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, appraisedValue int) error {
 
-	// Demonstrate the use of Attribute-Based Access Control (ABAC) by checking
-	// to see if the caller has the "abac.creator" attribute with a value of true;
-	// if not, return an error.
-
-	err := ctx.GetClientIdentity().AssertAttributeValue("abac.creator", "true")
-	if err != nil {
-		return fmt.Errorf("submitting client not authorized to create asset, does not have abac.creator role")
-	}
-
-	exists, err := s.AssetExists(ctx, id)
-	if err != nil {
-		return err
-	}
-	if exists {
-		return fmt.Errorf("the asset %s already exists", id)
-	}
-
 	// Get ID of submitting client identity
-	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	clientID, err := submittingClientID(ctx)
 	if err != nil {
 		return err
 	}
@@ -55,6 +53,23 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		Owner:          clientID,
 		AppraisedValue: appraisedValue,
 	}
+
+	// Demonstrate the use of Attribute-Based Access Control (ABAC) by checking the
+	// policy rule for CreateAsset, which by default requires the caller to have the
+	// "abac.creator" attribute with a value of true; if not, return an error.
+	err = authorize(ctx, "CreateAsset", &asset)
+	if err != nil {
+		return err
+	}
+
+	exists, err := assetExists(ctx, id)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("the asset %s already exists", id)
+	}
+
 	assetJSON, err := json.Marshal(asset)
 	if err != nil {
 		return err
@@ -66,18 +81,21 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 // UpdateAsset updates an existing asset in the world state with provided parameters.
 func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface, id string, newColor string, newSize int, newValue int) error {
 
-	asset, err := s.ReadAsset(ctx, id)
+	asset, err := readAsset(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	// By default, only the owner of the asset, or a delegate of the owner, is authorized by the policy
+	delegateID, err := authorizeAssetChange(ctx, "UpdateAsset", asset)
 	if err != nil {
 		return err
 	}
-
-	if clientID != asset.Owner {
-		return fmt.Errorf("submitting client not authorized to update asset, does not own asset")
+	if delegateID != "" {
+		err = recordDelegatedAction(ctx, "UpdateAsset", asset, delegateID)
+		if err != nil {
+			return err
+		}
 	}
 
 	asset.Color = newColor
@@ -95,18 +113,26 @@ func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface,
 // DeleteAsset deletes a given asset from the world state.
 func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface, id string) error {
 
-	asset, err := s.ReadAsset(ctx, id)
+	asset, err := readAsset(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	// By default, only the owner of the asset, or a delegate of the owner, is authorized by the policy
+	delegateID, err := authorizeAssetChange(ctx, "DeleteAsset", asset)
 	if err != nil {
 		return err
 	}
+	if delegateID != "" {
+		err = recordDelegatedAction(ctx, "DeleteAsset", asset, delegateID)
+		if err != nil {
+			return err
+		}
+	}
 
-	if clientID != asset.Owner {
-		return fmt.Errorf("submitting client not authorized to update asset, does not own asset")
+	err = deleteDelegations(ctx, id)
+	if err != nil {
+		return err
 	}
 
 	return ctx.GetStub().DelState(id)
@@ -115,18 +141,27 @@ func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface,
 // TransferAsset updates the owner field of asset with given id in world state.
 func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, id string, newOwner string) error {
 
-	asset, err := s.ReadAsset(ctx, id)
+	asset, err := readAsset(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	clientID, err := s.GetSubmittingClientIdentity(ctx)
+	// By default, only the owner of the asset, or a delegate of the owner, is authorized by the policy
+	delegateID, err := authorizeAssetChange(ctx, "TransferAsset", asset)
 	if err != nil {
 		return err
 	}
+	if delegateID != "" {
+		err = recordDelegatedAction(ctx, "TransferAsset", asset, delegateID)
+		if err != nil {
+			return err
+		}
+	}
 
-	if clientID != asset.Owner {
-		return fmt.Errorf("submitting client not authorized to update asset, does not own asset")
+	// Delegations are granted by the previous owner
+	err = deleteDelegations(ctx, id)
+	if err != nil {
+		return err
 	}
 
 	asset.Owner = newOwner
@@ -138,9 +173,30 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 	return ctx.GetStub().PutState(id, assetJSON)
 }
 
-// ReadAsset returns the asset stored in the world state with given id.
+// ReadAsset returns the asset stored in the world state with given id, with the fields that the
+// submitting client is not authorized to see redacted.
 func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
 
+	asset, err := readAsset(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := readPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = authorizePolicy(ctx, policy, "ReadAsset", asset)
+	if err != nil {
+		return nil, err
+	}
+
+	return redactAsset(ctx, policy, asset)
+}
+
+// readAsset is an internal helper function that reads an asset without checking the policy.
+func readAsset(ctx contractapi.TransactionContextInterface, id string) (*Asset, error) {
+
 	assetJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from world state: %v", err)
@@ -158,8 +214,19 @@ func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, i
 	return &asset, nil
 }
 
-// GetAllAssets returns all assets found in world state
+// GetAllAssets returns all assets found in world state that the policy authorizes the
+// submitting client to read, with the fields that the client is not authorized to see redacted.
+// The ReadAsset rule is evaluated for each asset.
 func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface) ([]*Asset, error) {
+	policy, err := readPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = authorizePolicy(ctx, policy, "GetAllAssets", nil)
+	if err != nil {
+		return nil, err
+	}
+
 	// range query with empty string for startKey and endKey does an
 	// open-ended query of all assets in the chaincode namespace.
 	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
@@ -168,7 +235,48 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 	}
 	defer resultsIterator.Close()
 
-	var assets []*Asset
+	return readableAssetsFromIterator(ctx, policy, resultsIterator)
+}
+
+// GetAllAssetsPaged returns a page of the assets found in world state, using a page size and
+// the bookmark returned with the previous page, or an empty bookmark for the first page. As
+// for GetAllAssets, only assets that the client can read are returned, and fields are redacted.
+func (s *SmartContract) GetAllAssetsPaged(ctx contractapi.TransactionContextInterface, pageSize int, bookmark string) (*AssetPage, error) {
+	if pageSize <= 0 || pageSize > maxPageSize {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", maxPageSize)
+	}
+
+	policy, err := readPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = authorizePolicy(ctx, policy, "GetAllAssetsPaged", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", int32(pageSize), bookmark)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	assets, err := readableAssetsFromIterator(ctx, policy, resultsIterator)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssetPage{
+		Records:             assets,
+		FetchedRecordsCount: responseMetadata.FetchedRecordsCount,
+		Bookmark:            responseMetadata.Bookmark,
+	}, nil
+}
+
+// readableAssetsFromIterator returns the assets from a results iterator that the ReadAsset rule of
+// the policy authorizes the submitting client to read, with fields redacted by the field rules.
+func readableAssetsFromIterator(ctx contractapi.TransactionContextInterface, policy *Policy, resultsIterator shim.StateQueryIteratorInterface) ([]*Asset, error) {
+	assets := []*Asset{}
 	for resultsIterator.HasNext() {
 		queryResponse, err := resultsIterator.Next()
 		if err != nil {
@@ -180,7 +288,20 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 		if err != nil {
 			return nil, err
 		}
-		assets = append(assets, &asset)
+
+		allowed, err := policyAllows(ctx, policy, "ReadAsset", &asset)
+		if err != nil {
+			return nil, err
+		}
+		if !allowed {
+			continue
+		}
+
+		redacted, err := redactAsset(ctx, policy, &asset)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, redacted)
 	}
 
 	return assets, nil
@@ -189,6 +310,17 @@ func (s *SmartContract) GetAllAssets(ctx contractapi.TransactionContextInterface
 // AssetExists returns true when asset with given ID exists in world state
 func (s *SmartContract) AssetExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
 
+	err := authorize(ctx, "AssetExists", nil)
+	if err != nil {
+		return false, err
+	}
+
+	return assetExists(ctx, id)
+}
+
+// assetExists is an internal helper function that checks whether an asset exists without checking the policy.
+func assetExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
+
 	assetJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
 		return false, fmt.Errorf("failed to read from world state: %v", err)
@@ -202,6 +334,17 @@ func (s *SmartContract) AssetExists(ctx contractapi.TransactionContextInterface,
 // before returning the value to the client or smart contract.
 func (s *SmartContract) GetSubmittingClientIdentity(ctx contractapi.TransactionContextInterface) (string, error) {
 
+	err := authorize(ctx, "GetSubmittingClientIdentity", nil)
+	if err != nil {
+		return "", err
+	}
+
+	return submittingClientID(ctx)
+}
+
+// submittingClientID is an internal helper function that returns the decoded ID of the submitting client.
+func submittingClientID(ctx contractapi.TransactionContextInterface) (string, error) {
+
 	b64ID, err := ctx.GetClientIdentity().GetID()
 	if err != nil {
 		return "", fmt.Errorf("Failed to read clientID: %v", err)
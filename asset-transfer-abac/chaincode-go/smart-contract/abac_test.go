@@ -0,0 +1,82 @@
+package abac
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-samples/asset-transfer-abac/chaincode-go/smart-contract/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAssetRedacted(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, delegateID, nil)
+	putTestAsset(t, state, &Asset{ID: "asset1", Color: "blue", Size: 5, Owner: ownerID, AppraisedValue: 300})
+	putTestPolicy(t, state, &Policy{FieldRules: map[string]string{"AppraisedValue": "asset.Owner == client.id"}})
+
+	asset, err := (&SmartContract{}).ReadAsset(transactionContext, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, 0, asset.AppraisedValue)
+	require.Equal(t, []string{"AppraisedValue"}, asset.RedactedFields)
+
+	assetJSON, err := json.Marshal(asset)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"ID":"asset1","color":"blue","size":5,"owner":"x509::CN=owner::CN=ca","appraisedValue":0,"redactedFields":["AppraisedValue"]}`, string(assetJSON))
+}
+
+func TestGetAllAssetsPaged(t *testing.T) {
+	transactionContext, state, clientIdentity := prepMocks(t, delegateID, map[string]string{"abac.appraiser": "true"})
+	chaincodeStub := transactionContext.GetStub().(*mocks.ChaincodeStub)
+	putTestPolicy(t, state, &Policy{
+		Rules:      map[string]string{"ReadAsset": "asset.Color != red"},
+		FieldRules: map[string]string{"AppraisedValue": `abac.appraiser == "true" || asset.Owner == client.id`},
+	})
+	assets := []*Asset{
+		{ID: "asset1", Color: "blue", Owner: ownerID, AppraisedValue: 300},
+		{ID: "asset2", Color: "red", Owner: ownerID, AppraisedValue: 400},
+		{ID: "asset3", Color: "green", Owner: delegateID, AppraisedValue: 500},
+	}
+
+	chaincodeStub.GetStateByRangeWithPaginationReturns(assetIterator(t, assets), &peer.QueryResponseMetadata{FetchedRecordsCount: 3, Bookmark: "asset3"}, nil)
+	assetTransfer := &SmartContract{}
+	page, err := assetTransfer.GetAllAssetsPaged(transactionContext, 3, "")
+	require.NoError(t, err)
+	require.Equal(t, &AssetPage{
+		Records:             []*Asset{assets[0], assets[2]},
+		FetchedRecordsCount: 3,
+		Bookmark:            "asset3",
+	}, page)
+	_, _, pageSize, bookmark := chaincodeStub.GetStateByRangeWithPaginationArgsForCall(0)
+	require.Equal(t, int32(3), pageSize)
+	require.Equal(t, "", bookmark)
+
+	// Without the appraiser attribute, only the appraised value of the client's own assets is visible
+	clientIdentity.GetAttributeValueStub = nil
+	clientIdentity.GetAttributeValueReturns("", false, nil)
+	chaincodeStub.GetStateByRangeWithPaginationReturns(assetIterator(t, assets), &peer.QueryResponseMetadata{FetchedRecordsCount: 3}, nil)
+	page, err = assetTransfer.GetAllAssetsPaged(transactionContext, 3, "asset3")
+	require.NoError(t, err)
+	require.Equal(t, []*Asset{
+		{ID: "asset1", Color: "blue", Owner: ownerID, RedactedFields: []string{"AppraisedValue"}},
+		assets[2],
+	}, page.Records)
+
+	_, err = assetTransfer.GetAllAssetsPaged(transactionContext, 0, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+	_, err = assetTransfer.GetAllAssetsPaged(transactionContext, 101, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+}
+
+// assetIterator returns a state query iterator over assets
+func assetIterator(t *testing.T, assets []*Asset) *mocks.StateQueryIterator {
+	iterator := &mocks.StateQueryIterator{}
+	for i, asset := range assets {
+		assetJSON, err := json.Marshal(asset)
+		require.NoError(t, err)
+		iterator.HasNextReturnsOnCall(i, true)
+		iterator.NextReturnsOnCall(i, &queryresult.KV{Key: asset.ID, Value: assetJSON}, nil)
+	}
+	iterator.HasNextReturnsOnCall(len(assets), false)
+	return iterator
+}
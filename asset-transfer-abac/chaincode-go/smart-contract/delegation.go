@@ -0,0 +1,348 @@
+package abac
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	delegationObjectType      = "abacDelegation"
+	delegatedActionObjectType = "abacDelegatedAction"
+)
+
+// delegatedActionEventName is the name of the chaincode event emitted when a delegate changes an asset
+const delegatedActionEventName = "DelegatedAction"
+
+// delegablePermissions are the functions that an owner can delegate to another client
+var delegablePermissions = []string{"UpdateAsset", "TransferAsset", "DeleteAsset"}
+
+// Delegation allows a delegate to call the listed functions on an asset on behalf of its owner,
+// until it expires. A delegation is only valid while the client that granted it owns the asset.
+type Delegation struct {
+	AssetID     string    `json:"assetID"`
+	DelegateID  string    `json:"delegateID"`
+	Permissions []string  `json:"permissions"`
+	GrantedBy   string    `json:"grantedBy"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// DelegatedAction records a change made to an asset by a delegate on behalf of its owner.
+type DelegatedAction struct {
+	AssetID    string    `json:"assetID"`
+	Function   string    `json:"function"`
+	DelegateID string    `json:"delegateID"`
+	OwnerID    string    `json:"ownerID"`
+	TxID       string    `json:"txID"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// GrantDelegation allows a delegate to call the given functions on an asset on behalf of the
+// owner until expiresAt, an RFC 3339 timestamp. Permissions are any of UpdateAsset, TransferAsset
+// and DeleteAsset. An existing delegation to the same delegate is replaced. By default, only the
+// asset owner is authorized by the policy.
+func (s *SmartContract) GrantDelegation(ctx contractapi.TransactionContextInterface, assetID string, delegateID string, permissions []string, expiresAt string) error {
+	asset, err := readAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	err = authorize(ctx, "GrantDelegation", asset)
+	if err != nil {
+		return err
+	}
+
+	if delegateID == "" {
+		return fmt.Errorf("delegate ID must not be empty")
+	}
+	if delegateID == asset.Owner {
+		return fmt.Errorf("the owner of asset %s cannot be a delegate", assetID)
+	}
+	if len(permissions) == 0 {
+		return fmt.Errorf("at least one permission is required, expected any of %s", strings.Join(delegablePermissions, ", "))
+	}
+	for _, permission := range permissions {
+		if !contains(delegablePermissions, permission) {
+			return fmt.Errorf("permission %s cannot be delegated, expected any of %s", permission, strings.Join(delegablePermissions, ", "))
+		}
+	}
+
+	expiry, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return fmt.Errorf("expiresAt must be an RFC 3339 timestamp: %v", err)
+	}
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !expiry.After(now) {
+		return fmt.Errorf("expiresAt %v must be after the transaction time %v", expiresAt, now.Format(time.RFC3339))
+	}
+
+	delegation := Delegation{
+		AssetID:     assetID,
+		DelegateID:  delegateID,
+		Permissions: permissions,
+		GrantedBy:   asset.Owner,
+		ExpiresAt:   expiry.UTC(),
+	}
+	delegationJSON, err := json.Marshal(delegation)
+	if err != nil {
+		return err
+	}
+
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(delegationObjectType, []string{assetID, delegateID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(delegationKey, delegationJSON)
+}
+
+// RevokeDelegation removes the delegation of an asset to a delegate. By default, only the asset
+// owner is authorized by the policy.
+func (s *SmartContract) RevokeDelegation(ctx contractapi.TransactionContextInterface, assetID string, delegateID string) error {
+	asset, err := readAsset(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	err = authorize(ctx, "RevokeDelegation", asset)
+	if err != nil {
+		return err
+	}
+
+	delegation, err := readDelegation(ctx, assetID, delegateID)
+	if err != nil {
+		return err
+	}
+	if delegation == nil {
+		return fmt.Errorf("asset %s is not delegated to %s", assetID, delegateID)
+	}
+
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(delegationObjectType, []string{assetID, delegateID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().DelState(delegationKey)
+}
+
+// ListDelegations returns the delegations of an asset, including expired delegations that have
+// not been revoked.
+func (s *SmartContract) ListDelegations(ctx contractapi.TransactionContextInterface, assetID string) ([]*Delegation, error) {
+	asset, err := readAsset(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, "ListDelegations", asset)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(delegationObjectType, []string{assetID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	delegations := []*Delegation{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var delegation Delegation
+		err = json.Unmarshal(queryResponse.Value, &delegation)
+		if err != nil {
+			return nil, err
+		}
+		delegations = append(delegations, &delegation)
+	}
+
+	return delegations, nil
+}
+
+// GetDelegatedActions returns the changes made to an asset by delegates, in transaction order.
+func (s *SmartContract) GetDelegatedActions(ctx contractapi.TransactionContextInterface, assetID string) ([]*DelegatedAction, error) {
+	err := authorize(ctx, "GetDelegatedActions", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(delegatedActionObjectType, []string{assetID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	actions := []*DelegatedAction{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var action DelegatedAction
+		err = json.Unmarshal(queryResponse.Value, &action)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, &action)
+	}
+
+	// Keys are ordered by transaction ID, so order the actions by time
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Timestamp.Before(actions[j].Timestamp)
+	})
+
+	return actions, nil
+}
+
+// authorizeAssetChange checks that the submitting client is allowed to call a function that
+// changes an asset. If the policy rule is not satisfied for the client, but the client has a valid
+// delegation for the function from the asset owner, the rule is evaluated again with client.id
+// resolved to the owner. The ID of the delegate is returned if the client acts as a delegate.
+func authorizeAssetChange(ctx contractapi.TransactionContextInterface, function string, asset *Asset) (string, error) {
+	policy, err := readPolicy(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	allowed, err := policyAllows(ctx, policy, function, asset)
+	if err != nil || allowed {
+		return "", err
+	}
+
+	clientID, err := submittingClientID(ctx)
+	if err != nil {
+		return "", err
+	}
+	delegation, err := readDelegation(ctx, asset.ID, clientID)
+	if err != nil {
+		return "", err
+	}
+	if delegation == nil || delegation.GrantedBy != asset.Owner || !contains(delegation.Permissions, function) {
+		return "", authorizationError(policy, function)
+	}
+
+	now, err := txTime(ctx)
+	if err != nil {
+		return "", err
+	}
+	if !now.Before(delegation.ExpiresAt) {
+		return "", fmt.Errorf("submitting client not authorized to call %s, delegation expired at %v", function, delegation.ExpiresAt.Format(time.RFC3339))
+	}
+
+	allowed, err = policyAllowsFor(ctx, policy, function, asset, asset.Owner)
+	if err != nil {
+		return "", err
+	}
+	if !allowed {
+		return "", authorizationError(policy, function)
+	}
+
+	return clientID, nil
+}
+
+// recordDelegatedAction records a change made to an asset by a delegate, in the world state and
+// as a chaincode event.
+func recordDelegatedAction(ctx contractapi.TransactionContextInterface, function string, asset *Asset, delegateID string) error {
+	now, err := txTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	action := DelegatedAction{
+		AssetID:    asset.ID,
+		Function:   function,
+		DelegateID: delegateID,
+		OwnerID:    asset.Owner,
+		TxID:       txID,
+		Timestamp:  now.UTC(),
+	}
+	actionJSON, err := json.Marshal(action)
+	if err != nil {
+		return err
+	}
+
+	actionKey, err := ctx.GetStub().CreateCompositeKey(delegatedActionObjectType, []string{asset.ID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(actionKey, actionJSON)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent(delegatedActionEventName, actionJSON)
+}
+
+// deleteDelegations removes all delegations of an asset, when it is deleted or changes owner.
+func deleteDelegations(ctx contractapi.TransactionContextInterface, assetID string) error {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(delegationObjectType, []string{assetID})
+	if err != nil {
+		return err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return err
+		}
+		err = ctx.GetStub().DelState(queryResponse.Key)
+		if err != nil {
+			return fmt.Errorf("failed to delete delegation: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func readDelegation(ctx contractapi.TransactionContextInterface, assetID string, delegateID string) (*Delegation, error) {
+	delegationKey, err := ctx.GetStub().CreateCompositeKey(delegationObjectType, []string{assetID, delegateID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	delegationJSON, err := ctx.GetStub().GetState(delegationKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delegation: %v", err)
+	}
+	if delegationJSON == nil {
+		return nil, nil
+	}
+
+	var delegation Delegation
+	err = json.Unmarshal(delegationJSON, &delegation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &delegation, nil
+}
+
+func txTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return timestamp.AsTime(), nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package abac
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorizeAssetChangeOwner(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, ownerID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID}
+	putTestAsset(t, state, asset)
+
+	delegate, err := authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.NoError(t, err)
+	require.Empty(t, delegate)
+}
+
+func TestAuthorizeAssetChangeDelegate(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, delegateID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID}
+	putTestDelegation(t, state, &Delegation{
+		AssetID:     "asset1",
+		DelegateID:  delegateID,
+		Permissions: []string{"UpdateAsset", "TransferAsset"},
+		GrantedBy:   ownerID,
+		ExpiresAt:   txTimestamp.Add(time.Hour),
+	})
+
+	delegate, err := authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.NoError(t, err)
+	require.Equal(t, delegateID, delegate)
+
+	delegate, err = authorizeAssetChange(transactionContext, "TransferAsset", asset)
+	require.NoError(t, err)
+	require.Equal(t, delegateID, delegate)
+}
+
+func TestAuthorizeAssetChangeWrongPermission(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, delegateID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID}
+	putTestDelegation(t, state, &Delegation{
+		AssetID:     "asset1",
+		DelegateID:  delegateID,
+		Permissions: []string{"UpdateAsset"},
+		GrantedBy:   ownerID,
+		ExpiresAt:   txTimestamp.Add(time.Hour),
+	})
+
+	_, err := authorizeAssetChange(transactionContext, "DeleteAsset", asset)
+	require.EqualError(t, err, "submitting client not authorized to call DeleteAsset, policy rule not satisfied: asset.Owner == client.id")
+}
+
+func TestAuthorizeAssetChangeExpired(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, delegateID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID}
+	putTestDelegation(t, state, &Delegation{
+		AssetID:     "asset1",
+		DelegateID:  delegateID,
+		Permissions: []string{"UpdateAsset"},
+		GrantedBy:   ownerID,
+		ExpiresAt:   txTimestamp,
+	})
+
+	_, err := authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.EqualError(t, err, "submitting client not authorized to call UpdateAsset, delegation expired at 2024-01-01T12:00:00Z")
+}
+
+func TestAuthorizeAssetChangeRevoked(t *testing.T) {
+	transactionContext, state, clientIdentity := prepMocks(t, delegateID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID}
+	putTestAsset(t, state, asset)
+	putTestDelegation(t, state, &Delegation{
+		AssetID:     "asset1",
+		DelegateID:  delegateID,
+		Permissions: []string{"UpdateAsset"},
+		GrantedBy:   ownerID,
+		ExpiresAt:   txTimestamp.Add(time.Hour),
+	})
+
+	_, err := authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.NoError(t, err)
+
+	// Only the owner can revoke the delegation
+	err = (&SmartContract{}).RevokeDelegation(transactionContext, "asset1", delegateID)
+	require.EqualError(t, err, "submitting client not authorized to call RevokeDelegation, policy rule not satisfied: asset.Owner == client.id")
+
+	clientIdentity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(ownerID)), nil)
+	err = (&SmartContract{}).RevokeDelegation(transactionContext, "asset1", delegateID)
+	require.NoError(t, err)
+
+	clientIdentity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(delegateID)), nil)
+	_, err = authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.EqualError(t, err, "submitting client not authorized to call UpdateAsset, policy rule not satisfied: asset.Owner == client.id")
+}
+
+func TestAuthorizeAssetChangePreviousOwner(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, delegateID, nil)
+	putTestDelegation(t, state, &Delegation{
+		AssetID:     "asset1",
+		DelegateID:  delegateID,
+		Permissions: []string{"UpdateAsset"},
+		GrantedBy:   "x509::CN=previous::CN=ca",
+		ExpiresAt:   txTimestamp.Add(time.Hour),
+	})
+
+	_, err := authorizeAssetChange(transactionContext, "UpdateAsset", &Asset{ID: "asset1", Owner: ownerID})
+	require.EqualError(t, err, "submitting client not authorized to call UpdateAsset, policy rule not satisfied: asset.Owner == client.id")
+}
+
+func TestAuthorizeAssetChangeDelegatePolicy(t *testing.T) {
+	// The rule is evaluated for the owner, but with the certificate attributes of the delegate
+	transactionContext, state, clientIdentity := prepMocks(t, delegateID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID, AppraisedValue: 300}
+	putTestPolicy(t, state, &Policy{Rules: map[string]string{
+		"UpdateAsset": "asset.Owner == client.id && abac.role == manager",
+	}})
+	putTestDelegation(t, state, &Delegation{
+		AssetID:     "asset1",
+		DelegateID:  delegateID,
+		Permissions: []string{"UpdateAsset"},
+		GrantedBy:   ownerID,
+		ExpiresAt:   txTimestamp.Add(time.Hour),
+	})
+
+	_, err := authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.EqualError(t, err, "submitting client not authorized to call UpdateAsset, policy rule not satisfied: asset.Owner == client.id && abac.role == manager")
+
+	clientIdentity.GetAttributeValueReturns("manager", true, nil)
+	clientIdentity.GetAttributeValueStub = nil
+	delegate, err := authorizeAssetChange(transactionContext, "UpdateAsset", asset)
+	require.NoError(t, err)
+	require.Equal(t, delegateID, delegate)
+}
+
+func TestAuthorizeAssetChangeInvalidRule(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, ownerID, nil)
+	putTestPolicy(t, state, &Policy{Rules: map[string]string{"UpdateAsset": "asset.Color < 5"}})
+
+	_, err := authorizeAssetChange(transactionContext, "UpdateAsset", &Asset{ID: "asset1", Owner: ownerID, Color: "blue"})
+	require.EqualError(t, err, `failed to evaluate policy rule for UpdateAsset: cannot compare "blue" < "5", values are not numbers`)
+}
+
+func putTestDelegation(t *testing.T, state map[string][]byte, delegation *Delegation) {
+	delegationKey, err := shim.CreateCompositeKey(delegationObjectType, []string{delegation.AssetID, delegation.DelegateID})
+	require.NoError(t, err)
+	delegationJSON, err := json.Marshal(delegation)
+	require.NoError(t, err)
+	state[delegationKey] = delegationJSON
+}
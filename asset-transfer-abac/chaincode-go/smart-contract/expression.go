@@ -0,0 +1,512 @@
+package abac
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A policy expression is a boolean expression over the attributes of the submitting client's
+// certificate, the client identity, and the fields of the asset being accessed. For example:
+//
+//	abac.role in [auditor, admin] && asset.AppraisedValue < 1000
+//
+// Operands are:
+//   - client.id, the ID of the submitting client, as returned by GetSubmittingClientIdentity
+//   - client.mspid, the MSP ID of the submitting client
+//   - asset.<Field>, a field of the asset, by Go or JSON field name
+//   - any other dotted name, such as abac.role, the value of a certificate attribute, or "" if
+//     the certificate does not have the attribute
+//   - numbers, true, false, and strings, either quoted or as a single word such as admin
+//
+// Operators, from lowest to highest precedence, are ||, &&, !, the comparisons == != < <= > >=,
+// and in, which tests membership of a list such as [auditor, admin]. Values are compared as numbers
+// if both are numbers or numeric strings, and as strings otherwise.
+
+// expressionEnv resolves the variables used in a policy expression
+type expressionEnv interface {
+	resolve(name string) (interface{}, error)
+}
+
+type expression interface {
+	eval(env expressionEnv) (interface{}, error)
+}
+
+// parseExpression parses a policy expression.
+func parseExpression(source string) (expression, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &expressionParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression %q", p.tokens[p.pos].text, source)
+	}
+
+	return expr, nil
+}
+
+// evaluateExpression parses and evaluates a policy expression, which must result in a boolean.
+func evaluateExpression(source string, env expressionEnv) (bool, error) {
+	expr, err := parseExpression(source)
+	if err != nil {
+		return false, err
+	}
+
+	value, err := expr.eval(env)
+	if err != nil {
+		return false, err
+	}
+
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression %q does not evaluate to true or false", source)
+	}
+	return result, nil
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			for end < len(runes) && runes[end] != r {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated string in expression %q", source)
+			}
+			tokens = append(tokens, token{tokenString, string(runes[i+1 : end])})
+			i = end + 1
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			end := i + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokenNumber, string(runes[i:end])})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{tokenIdent, string(runes[i:end])})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character %q in expression %q", r, source)
+			}
+			tokens = append(tokens, token{tokenOperator, operator})
+			i += len(operator)
+		}
+	}
+
+	return tokens, nil
+}
+
+type expressionParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *expressionParser) peek() *token {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *expressionParser) acceptOperator(operators ...string) string {
+	next := p.peek()
+	if next == nil || (next.kind != tokenOperator && !(next.kind == tokenIdent && next.text == "in")) {
+		return ""
+	}
+	for _, operator := range operators {
+		if next.text == operator {
+			p.pos++
+			return operator
+		}
+	}
+	return ""
+}
+
+func (p *expressionParser) expectOperator(operator string) error {
+	if p.acceptOperator(operator) == "" {
+		return p.unexpected("expected " + operator)
+	}
+	return nil
+}
+
+func (p *expressionParser) unexpected(message string) error {
+	next := p.peek()
+	if next == nil {
+		return fmt.Errorf("unexpected end of expression, %s", message)
+	}
+	return fmt.Errorf("unexpected %q in expression, %s", next.text, message)
+}
+
+func (p *expressionParser) parseOr() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOperator("||") != "" {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{operator: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseAnd() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptOperator("&&") != "" {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalExpr{operator: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *expressionParser) parseUnary() (expression, error) {
+	if p.acceptOperator("!") != "" {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *expressionParser) parseComparison() (expression, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.acceptOperator("in") != "" {
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return &inExpr{value: left, list: list}, nil
+	}
+
+	if operator := p.acceptOperator("==", "!=", "<=", ">=", "<", ">"); operator != "" {
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &comparisonExpr{operator: operator, left: left, right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *expressionParser) parseList() ([]expression, error) {
+	if err := p.expectOperator("["); err != nil {
+		return nil, err
+	}
+
+	var list []expression
+	if p.acceptOperator("]") != "" {
+		return list, nil
+	}
+	for {
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+
+		if p.acceptOperator("]") != "" {
+			return list, nil
+		}
+		if err := p.expectOperator(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *expressionParser) parseOperand() (expression, error) {
+	next := p.peek()
+	if next == nil {
+		return nil, p.unexpected("expected a value")
+	}
+
+	if p.acceptOperator("(") != "" {
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectOperator(")"); err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+
+	switch next.kind {
+	case tokenString:
+		p.pos++
+		return &literalExpr{value: next.text}, nil
+	case tokenNumber:
+		p.pos++
+		number, err := strconv.ParseFloat(next.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q in expression", next.text)
+		}
+		return &literalExpr{value: number}, nil
+	case tokenIdent:
+		p.pos++
+		switch {
+		case next.text == "true":
+			return &literalExpr{value: true}, nil
+		case next.text == "false":
+			return &literalExpr{value: false}, nil
+		case strings.Contains(next.text, "."):
+			return &variableExpr{name: next.text}, nil
+		default:
+			return &literalExpr{value: next.text}, nil
+		}
+	default:
+		return nil, p.unexpected("expected a value")
+	}
+}
+
+type literalExpr struct {
+	value interface{}
+}
+
+func (e *literalExpr) eval(env expressionEnv) (interface{}, error) {
+	return e.value, nil
+}
+
+type variableExpr struct {
+	name string
+}
+
+func (e *variableExpr) eval(env expressionEnv) (interface{}, error) {
+	return env.resolve(e.name)
+}
+
+type notExpr struct {
+	operand expression
+}
+
+func (e *notExpr) eval(env expressionEnv) (interface{}, error) {
+	value, err := evalBool(e.operand, env)
+	if err != nil {
+		return nil, err
+	}
+	return !value, nil
+}
+
+type logicalExpr struct {
+	operator string
+	left     expression
+	right    expression
+}
+
+func (e *logicalExpr) eval(env expressionEnv) (interface{}, error) {
+	left, err := evalBool(e.left, env)
+	if err != nil {
+		return nil, err
+	}
+	if (e.operator == "&&" && !left) || (e.operator == "||" && left) {
+		return left, nil
+	}
+	return evalBool(e.right, env)
+}
+
+type comparisonExpr struct {
+	operator string
+	left     expression
+	right    expression
+}
+
+func (e *comparisonExpr) eval(env expressionEnv) (interface{}, error) {
+	left, err := e.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := e.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	leftNumber, leftIsNumber := toNumber(left)
+	rightNumber, rightIsNumber := toNumber(right)
+	if leftIsNumber && rightIsNumber {
+		switch e.operator {
+		case "==":
+			return leftNumber == rightNumber, nil
+		case "!=":
+			return leftNumber != rightNumber, nil
+		case "<":
+			return leftNumber < rightNumber, nil
+		case "<=":
+			return leftNumber <= rightNumber, nil
+		case ">":
+			return leftNumber > rightNumber, nil
+		case ">=":
+			return leftNumber >= rightNumber, nil
+		}
+	}
+
+	switch e.operator {
+	case "==":
+		return toString(left) == toString(right), nil
+	case "!=":
+		return toString(left) != toString(right), nil
+	default:
+		return nil, fmt.Errorf("cannot compare %q %s %q, values are not numbers", toString(left), e.operator, toString(right))
+	}
+}
+
+type inExpr struct {
+	value expression
+	list  []expression
+}
+
+func (e *inExpr) eval(env expressionEnv) (interface{}, error) {
+	for _, item := range e.list {
+		equal, err := (&comparisonExpr{operator: "==", left: e.value, right: item}).eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if equal.(bool) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// expressionVariables returns the names of the variables used in an expression, in the order
+// they appear.
+func expressionVariables(expr expression) []string {
+	switch expr := expr.(type) {
+	case *variableExpr:
+		return []string{expr.name}
+	case *notExpr:
+		return expressionVariables(expr.operand)
+	case *logicalExpr:
+		return append(expressionVariables(expr.left), expressionVariables(expr.right)...)
+	case *comparisonExpr:
+		return append(expressionVariables(expr.left), expressionVariables(expr.right)...)
+	case *inExpr:
+		variables := expressionVariables(expr.value)
+		for _, item := range expr.list {
+			variables = append(variables, expressionVariables(item)...)
+		}
+		return variables
+	default:
+		return nil
+	}
+}
+
+func evalBool(expr expression, env expressionEnv) (bool, error) {
+	value, err := expr.eval(env)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("%q is not true or false", toString(value))
+	}
+	return result, nil
+}
+
+func toNumber(value interface{}) (float64, bool) {
+	switch value := value.(type) {
+	case float64:
+		return value, true
+	case string:
+		number, err := strconv.ParseFloat(value, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func toString(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// structField returns the value of a struct field, by Go or JSON field name, as an expression value.
+func structField(value reflect.Value, name string) (interface{}, bool) {
+	index, ok := fieldIndex(value.Type(), name)
+	if !ok {
+		return nil, false
+	}
+
+	fieldValue := value.Field(index)
+	switch fieldValue.Kind() {
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return float64(fieldValue.Int()), true
+	case reflect.Bool:
+		return fieldValue.Bool(), true
+	default:
+		return fmt.Sprint(fieldValue.Interface()), true
+	}
+}
+
+// fieldIndex returns the index of a struct field, by Go or JSON field name.
+func fieldIndex(structType reflect.Type, name string) (int, bool) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Name == name || jsonName == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,180 @@
+package abac
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testEnv resolves expression variables from a map
+type testEnv map[string]interface{}
+
+func (env testEnv) resolve(name string) (interface{}, error) {
+	value, ok := env[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown variable %s", name)
+	}
+	return value, nil
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	env := testEnv{
+		"client.id":            "x509::CN=alice",
+		"client.mspid":         "Org1MSP",
+		"abac.role":            "auditor",
+		"abac.level":           "10",
+		"abac.empty":           "",
+		"asset.AppraisedValue": float64(300),
+		"asset.Color":          "blue",
+		"asset.Size":           float64(5),
+		"asset.Owner":          "x509::CN=alice",
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		expected   bool
+	}{
+		{"true literal", "true", true},
+		{"false literal", "false", false},
+		{"equal variables", "asset.Owner == client.id", true},
+		{"not equal", "client.mspid != Org1MSP", false},
+		{"quoted string", `asset.Color == "blue"`, true},
+		{"single quoted string", `asset.Color == 'blue'`, true},
+		{"quoted string with spaces", `"a b" == 'a b'`, true},
+		{"unquoted word", "abac.role == auditor", true},
+		{"empty attribute", `abac.empty == ""`, true},
+
+		// Numbers and numeric strings are compared as numbers
+		{"number less than", "asset.AppraisedValue < 1000", true},
+		{"number greater than or equal", "asset.AppraisedValue >= 300", true},
+		{"number greater than", "asset.AppraisedValue > 300", false},
+		{"number less than or equal", "asset.Size <= 4", false},
+		{"negative number", "asset.Size > -1", true},
+		{"decimal number", "asset.Size < 5.5", true},
+		{"numeric attribute", "abac.level > 9", true},
+		{"numeric strings", `"10" > "9"`, true},
+		{"equal numbers in different formats", `abac.level == 10.0`, true},
+		{"number and string", `asset.Size == "5"`, true},
+		{"number not equal to word", "asset.Size == five", false},
+
+		// in tests membership of a list
+		{"in list", "abac.role in [auditor, admin]", true},
+		{"not in list", "abac.role in [admin, creator]", false},
+		{"in empty list", "abac.role in []", false},
+		{"in list of quoted strings", `asset.Color in ["red", 'blue']`, true},
+		{"in list of numbers", "asset.Size in [1, 5, 10]", true},
+		{"in list of variables", "asset.Owner in [client.mspid, client.id]", true},
+		{"negated in", "!(abac.role in [admin])", true},
+
+		// Comparisons bind tighter than !, which binds tighter than &&, which binds tighter than ||
+		{"and", "abac.role == auditor && asset.AppraisedValue < 1000", true},
+		{"and false", "abac.role == auditor && asset.AppraisedValue > 1000", false},
+		{"or", "abac.role == admin || asset.Color == blue", true},
+		{"and before or", "true || false && false", true},
+		{"and before or on the left", "false && true || true", true},
+		{"parentheses", "(true || false) && false", false},
+		{"not", "!false", true},
+		{"double not", "!!true", true},
+		{"not before and", "!false && false", false},
+		{"not of parentheses", "!(false || true)", false},
+		{"comparison before not", "!asset.Color == red", true},
+		{"nested parentheses", "((abac.role == auditor) && (asset.Size < 10 || false))", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := evaluateExpression(test.expression, env)
+			require.NoError(t, err)
+			require.Equal(t, test.expected, result)
+		})
+	}
+}
+
+func TestEvaluateExpressionShortCircuit(t *testing.T) {
+	// The right side is not evaluated, so the unknown variable is not resolved
+	result, err := evaluateExpression("false && unknown.name == x", testEnv{})
+	require.NoError(t, err)
+	require.False(t, result)
+
+	result, err = evaluateExpression("true || unknown.name == x", testEnv{})
+	require.NoError(t, err)
+	require.True(t, result)
+}
+
+func TestEvaluateExpressionErrors(t *testing.T) {
+	env := testEnv{"abac.role": "auditor", "asset.Size": float64(5)}
+
+	tests := []struct {
+		name       string
+		expression string
+		err        string
+	}{
+		{"empty", "", "unexpected end of expression, expected a value"},
+		{"unterminated string", `abac.role == "auditor`, `unterminated string in expression "abac.role == \"auditor"`},
+		{"unexpected character", "abac.role = auditor", `unexpected character '=' in expression "abac.role = auditor"`},
+		{"missing operand", "abac.role ==", "unexpected end of expression, expected a value"},
+		{"missing right side of and", "true &&", "unexpected end of expression, expected a value"},
+		{"trailing token", "true false", `unexpected "false" in expression "true false"`},
+		{"unclosed parenthesis", "(true || false", "unexpected end of expression, expected )"},
+		{"unexpected closing parenthesis", "true)", `unexpected ")" in expression "true)"`},
+		{"in without list", "abac.role in auditor", `unexpected "auditor" in expression, expected [`},
+		{"unclosed list", "abac.role in [auditor, admin", "unexpected end of expression, expected ,"},
+		{"list without comma", "abac.role in [auditor admin]", `unexpected "admin" in expression, expected ,`},
+		{"invalid number", "asset.Size == 1.2.3", `invalid number "1.2.3" in expression`},
+		{"operator as operand", "== true", `unexpected "==" in expression, expected a value`},
+		{"not a boolean", "abac.role", `expression "abac.role" does not evaluate to true or false`},
+		{"not a boolean number", "asset.Size", `expression "asset.Size" does not evaluate to true or false`},
+		{"and of a string", "abac.role && true", `"auditor" is not true or false`},
+		{"not of a number", "!asset.Size", `"5" is not true or false`},
+		{"ordering of strings", "abac.role < admin", `cannot compare "auditor" < "admin", values are not numbers`},
+		{"ordering of number and string", "asset.Size >= large", `cannot compare "5" >= "large", values are not numbers`},
+		{"unknown variable", "unknown.name == x", "unknown variable unknown.name"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := evaluateExpression(test.expression, env)
+			require.EqualError(t, err, test.err)
+		})
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	_, err := parseExpression(`abac.role in [auditor, "admin"] && !(asset.AppraisedValue >= 1000 || client.mspid != Org1MSP)`)
+	require.NoError(t, err)
+
+	// Variables are only resolved on evaluation
+	_, err = parseExpression("unknown.name == x")
+	require.NoError(t, err)
+
+	_, err = parseExpression("abac.role in [auditor,")
+	require.EqualError(t, err, "unexpected end of expression, expected a value")
+}
+
+func TestStructField(t *testing.T) {
+	asset := Asset{ID: "asset1", Color: "blue", Size: 5, Owner: "x509::CN=alice", AppraisedValue: 300}
+
+	tests := []struct {
+		name     string
+		expected interface{}
+	}{
+		{"Color", "blue"},
+		{"color", "blue"},
+		{"Size", float64(5)},
+		{"appraisedValue", float64(300)},
+		{"ID", "asset1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, ok := structField(reflect.ValueOf(asset), test.name)
+			require.True(t, ok)
+			require.Equal(t, test.expected, value)
+		})
+	}
+
+	_, ok := structField(reflect.ValueOf(asset), "weight")
+	require.False(t, ok)
+}
@@ -0,0 +1,318 @@
+package abac
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// policyObjectType is used to store the policy under a composite key, so that it is not returned
+// by range queries over assets
+const policyObjectType = "abacPolicy"
+
+// adminAttribute is the certificate attribute required to set the policy. It is checked directly,
+// rather than by the policy, so that a policy cannot lock out its administrators.
+const adminAttribute = "abac.admin"
+
+// defaultPolicyRules are the rules used for functions that are not in the stored policy. They
+// reproduce the original access control of the smart contract: assets can be created by clients
+// with the abac.creator attribute, and only changed by their owner.
+var defaultPolicyRules = map[string]string{
+	"CreateAsset":                 `abac.creator == "true"`,
+	"UpdateAsset":                 "asset.Owner == client.id",
+	"DeleteAsset":                 "asset.Owner == client.id",
+	"TransferAsset":               "asset.Owner == client.id",
+	"ReadAsset":                   "true",
+	"GetAllAssets":                "true",
+	"GetAllAssetsPaged":           "true",
+	"AssetExists":                 "true",
+	"GetSubmittingClientIdentity": "true",
+	"GetPolicy":                   "true",
+	"GrantDelegation":             "asset.Owner == client.id",
+	"RevokeDelegation":            "asset.Owner == client.id",
+	"ListDelegations":             "true",
+	"GetDelegatedActions":         "true",
+}
+
+// assetlessFunctions are the functions whose policy rule is evaluated without an asset, so the
+// rule cannot use asset fields
+var assetlessFunctions = []string{"GetAllAssets", "GetAllAssetsPaged", "AssetExists", "GetSubmittingClientIdentity", "GetPolicy", "GetDelegatedActions"}
+
+// unredactableFields are the asset fields that are always visible to clients that can read an asset
+var unredactableFields = []string{"ID", "RedactedFields"}
+
+// Policy maps smart contract function names to policy expressions, as described in expression.go,
+// that must evaluate to true for the submitting client to call the function. FieldRules maps asset
+// field names to expressions that must evaluate to true for the field to be visible in the assets
+// returned to the client; fields without a rule are always visible.
+type Policy struct {
+	Rules      map[string]string `json:"rules"`
+	FieldRules map[string]string `json:"fieldRules"`
+}
+
+// SetPolicy replaces the policy with a policy document passed as JSON. Functions that are not in
+// the document use the default rules. Only clients with the abac.admin attribute set to true can
+// set the policy.
+func (s *SmartContract) SetPolicy(ctx contractapi.TransactionContextInterface, policyJSON string) error {
+	err := ctx.GetClientIdentity().AssertAttributeValue(adminAttribute, "true")
+	if err != nil {
+		return fmt.Errorf("submitting client not authorized to set policy, does not have %s role", adminAttribute)
+	}
+
+	var policy Policy
+	decoder := json.NewDecoder(bytes.NewReader([]byte(policyJSON)))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&policy)
+	if err != nil {
+		return fmt.Errorf("failed to parse policy: %v", err)
+	}
+
+	for function, rule := range policy.Rules {
+		if _, ok := defaultPolicyRules[function]; !ok {
+			return fmt.Errorf("policy contains unknown function %s, expected one of %s", function, strings.Join(policyFunctions(), ", "))
+		}
+		if err := validateRule(rule, !contains(assetlessFunctions, function)); err != nil {
+			return fmt.Errorf("invalid rule for %s: %v", function, err)
+		}
+	}
+
+	fieldRules := map[string]string{}
+	for field, rule := range policy.FieldRules {
+		index, ok := fieldIndex(reflect.TypeOf(Asset{}), field)
+		if !ok {
+			return fmt.Errorf("policy contains unknown asset field %s", field)
+		}
+		fieldName := reflect.TypeOf(Asset{}).Field(index).Name
+		if contains(unredactableFields, fieldName) {
+			return fmt.Errorf("asset field %s is always visible and cannot have a rule", fieldName)
+		}
+		if err := validateRule(rule, true); err != nil {
+			return fmt.Errorf("invalid rule for field %s: %v", field, err)
+		}
+		fieldRules[fieldName] = rule
+	}
+	policy.FieldRules = fieldRules
+
+	policyKey, err := ctx.GetStub().CreateCompositeKey(policyObjectType, []string{})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+	policyBytes, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(policyKey, policyBytes)
+}
+
+// validateRule checks that a rule can be parsed, and that it only uses known client properties and
+// asset fields, and asset fields only if the rule is evaluated with an asset.
+func validateRule(rule string, hasAsset bool) error {
+	expr, err := parseExpression(rule)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range expressionVariables(expr) {
+		switch {
+		case strings.HasPrefix(name, "client."):
+			if name != "client.id" && name != "client.mspid" {
+				return fmt.Errorf("unknown client property %s, expected client.id or client.mspid", name)
+			}
+		case strings.HasPrefix(name, "asset."):
+			if !hasAsset {
+				return fmt.Errorf("%s cannot be used, the function does not access an asset", name)
+			}
+			if _, ok := fieldIndex(reflect.TypeOf(Asset{}), strings.TrimPrefix(name, "asset.")); !ok {
+				return fmt.Errorf("unknown asset field %s", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetPolicy returns the policy in effect, including the default rules for functions that are not
+// in the stored policy.
+func (s *SmartContract) GetPolicy(ctx contractapi.TransactionContextInterface) (*Policy, error) {
+	policy, err := readPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorizePolicy(ctx, policy, "GetPolicy", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// authorize checks that the submitting client is allowed to call a function by the policy. The
+// asset is the asset accessed by the function, and may be nil if the function does not access an asset.
+func authorize(ctx contractapi.TransactionContextInterface, function string, asset *Asset) error {
+	policy, err := readPolicy(ctx)
+	if err != nil {
+		return err
+	}
+
+	return authorizePolicy(ctx, policy, function, asset)
+}
+
+func authorizePolicy(ctx contractapi.TransactionContextInterface, policy *Policy, function string, asset *Asset) error {
+	allowed, err := policyAllows(ctx, policy, function, asset)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return authorizationError(policy, function)
+	}
+
+	return nil
+}
+
+func authorizationError(policy *Policy, function string) error {
+	return fmt.Errorf("submitting client not authorized to call %s, policy rule not satisfied: %s", function, policy.Rules[function])
+}
+
+// policyAllows evaluates the policy rule for a function, returning an error only if the rule
+// cannot be evaluated.
+func policyAllows(ctx contractapi.TransactionContextInterface, policy *Policy, function string, asset *Asset) (bool, error) {
+	return policyAllowsFor(ctx, policy, function, asset, "")
+}
+
+// policyAllowsFor evaluates the policy rule for a function with client.id resolved to the client
+// that the submitting client acts on behalf of, or to the submitting client if onBehalfOf is empty.
+func policyAllowsFor(ctx contractapi.TransactionContextInterface, policy *Policy, function string, asset *Asset, onBehalfOf string) (bool, error) {
+	rule, ok := policy.Rules[function]
+	if !ok {
+		return false, fmt.Errorf("no policy rule for function %s", function)
+	}
+
+	allowed, err := evaluateExpression(rule, &policyEnv{ctx: ctx, asset: asset, onBehalfOf: onBehalfOf})
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate policy rule for %s: %v", function, err)
+	}
+
+	return allowed, nil
+}
+
+// readPolicy returns the stored policy, with default rules added for functions that are not in it.
+func readPolicy(ctx contractapi.TransactionContextInterface) (*Policy, error) {
+	policyKey, err := ctx.GetStub().CreateCompositeKey(policyObjectType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create composite key: %v", err)
+	}
+	policyBytes, err := ctx.GetStub().GetState(policyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %v", err)
+	}
+
+	policy := &Policy{}
+	if policyBytes != nil {
+		err = json.Unmarshal(policyBytes, policy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal policy: %v", err)
+		}
+	}
+	if policy.Rules == nil {
+		policy.Rules = map[string]string{}
+	}
+	if policy.FieldRules == nil {
+		policy.FieldRules = map[string]string{}
+	}
+	for function, rule := range defaultPolicyRules {
+		if _, ok := policy.Rules[function]; !ok {
+			policy.Rules[function] = rule
+		}
+	}
+
+	return policy, nil
+}
+
+// redactAsset returns a copy of an asset, with the fields that the field rules of the policy do not
+// allow the submitting client to see set to their zero value and listed in RedactedFields.
+func redactAsset(ctx contractapi.TransactionContextInterface, policy *Policy, asset *Asset) (*Asset, error) {
+	redacted := *asset
+	redacted.RedactedFields = nil
+
+	fields := make([]string, 0, len(policy.FieldRules))
+	for field := range policy.FieldRules {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	redactedValue := reflect.ValueOf(&redacted).Elem()
+	for _, field := range fields {
+		visible, err := evaluateExpression(policy.FieldRules[field], &policyEnv{ctx: ctx, asset: asset})
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate policy rule for field %s: %v", field, err)
+		}
+		if visible {
+			continue
+		}
+
+		index, ok := fieldIndex(redactedValue.Type(), field)
+		if !ok {
+			return nil, fmt.Errorf("unknown asset field %s in policy", field)
+		}
+		fieldValue := redactedValue.Field(index)
+		fieldValue.Set(reflect.Zero(fieldValue.Type()))
+		redacted.RedactedFields = append(redacted.RedactedFields, field)
+	}
+
+	return &redacted, nil
+}
+
+func policyFunctions() []string {
+	functions := make([]string, 0, len(defaultPolicyRules))
+	for function := range defaultPolicyRules {
+		functions = append(functions, function)
+	}
+	sort.Strings(functions)
+	return functions
+}
+
+// policyEnv resolves policy expression variables for the submitting client and an asset
+type policyEnv struct {
+	ctx        contractapi.TransactionContextInterface
+	asset      *Asset
+	onBehalfOf string
+}
+
+func (env *policyEnv) resolve(name string) (interface{}, error) {
+	switch {
+	case name == "client.id" && env.onBehalfOf != "":
+		return env.onBehalfOf, nil
+	case name == "client.id":
+		return submittingClientID(env.ctx)
+	case name == "client.mspid":
+		mspID, err := env.ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client MSP ID: %v", err)
+		}
+		return mspID, nil
+	case strings.HasPrefix(name, "client."):
+		return nil, fmt.Errorf("unknown client property %s, expected client.id or client.mspid", name)
+	case strings.HasPrefix(name, "asset."):
+		if env.asset == nil {
+			return nil, fmt.Errorf("%s cannot be used, the function does not access an asset", name)
+		}
+		value, ok := structField(reflect.ValueOf(*env.asset), strings.TrimPrefix(name, "asset."))
+		if !ok {
+			return nil, fmt.Errorf("unknown asset field %s", name)
+		}
+		return value, nil
+	default:
+		value, _, err := env.ctx.GetClientIdentity().GetAttributeValue(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client attribute %s: %v", name, err)
+		}
+		return value, nil
+	}
+}
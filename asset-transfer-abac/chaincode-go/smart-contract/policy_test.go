@@ -0,0 +1,217 @@
+package abac
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-abac/chaincode-go/smart-contract/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+/*
+These unit tests use mocks to simulate chaincode-api & fabric interactions
+The mocks are generated using counterfeiter directives in the comments (starting with "go:generate counterfeiter")
+All files in mocks/* are generated by running following, in the directory with your directive:
+	`go generate`
+*/
+
+//go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
+type transactionContext interface {
+	contractapi.TransactionContextInterface
+}
+
+//go:generate counterfeiter -o mocks/chaincodestub.go -fake-name ChaincodeStub . chaincodeStub
+type chaincodeStub interface {
+	shim.ChaincodeStubInterface
+}
+
+//go:generate counterfeiter -o mocks/statequeryiterator.go -fake-name StateQueryIterator . stateQueryIterator
+type stateQueryIterator interface {
+	shim.StateQueryIteratorInterface
+}
+
+//go:generate counterfeiter -o mocks/clientIdentity.go -fake-name ClientIdentity . clientIdentity
+type clientIdentity interface {
+	cid.ClientIdentity
+}
+
+const (
+	ownerID    = "x509::CN=owner::CN=ca"
+	delegateID = "x509::CN=delegate::CN=ca"
+	testMSPID  = "Org1MSP"
+)
+
+var txTimestamp = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+func TestAuthorize(t *testing.T) {
+	transactionContext, state, clientIdentity := prepMocks(t, ownerID, nil)
+	asset := &Asset{ID: "asset1", Owner: ownerID, AppraisedValue: 300}
+
+	// Default rules
+	err := authorize(transactionContext, "UpdateAsset", asset)
+	require.NoError(t, err)
+	err = authorize(transactionContext, "UpdateAsset", &Asset{ID: "asset1", Owner: delegateID})
+	require.EqualError(t, err, "submitting client not authorized to call UpdateAsset, policy rule not satisfied: asset.Owner == client.id")
+	err = authorize(transactionContext, "CreateAsset", asset)
+	require.EqualError(t, err, `submitting client not authorized to call CreateAsset, policy rule not satisfied: abac.creator == "true"`)
+
+	// Stored rules replace the default rules
+	putTestPolicy(t, state, &Policy{Rules: map[string]string{
+		"UpdateAsset": "abac.role in [auditor, admin] && asset.AppraisedValue < 1000",
+	}})
+	err = authorize(transactionContext, "UpdateAsset", asset)
+	require.EqualError(t, err, "submitting client not authorized to call UpdateAsset, policy rule not satisfied: abac.role in [auditor, admin] && asset.AppraisedValue < 1000")
+
+	clientIdentity.GetAttributeValueStub = nil
+	clientIdentity.GetAttributeValueReturns("admin", true, nil)
+	err = authorize(transactionContext, "UpdateAsset", asset)
+	require.NoError(t, err)
+	err = authorize(transactionContext, "UpdateAsset", &Asset{ID: "asset1", AppraisedValue: 1000})
+	require.Error(t, err)
+
+	_, err = policyAllows(transactionContext, &Policy{Rules: map[string]string{}}, "UpdateAsset", asset)
+	require.EqualError(t, err, "no policy rule for function UpdateAsset")
+}
+
+func TestSetPolicy(t *testing.T) {
+	transactionContext, state, _ := prepMocks(t, ownerID, map[string]string{adminAttribute: "true"})
+	clientIdentity := transactionContext.GetClientIdentity().(*mocks.ClientIdentity)
+	clientIdentity.AssertAttributeValueStub = func(name string, value string) error {
+		if actual, _, _ := clientIdentity.GetAttributeValue(name); actual != value {
+			return fmt.Errorf("attribute %s does not have value %s", name, value)
+		}
+		return nil
+	}
+	assetTransfer := &SmartContract{}
+
+	err := assetTransfer.SetPolicy(transactionContext, `{"rules":{"UpdateAsset":"abac.role == admin && asset.color != red"},"fieldRules":{"appraisedValue":"abac.role == auditor || asset.Owner == client.id"}}`)
+	require.NoError(t, err)
+
+	policy, err := assetTransfer.GetPolicy(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, "abac.role == admin && asset.color != red", policy.Rules["UpdateAsset"])
+	require.Equal(t, defaultPolicyRules["DeleteAsset"], policy.Rules["DeleteAsset"])
+	require.Equal(t, map[string]string{"AppraisedValue": "abac.role == auditor || asset.Owner == client.id"}, policy.FieldRules)
+
+	tests := []struct {
+		name   string
+		policy string
+		err    string
+	}{
+		{"unknown property", `{"rule":{}}`, `failed to parse policy: json: unknown field "rule"`},
+		{"unknown function", `{"rules":{"Transfer":"true"}}`, "policy contains unknown function Transfer, expected one of " + strings.Join(policyFunctions(), ", ")},
+		{"invalid rule", `{"rules":{"UpdateAsset":"abac.role =="}}`, "invalid rule for UpdateAsset: unexpected end of expression, expected a value"},
+		{"unknown asset field in rule", `{"rules":{"UpdateAsset":"asset.Ownr == client.id"}}`, "invalid rule for UpdateAsset: unknown asset field asset.Ownr"},
+		{"unknown client property in rule", `{"rules":{"UpdateAsset":"abac.role == admin || client.name == admin"}}`, "invalid rule for UpdateAsset: unknown client property client.name, expected client.id or client.mspid"},
+		{"asset field without asset", `{"rules":{"GetAllAssets":"asset.Owner == client.id"}}`, "invalid rule for GetAllAssets: asset.Owner cannot be used, the function does not access an asset"},
+		{"asset field in list without asset", `{"rules":{"GetPolicy":"client.mspid in [Org1MSP, asset.Owner]"}}`, "invalid rule for GetPolicy: asset.Owner cannot be used, the function does not access an asset"},
+		{"unknown field", `{"fieldRules":{"weight":"true"}}`, "policy contains unknown asset field weight"},
+		{"unknown asset field in field rule", `{"fieldRules":{"owner":"!(asset.Ownr == client.id)"}}`, "invalid rule for field owner: unknown asset field asset.Ownr"},
+		{"unknown client property in field rule", `{"fieldRules":{"owner":"client.role == admin"}}`, "invalid rule for field owner: unknown client property client.role, expected client.id or client.mspid"},
+		{"unredactable field", `{"fieldRules":{"ID":"true"}}`, "asset field ID is always visible and cannot have a rule"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := assetTransfer.SetPolicy(transactionContext, test.policy)
+			require.EqualError(t, err, test.err)
+		})
+	}
+
+	// Only administrators can set the policy
+	policyKey, err := shim.CreateCompositeKey(policyObjectType, []string{})
+	require.NoError(t, err)
+	stored := state[policyKey]
+	clientIdentity.AssertAttributeValueStub = nil
+	clientIdentity.AssertAttributeValueReturns(fmt.Errorf("attribute not found"))
+	err = assetTransfer.SetPolicy(transactionContext, `{}`)
+	require.EqualError(t, err, "submitting client not authorized to set policy, does not have abac.admin role")
+	require.Equal(t, stored, state[policyKey])
+}
+
+func TestRedactAsset(t *testing.T) {
+	transactionContext, _, clientIdentity := prepMocks(t, ownerID, map[string]string{"abac.role": "auditor"})
+	asset := &Asset{ID: "asset1", Color: "blue", Size: 5, Owner: ownerID, AppraisedValue: 300}
+	policy := &Policy{FieldRules: map[string]string{
+		"AppraisedValue": "abac.role in [auditor, admin]",
+		"Owner":          "asset.Owner == client.id",
+		"Size":           "client.mspid == Org2MSP",
+	}}
+
+	redacted, err := redactAsset(transactionContext, policy, asset)
+	require.NoError(t, err)
+	require.Equal(t, &Asset{ID: "asset1", Color: "blue", Size: 0, Owner: ownerID, AppraisedValue: 300, RedactedFields: []string{"Size"}}, redacted)
+	require.Equal(t, 5, asset.Size)
+
+	// Field rules are evaluated for the submitting client
+	clientIdentity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(delegateID)), nil)
+	clientIdentity.GetAttributeValueReturns("", false, nil)
+	redacted, err = redactAsset(transactionContext, policy, asset)
+	require.NoError(t, err)
+	require.Equal(t, &Asset{ID: "asset1", Color: "blue", RedactedFields: []string{"AppraisedValue", "Owner", "Size"}}, redacted)
+
+	// Fields without a rule are always visible
+	redacted, err = redactAsset(transactionContext, &Policy{FieldRules: map[string]string{}}, asset)
+	require.NoError(t, err)
+	require.Equal(t, asset, redacted)
+	require.Nil(t, redacted.RedactedFields)
+
+	_, err = redactAsset(transactionContext, &Policy{FieldRules: map[string]string{"Color": "abac.role < 5"}}, asset)
+	require.EqualError(t, err, `failed to evaluate policy rule for field Color: cannot compare "" < "5", values are not numbers`)
+}
+
+// prepMocks prepares the mocks for a client with the given ID and certificate attributes, and
+// returns the world state used by the chaincode stub
+func prepMocks(t *testing.T, clientID string, attributes map[string]string) (*mocks.TransactionContext, map[string][]byte, *mocks.ClientIdentity) {
+	chaincodeStub := &mocks.ChaincodeStub{}
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+
+	clientIdentity := &mocks.ClientIdentity{}
+	clientIdentity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(clientID)), nil)
+	clientIdentity.GetMSPIDReturns(testMSPID, nil)
+	clientIdentity.GetAttributeValueStub = func(name string) (string, bool, error) {
+		value, ok := attributes[name]
+		return value, ok, nil
+	}
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+
+	state := map[string][]byte{}
+	chaincodeStub.CreateCompositeKeyStub = shim.CreateCompositeKey
+	chaincodeStub.GetStateStub = func(key string) ([]byte, error) {
+		return state[key], nil
+	}
+	chaincodeStub.PutStateStub = func(key string, value []byte) error {
+		state[key] = value
+		return nil
+	}
+	chaincodeStub.DelStateStub = func(key string) error {
+		delete(state, key)
+		return nil
+	}
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTimestamp), nil)
+	chaincodeStub.GetTxIDReturns("tx1")
+
+	return transactionContext, state, clientIdentity
+}
+
+func putTestAsset(t *testing.T, state map[string][]byte, asset *Asset) {
+	assetJSON, err := json.Marshal(asset)
+	require.NoError(t, err)
+	state[asset.ID] = assetJSON
+}
+
+func putTestPolicy(t *testing.T, state map[string][]byte, policy *Policy) {
+	policyKey, err := shim.CreateCompositeKey(policyObjectType, []string{})
+	require.NoError(t, err)
+	policyJSON, err := json.Marshal(policy)
+	require.NoError(t, err)
+	state[policyKey] = policyJSON
+}
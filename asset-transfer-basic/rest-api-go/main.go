@@ -1,11 +1,21 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"rest-api-go/web"
+	"strings"
 )
 
 func main() {
+	address := flag.String("address", ":3000", "address on which the server listens")
+	useTLS := flag.Bool("tls", false, "serve HTTPS using a server certificate issued by the organization's TLS CA")
+	mutualTLS := flag.Bool("mtls", false, "require client certificates and sign transactions as the matching enrolled identity")
+	tlsCertPath := flag.String("tls-cert", "", "server certificate file (issued by the organization's TLS CA if not specified)")
+	tlsKeyPath := flag.String("tls-key", "", "server private key file")
+	hostnames := flag.String("hostnames", "localhost,127.0.0.1", "comma-separated host names for the issued server certificate")
+	flag.Parse()
+
 	//Initialize setup for Org1
 	cryptoPath := "../../test-network/organizations/peerOrganizations/org1.example.com"
 	orgConfig := web.OrgSetup{
@@ -17,10 +27,25 @@ func main() {
 		PeerEndpoint: "dns:///localhost:7051",
 		GatewayPeer:  "peer0.org1.example.com",
 	}
+	if *mutualTLS {
+		orgConfig.UsersPath = cryptoPath + "/users"
+	}
+
+	serverConfig := web.ServerConfig{
+		Address:     *address,
+		TLS:         *useTLS,
+		MutualTLS:   *mutualTLS,
+		TLSCertPath: *tlsCertPath,
+		TLSKeyPath:  *tlsKeyPath,
+		Hostnames:   strings.Split(*hostnames, ","),
+		CACertPath:  cryptoPath + "/tlsca/tlsca.org1.example.com-cert.pem",
+		CAKeyPath:   cryptoPath + "/tlsca/priv_sk",
+	}
 
 	orgSetup, err := web.Initialize(orgConfig)
 	if err != nil {
 		fmt.Println("Error initializing setup for Org1: ", err)
+		return
 	}
-	web.Serve(web.OrgSetup(*orgSetup))
+	web.Serve(web.OrgSetup(*orgSetup), serverConfig)
 }
@@ -17,15 +17,56 @@ type OrgSetup struct {
 	TLSCertPath  string
 	PeerEndpoint string
 	GatewayPeer  string
+	// UsersPath is the directory containing enrolled user identities that can act on behalf of mutual TLS clients.
+	UsersPath    string
 	Gateway      client.Gateway
+	userGateways map[string]*client.Gateway
+}
+
+// ServerConfig contains the web server listener configuration.
+type ServerConfig struct {
+	Address string
+	TLS     bool
+	// MutualTLS requires clients to present a certificate issued by the CA, and transactions are signed by the
+	// enrolled identity whose TLS client certificate is the presented certificate.
+	MutualTLS bool
+	// TLSCertPath and TLSKeyPath are the server certificate and private key files. If not specified, a server
+	// certificate for Hostnames is issued by the CA at startup.
+	TLSCertPath string
+	TLSKeyPath  string
+	Hostnames   []string
+	CACertPath  string
+	CAKeyPath   string
 }
 
 // Serve starts http web server.
-func Serve(setups OrgSetup) {
-	http.HandleFunc("/query", setups.Query)
-	http.HandleFunc("/invoke", setups.Invoke)
-	fmt.Println("Listening (http://localhost:3000/)...")
-	if err := http.ListenAndServe(":3000", nil); err != nil {
+func Serve(setups OrgSetup, config ServerConfig) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/query", setups.Query)
+	mux.HandleFunc("/invoke", setups.Invoke)
+
+	server := &http.Server{
+		Addr:    config.Address,
+		Handler: mux,
+	}
+
+	if !config.TLS && !config.MutualTLS {
+		fmt.Printf("Listening (http://%s/)...\n", config.Address)
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	tlsConfig, err := config.newTLSConfig()
+	if err != nil {
+		fmt.Println("Error creating TLS configuration: ", err)
+		return
+	}
+	server.TLSConfig = tlsConfig
+
+	fmt.Printf("Listening (https://%s/)...\n", config.Address)
+	if err := server.ListenAndServeTLS("", ""); err != nil {
 		fmt.Println(err)
 	}
 }
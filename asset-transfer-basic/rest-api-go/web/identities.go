@@ -0,0 +1,96 @@
+package web
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc"
+)
+
+// connectUserGateways connects a Gateway for each enrolled user found in the UsersPath directory. Gateways are keyed
+// by the fingerprint of the user's TLS client certificate, so a client certificate presented to the mutual TLS
+// listener is only matched to the user it was issued to, not to another certificate with the same subject.
+func (setup *OrgSetup) connectUserGateways(clientConnection *grpc.ClientConn) error {
+	entries, err := os.ReadDir(setup.UsersPath)
+	if err != nil {
+		return fmt.Errorf("failed to read users directory: %w", err)
+	}
+
+	setup.userGateways = make(map[string]*client.Gateway)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		userPath := path.Join(setup.UsersPath, entry.Name())
+		tlsCertificate, err := loadCertificate(path.Join(userPath, "tls", "client.crt"))
+		if err != nil {
+			log.Printf("Skipping user %s: %v\n", entry.Name(), err)
+			continue
+		}
+
+		mspPath := path.Join(userPath, "msp")
+		certPath, err := firstFile(path.Join(mspPath, "signcerts"))
+		if err != nil {
+			log.Printf("Skipping user %s: %v\n", entry.Name(), err)
+			continue
+		}
+
+		userSetup := *setup
+		userSetup.CertPath = certPath
+		userSetup.KeyPath = path.Join(mspPath, "keystore")
+
+		gateway, err := userSetup.connect(clientConnection)
+		if err != nil {
+			return err
+		}
+
+		setup.userGateways[certificateFingerprint(tlsCertificate)] = gateway
+		log.Printf("Enrolled identity %s available for mutual TLS clients\n", entry.Name())
+	}
+
+	return nil
+}
+
+// gatewayFor returns the Gateway that should sign transactions for a request. Requests authenticated with a
+// client certificate use the enrolled identity whose TLS client certificate is the presented certificate.
+func (setup *OrgSetup) gatewayFor(r *http.Request) (*client.Gateway, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return &setup.Gateway, nil
+	}
+
+	certificate := r.TLS.PeerCertificates[0]
+	gateway, ok := setup.userGateways[certificateFingerprint(certificate)]
+	if !ok {
+		return nil, newHTTPError(http.StatusForbidden, fmt.Errorf("no enrolled identity found for client certificate with subject %q", certificate.Subject.String()))
+	}
+
+	fmt.Printf("Acting on behalf of %s\n", certificate.Subject.String())
+	return gateway, nil
+}
+
+// certificateFingerprint returns the hex encoded SHA-256 hash of a certificate.
+func certificateFingerprint(certificate *x509.Certificate) string {
+	hash := sha256.Sum256(certificate.Raw)
+	return hex.EncodeToString(hash[:])
+}
+
+func firstFile(dirPath string) (string, error) {
+	files, err := os.ReadDir(dirPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+	for _, file := range files {
+		if !file.IsDir() {
+			return path.Join(dirPath, file.Name()), nil
+		}
+	}
+	return "", fmt.Errorf("no files found in %s", dirPath)
+}
@@ -19,10 +19,27 @@ import (
 func Initialize(setup OrgSetup) (*OrgSetup, error) {
 	log.Printf("Initializing connection for %s...\n", setup.OrgName)
 	clientConnection := setup.newGrpcConnection()
+	gateway, err := setup.connect(clientConnection)
+	if err != nil {
+		return nil, err
+	}
+	setup.Gateway = *gateway
+
+	if setup.UsersPath != "" {
+		if err := setup.connectUserGateways(clientConnection); err != nil {
+			return nil, err
+		}
+	}
+	log.Println("Initialization complete")
+	return &setup, nil
+}
+
+// connect creates a Gateway connection for this setup's identity using a shared gRPC connection.
+func (setup OrgSetup) connect(clientConnection *grpc.ClientConn) (*client.Gateway, error) {
 	id := setup.newIdentity()
 	sign := setup.newSign()
 
-	gateway, err := client.Connect(
+	return client.Connect(
 		id,
 		client.WithSign(sign),
 		client.WithHash(hash.SHA256),
@@ -32,12 +49,6 @@ func Initialize(setup OrgSetup) (*OrgSetup, error) {
 		client.WithSubmitTimeout(5*time.Second),
 		client.WithCommitStatusTimeout(1*time.Minute),
 	)
-	if err != nil {
-		panic(err)
-	}
-	setup.Gateway = *gateway
-	log.Println("Initialization complete")
-	return &setup, nil
 }
 
 // newGrpcConnection creates a gRPC connection to the Gateway server.
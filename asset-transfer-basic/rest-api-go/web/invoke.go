@@ -3,38 +3,67 @@ package web
 import (
 	"fmt"
 	"net/http"
-
-	"github.com/hyperledger/fabric-gateway/pkg/client"
 )
 
 // Invoke handles chaincode invoke requests.
 func (setup *OrgSetup) Invoke(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received Invoke request")
-	if err := r.ParseForm(); err != nil {
-		fmt.Fprintf(w, "ParseForm() err: %s", err)
-		return
-	}
-	chainCodeName := r.FormValue("chaincodeid")
-	channelID := r.FormValue("channelid")
-	function := r.FormValue("function")
-	args := r.Form["args"]
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
-	contract := network.GetContract(chainCodeName)
-	txn_proposal, err := contract.NewProposal(function, client.WithArguments(args...))
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, newHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)))
+		return
+	}
+
+	request, err := parseChaincodeRequest(w, r)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err))
+		return
+	}
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", request.Channel, request.Chaincode, request.Function, request.Args)
+
+	options, err := request.proposalOptions()
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err))
+		return
+	}
+
+	gateway, err := setup.gatewayFor(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	network := gateway.GetNetwork(request.Channel)
+	contract := network.GetContract(request.Chaincode)
+	txn_proposal, err := contract.NewProposal(request.Function, options...)
 	if err != nil {
-		fmt.Fprintf(w, "Error creating txn proposal: %s", err)
+		writeError(w, fmt.Errorf("error creating txn proposal: %w", err))
 		return
 	}
 	txn_endorsed, err := txn_proposal.Endorse()
 	if err != nil {
-		fmt.Fprintf(w, "Error endorsing txn: %s", err)
+		writeError(w, fmt.Errorf("error endorsing txn: %w", err))
 		return
 	}
 	txn_committed, err := txn_endorsed.Submit()
 	if err != nil {
-		fmt.Fprintf(w, "Error submitting transaction: %s", err)
+		writeError(w, fmt.Errorf("error submitting transaction: %w", err))
 		return
 	}
-	fmt.Fprintf(w, "Transaction ID : %s Response: %s", txn_committed.TransactionID(), txn_endorsed.Result())
+	txn_status, err := txn_committed.Status()
+	if err != nil {
+		writeError(w, fmt.Errorf("error obtaining commit status: %w", err))
+		return
+	}
+	if !txn_status.Successful {
+		err := fmt.Errorf("transaction %s failed to commit with status code %d (%s)", txn_status.TransactionID, int32(txn_status.Code), txn_status.Code)
+		writeError(w, newHTTPError(http.StatusConflict, err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ChaincodeResponse{
+		TransactionID: txn_status.TransactionID,
+		BlockNumber:   &txn_status.BlockNumber,
+		Result:        decodeResult(txn_endorsed.Result()),
+	})
 }
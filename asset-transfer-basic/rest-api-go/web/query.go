@@ -8,18 +8,46 @@ import (
 // Query handles chaincode query requests.
 func (setup OrgSetup) Query(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("Received Query request")
-	queryParams := r.URL.Query()
-	chainCodeName := queryParams.Get("chaincodeid")
-	channelID := queryParams.Get("channelid")
-	function := queryParams.Get("function")
-	args := r.URL.Query()["args"]
-	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", channelID, chainCodeName, function, args)
-	network := setup.Gateway.GetNetwork(channelID)
-	contract := network.GetContract(chainCodeName)
-	evaluateResponse, err := contract.EvaluateTransaction(function, args...)
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		writeError(w, newHTTPError(http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method)))
+		return
+	}
+
+	request, err := parseChaincodeRequest(w, r)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err))
+		return
+	}
+	fmt.Printf("channel: %s, chaincode: %s, function: %s, args: %s\n", request.Channel, request.Chaincode, request.Function, request.Args)
+
+	options, err := request.proposalOptions()
 	if err != nil {
-		fmt.Fprintf(w, "Error: %s", err)
+		writeError(w, newHTTPError(http.StatusBadRequest, err))
 		return
 	}
-	fmt.Fprintf(w, "Response: %s", evaluateResponse)
+
+	gateway, err := setup.gatewayFor(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	network := gateway.GetNetwork(request.Channel)
+	contract := network.GetContract(request.Chaincode)
+	proposal, err := contract.NewProposal(request.Function, options...)
+	if err != nil {
+		writeError(w, fmt.Errorf("error creating query proposal: %w", err))
+		return
+	}
+	evaluateResponse, err := proposal.Evaluate()
+	if err != nil {
+		writeError(w, fmt.Errorf("error evaluating query: %w", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ChaincodeResponse{
+		TransactionID: proposal.TransactionID(),
+		Result:        decodeResult(evaluateResponse),
+	})
 }
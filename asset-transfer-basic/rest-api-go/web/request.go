@@ -0,0 +1,117 @@
+package web
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// ChaincodeRequest is the JSON body accepted by the invoke and query endpoints.
+type ChaincodeRequest struct {
+	Channel                string                     `json:"channel"`
+	Chaincode              string                     `json:"chaincode"`
+	Function               string                     `json:"function"`
+	Args                   []string                   `json:"args"`
+	Transient              map[string]json.RawMessage `json:"transient,omitempty"`
+	EndorsingOrganizations []string                   `json:"endorsingOrganizations,omitempty"`
+}
+
+// maxRequestBodySize limits the size of request bodies read by the server.
+const maxRequestBodySize = 1 << 20
+
+// parseChaincodeRequest reads a chaincode request from a JSON body or, for GET requests, from query parameters.
+func parseChaincodeRequest(w http.ResponseWriter, r *http.Request) (*ChaincodeRequest, error) {
+	var request ChaincodeRequest
+
+	if r.Method == http.MethodGet {
+		queryParams := r.URL.Query()
+		request.Channel = firstQueryParam(queryParams, "channel", "channelid")
+		request.Chaincode = firstQueryParam(queryParams, "chaincode", "chaincodeid")
+		request.Function = queryParams.Get("function")
+		request.Args = queryParams["args"]
+	} else {
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			return nil, fmt.Errorf("invalid JSON request body: %w", err)
+		}
+	}
+
+	if err := request.validate(); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// firstQueryParam returns the value of the first of the named query parameters that is set. This allows the
+// channelid and chaincodeid parameters accepted by earlier versions of the query endpoint to still be used.
+func firstQueryParam(queryParams url.Values, names ...string) string {
+	for _, name := range names {
+		if value := queryParams.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (request *ChaincodeRequest) validate() error {
+	if request.Channel == "" {
+		return errors.New("channel must be specified")
+	}
+	if request.Chaincode == "" {
+		return errors.New("chaincode must be specified")
+	}
+	if request.Function == "" {
+		return errors.New("function must be specified")
+	}
+	return nil
+}
+
+// proposalOptions converts the request into options used to create a transaction proposal.
+func (request *ChaincodeRequest) proposalOptions() ([]client.ProposalOption, error) {
+	options := []client.ProposalOption{client.WithArguments(request.Args...)}
+
+	if len(request.Transient) > 0 {
+		transient, err := decodeTransient(request.Transient)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, client.WithTransient(transient))
+	}
+
+	if len(request.EndorsingOrganizations) > 0 {
+		options = append(options, client.WithEndorsingOrganizations(request.EndorsingOrganizations...))
+	}
+
+	return options, nil
+}
+
+// decodeTransient converts transient values into raw bytes. A JSON string value is treated as base64 encoded
+// data, while any other JSON value is passed to the chaincode as its compact JSON encoding.
+func decodeTransient(values map[string]json.RawMessage) (map[string][]byte, error) {
+	transient := make(map[string][]byte, len(values))
+	for key, value := range values {
+		var encoded string
+		if err := json.Unmarshal(value, &encoded); err == nil {
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("transient value %q is not valid base64: %w", key, err)
+			}
+			transient[key] = decoded
+			continue
+		}
+
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, value); err != nil {
+			return nil, fmt.Errorf("transient value %q is not valid JSON: %w", key, err)
+		}
+		transient[key] = compacted.Bytes()
+	}
+	return transient, nil
+}
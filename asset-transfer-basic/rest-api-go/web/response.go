@@ -0,0 +1,131 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ChaincodeResponse is the JSON envelope returned by the invoke and query endpoints.
+type ChaincodeResponse struct {
+	TransactionID string          `json:"transactionId"`
+	BlockNumber   *uint64         `json:"blockNumber,omitempty"`
+	Result        json.RawMessage `json:"result,omitempty"`
+}
+
+// ErrorResponse is the JSON body returned when a request fails.
+type ErrorResponse struct {
+	Error         string   `json:"error"`
+	TransactionID string   `json:"transactionId,omitempty"`
+	Details       []string `json:"details,omitempty"`
+}
+
+// httpError is an error with the HTTP status code that should be returned to the caller.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+func newHTTPError(status int, err error) error {
+	return &httpError{status: status, err: err}
+}
+
+// decodeResult returns chaincode result bytes as JSON if they are valid JSON, or as a JSON string otherwise.
+func decodeResult(result []byte) json.RawMessage {
+	if len(result) == 0 {
+		return nil
+	}
+	if json.Valid(result) {
+		return result
+	}
+	encoded, _ := json.Marshal(string(result))
+	return encoded
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		fmt.Printf("Error writing response: %s\n", err)
+	}
+}
+
+// writeError maps an error to an HTTP status code and writes it as a JSON error response.
+func writeError(w http.ResponseWriter, err error) {
+	fmt.Printf("Error: %s\n", err)
+
+	response := ErrorResponse{Error: err.Error()}
+
+	var transactionErr *client.TransactionError
+	var endorseErr *client.EndorseError
+	var submitErr *client.SubmitError
+	var commitStatusErr *client.CommitStatusError
+	switch {
+	case errors.As(err, &endorseErr):
+		transactionErr = endorseErr.TransactionError
+	case errors.As(err, &submitErr):
+		transactionErr = submitErr.TransactionError
+	case errors.As(err, &commitStatusErr):
+		transactionErr = commitStatusErr.TransactionError
+	default:
+		errors.As(err, &transactionErr)
+	}
+	if transactionErr != nil {
+		response.TransactionID = transactionErr.TransactionID
+	}
+
+	for _, detail := range status.Convert(err).Details() {
+		if errorDetail, ok := detail.(interface{ GetMessage() string }); ok {
+			response.Details = append(response.Details, errorDetail.GetMessage())
+		}
+	}
+
+	writeJSON(w, httpStatus(err), response)
+}
+
+// httpStatus returns the HTTP status code that best describes an error.
+func httpStatus(err error) int {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		return httpErr.status
+	}
+
+	var commitErr *client.CommitError
+	if errors.As(err, &commitErr) {
+		return http.StatusConflict
+	}
+
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Aborted, codes.AlreadyExists, codes.FailedPrecondition:
+		return http.StatusConflict
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
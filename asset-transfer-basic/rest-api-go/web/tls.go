@@ -0,0 +1,118 @@
+package web
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/identity"
+)
+
+// serverCertificateValidity is the lifetime of server certificates issued from the organization's TLS CA.
+const serverCertificateValidity = 365 * 24 * time.Hour
+
+// newTLSConfig creates the TLS configuration for the HTTPS listener. If no server certificate and key are
+// configured, a server certificate is issued using the organization's TLS CA certificate and private key.
+func (config ServerConfig) newTLSConfig() (*tls.Config, error) {
+	var serverCertificate tls.Certificate
+	var err error
+	if config.TLSCertPath != "" && config.TLSKeyPath != "" {
+		serverCertificate, err = tls.LoadX509KeyPair(config.TLSCertPath, config.TLSKeyPath)
+	} else {
+		serverCertificate, err = config.issueServerCertificate()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if config.MutualTLS {
+		caCertificate, err := loadCertificate(config.CACertPath)
+		if err != nil {
+			return nil, err
+		}
+		clientCAs := x509.NewCertPool()
+		clientCAs.AddCert(caCertificate)
+
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// issueServerCertificate creates a new server key pair and signs its certificate with the configured CA.
+func (config ServerConfig) issueServerCertificate() (tls.Certificate, error) {
+	caCertificate, err := loadCertificate(config.CACertPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	caKeyPEM, err := os.ReadFile(config.CAKeyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to read CA private key file: %w", err)
+	}
+	caKey, err := identity.PrivateKeyFromPEM(caKeyPEM)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	caSigner, ok := caKey.(crypto.Signer)
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("unsupported CA private key type: %T", caKey)
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate server private key: %w", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to generate certificate serial number: %w", err)
+	}
+
+	hostnames := config.Hostnames
+	if len(hostnames) == 0 {
+		hostnames = []string{"localhost"}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject:      pkix.Name{CommonName: hostnames[0]},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(serverCertificateValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, hostname := range hostnames {
+		if ip := net.ParseIP(hostname); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, hostname)
+		}
+	}
+
+	certificateDER, err := x509.CreateCertificate(rand.Reader, template, caCertificate, &serverKey.PublicKey, caSigner)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to issue server certificate: %w", err)
+	}
+
+	return tls.Certificate{
+		Certificate: [][]byte{certificateDER, caCertificate.Raw},
+		PrivateKey:  serverKey,
+	}, nil
+}
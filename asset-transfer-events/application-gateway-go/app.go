@@ -11,9 +11,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"assetTransfer/assetevent"
+
 	"github.com/hyperledger/fabric-gateway/pkg/client"
 	"github.com/hyperledger/fabric-gateway/pkg/hash"
 )
@@ -27,6 +35,31 @@ var now = time.Now()
 var assetID = fmt.Sprintf("asset%d", now.Unix()*1e3+int64(now.Nanosecond())/1e6)
 
 func main() {
+	listenerNames := flag.String("listeners", "events", "comma-separated names of chaincode event listeners, each with its own checkpoint")
+	checkpointDir := flag.String("checkpoint-dir", "checkpoints", "directory in which listener checkpoints are stored")
+	startBlock := flag.Int64("start-block", -1, "block from which listeners without a checkpoint start reading events, or -1 for the next block")
+	simulate := flag.Bool("simulate", true, "submit sample transactions that emit chaincode events")
+	listen := flag.Bool("listen", true, "keep listening for events until interrupted; if false, exit after the sample transactions")
+	relayConfigFile := flag.String("relay-config", "", "webhook relay configuration file; if set, events are also relayed by a listener named relay")
+	deadLetterFile := flag.String("dead-letter", "dead-letter.jsonl", "file in which undeliverable webhook events are stored")
+	blockListenerName := flag.String("block-listener", "", "name of a block event listener that extracts transaction read/write sets; disabled if empty")
+	blockOutput := flag.String("block-output", "-", "file to which block listener transactions are appended as JSON lines, or - for standard output")
+	flag.Parse()
+
+	var relay *webhookRelay
+	if *relayConfigFile != "" {
+		relayConfig, err := loadRelayConfig(*relayConfigFile)
+		if err != nil {
+			panic(err)
+		}
+		relay = newWebhookRelay(relayConfig, newDeadLetterStore(*deadLetterFile))
+	}
+
+	if flag.Arg(0) == "redrive" {
+		redriveDeadLetters(relay, flag.Args()[1:])
+		return
+	}
+
 	clientConnection := newGrpcConnection()
 	defer clientConnection.Close()
 
@@ -51,38 +84,136 @@ func main() {
 	network := gateway.GetNetwork(channelName)
 	contract := network.GetContract(chaincodeName)
 
-	// Context used for event listening
-	ctx, cancel := context.WithCancel(context.Background())
+	// Context used for event listening, cancelled on interrupt to shut down cleanly
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	// Listen for events emitted by subsequent transactions
-	startChaincodeEventListening(ctx, network)
+	var startOptions []client.ChaincodeEventsOption
+	if *startBlock >= 0 {
+		startOptions = append(startOptions, client.WithStartBlock(uint64(*startBlock)))
+	}
 
-	firstBlockNumber := createAsset(contract)
-	updateAsset(contract)
-	transferAsset(contract)
-	deleteAsset(contract)
+	// Listen for events, resuming from each listener's checkpoint
+	var listeners sync.WaitGroup
+	for _, name := range strings.Split(*listenerNames, ",") {
+		name = strings.TrimSpace(name)
+		listener, err := newChaincodeEventListener(name, chaincodeName, *checkpointDir, printChaincodeEvent(name))
+		if err != nil {
+			panic(err)
+		}
+		startListener(ctx, &listeners, listener.name, func(ctx context.Context) error {
+			return listener.run(ctx, network, startOptions...)
+		}, listener.Close)
+	}
 
-	// Replay events from the block containing the first transaction
-	replayChaincodeEvents(ctx, network, firstBlockNumber)
-}
+	if relay != nil {
+		listener, err := newChaincodeEventListener("relay", chaincodeName, *checkpointDir, relay.handler(ctx))
+		if err != nil {
+			panic(err)
+		}
+		startListener(ctx, &listeners, listener.name, func(ctx context.Context) error {
+			return listener.run(ctx, network, startOptions...)
+		}, listener.Close)
+	}
+
+	if *blockListenerName != "" {
+		output := os.Stdout
+		if *blockOutput != "-" {
+			output, err = os.OpenFile(*blockOutput, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+			if err != nil {
+				panic(fmt.Errorf("failed to open block output file: %w", err))
+			}
+			defer output.Close()
+		}
 
-func startChaincodeEventListening(ctx context.Context, network *client.Network) {
-	fmt.Println("\n*** Start chaincode event listening")
+		listener, err := newBlockEventListener(*blockListenerName, *checkpointDir, writeJSONLines(output))
+		if err != nil {
+			panic(err)
+		}
 
-	events, err := network.ChaincodeEvents(ctx, chaincodeName)
-	if err != nil {
-		panic(fmt.Errorf("failed to start chaincode event listening: %w", err))
+		var blockOptions []client.BlockEventsOption
+		if *startBlock >= 0 {
+			blockOptions = append(blockOptions, client.WithStartBlock(uint64(*startBlock)))
+		}
+
+		startListener(ctx, &listeners, listener.name, func(ctx context.Context) error {
+			return listener.run(ctx, network, blockOptions...)
+		}, listener.Close)
 	}
 
+	if *simulate {
+		createAsset(contract)
+		updateAsset(contract)
+		transferAsset(contract)
+		deleteAsset(contract)
+	}
+
+	if *listen {
+		fmt.Println("\n*** Listening for chaincode events, press Ctrl+C to stop")
+		<-ctx.Done()
+	}
+
+	fmt.Println("\n*** Shutting down listeners")
+	cancel()
+	listeners.Wait()
+}
+
+// startListener runs a listener in the background until the context is cancelled, and then closes it.
+func startListener(ctx context.Context, wg *sync.WaitGroup, name string, run func(ctx context.Context) error, close func() error) {
+	wg.Add(1)
 	go func() {
-		for event := range events {
-			asset := formatJSON(event.Payload)
-			fmt.Printf("\n<-- Chaincode event received: %s - %s\n", event.EventName, asset)
+		defer wg.Done()
+		defer close()
+		if err := run(ctx); err != nil {
+			fmt.Printf("\n*** Listener %s failed: %v\n", name, err)
 		}
 	}()
 }
 
+// redriveDeadLetters re-attempts delivery of dead-lettered webhook events.
+func redriveDeadLetters(relay *webhookRelay, args []string) {
+	flags := flag.NewFlagSet("redrive", flag.ExitOnError)
+	subscriptionName := flags.String("subscription", "", "only redrive events for the named subscription")
+	flags.Parse(args)
+
+	if relay == nil {
+		panic(errors.New("redrive requires the -relay-config flag"))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	fmt.Println("\n*** Redriving dead-lettered events")
+	if err := relay.redrive(ctx, *subscriptionName); err != nil {
+		panic(fmt.Errorf("failed to redrive dead-lettered events: %w", err))
+	}
+}
+
+// printChaincodeEvent returns a handler that prints events received by the named listener.
+func printChaincodeEvent(listenerName string) chaincodeEventHandler {
+	return func(event *client.ChaincodeEvent) error {
+		envelope, err := assetevent.DecodeChaincodeEvent(event)
+		if err != nil {
+			// Skip events that cannot be processed rather than stalling the listener
+			fmt.Printf("\n*** Listener %s ignoring invalid %s event in transaction %s: %v\n", listenerName, event.EventName, event.TransactionID, err)
+			return nil
+		}
+
+		if envelope.SchemaVersion == assetevent.LegacySchemaVersion {
+			// Legacy events do not record who invoked the transaction, or when
+			fmt.Printf("\n<-- Chaincode event received by %s (block %d, transaction %s): %s - %s %s\n%s\n",
+				listenerName, event.BlockNumber, event.TransactionID, event.EventName, envelope.EventType, envelope.AssetID,
+				formatJSON(event.Payload))
+			return nil
+		}
+
+		fmt.Printf("\n<-- Chaincode event received by %s (block %d, transaction %s): %s - %s %s by %s at %s\n%s\n",
+			listenerName, event.BlockNumber, event.TransactionID, event.EventName, envelope.EventType, envelope.AssetID,
+			envelope.InvokingMSP, envelope.Timestamp.Format(time.RFC3339), formatJSON(event.Payload))
+		return nil
+	}
+}
+
 func formatJSON(data []byte) string {
 	var result bytes.Buffer
 	if err := json.Indent(&result, data, "", "  "); err != nil {
@@ -91,7 +222,7 @@ func formatJSON(data []byte) string {
 	return result.String()
 }
 
-func createAsset(contract *client.Contract) uint64 {
+func createAsset(contract *client.Contract) {
 	fmt.Printf("\n--> Submit transaction: CreateAsset, %s owned by Sam with appraised value 100\n", assetID)
 
 	_, commit, err := contract.SubmitAsync("CreateAsset", client.WithArguments(assetID, "blue", "10", "Sam", "100"))
@@ -109,8 +240,6 @@ func createAsset(contract *client.Contract) uint64 {
 	}
 
 	fmt.Println("\n*** CreateAsset committed successfully")
-
-	return status.BlockNumber
 }
 
 func updateAsset(contract *client.Contract) {
@@ -145,28 +274,3 @@ func deleteAsset(contract *client.Contract) {
 
 	fmt.Println("\n*** DeleteAsset committed successfully")
 }
-
-func replayChaincodeEvents(ctx context.Context, network *client.Network, startBlock uint64) {
-	fmt.Println("\n*** Start chaincode event replay")
-
-	events, err := network.ChaincodeEvents(ctx, chaincodeName, client.WithStartBlock(startBlock))
-	if err != nil {
-		panic(fmt.Errorf("failed to start chaincode event listening: %w", err))
-	}
-
-	for {
-		select {
-		case <-time.After(10 * time.Second):
-			panic(errors.New("timeout waiting for event replay"))
-
-		case event := <-events:
-			asset := formatJSON(event.Payload)
-			fmt.Printf("\n<-- Chaincode event replayed: %s - %s\n", event.EventName, asset)
-
-			if event.EventName == "DeleteAsset" {
-				// Reached the last submitted transaction so return to stop listening for events
-				return
-			}
-		}
-	}
-}
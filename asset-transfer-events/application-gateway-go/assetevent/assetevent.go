@@ -0,0 +1,227 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package assetevent decodes and validates the versioned asset event envelopes emitted as chaincode event payloads
+// by the asset-transfer-events Go smart contract. The Java and JavaScript smart contracts emit the plain asset as the
+// payload; these legacy events are decoded into envelopes with schema version LegacySchemaVersion.
+package assetevent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// SchemaVersion is the envelope schema version understood by this package.
+const SchemaVersion = 1
+
+// LegacySchemaVersion is the schema version of envelopes decoded from legacy events, whose payload is the plain asset.
+const LegacySchemaVersion = 0
+
+// Event types recorded in envelopes.
+const (
+	TypeAssetCreated     = "AssetCreated"
+	TypeAssetUpdated     = "AssetUpdated"
+	TypeAssetTransferred = "AssetTransferred"
+	TypeAssetDeleted     = "AssetDeleted"
+)
+
+// legacyEventTypes are the event types of legacy events, by chaincode event name.
+var legacyEventTypes = map[string]string{
+	"CreateAsset":   TypeAssetCreated,
+	"UpdateAsset":   TypeAssetUpdated,
+	"TransferAsset": TypeAssetTransferred,
+	"DeleteAsset":   TypeAssetDeleted,
+}
+
+// Asset is the state of an asset recorded in an envelope.
+type Asset struct {
+	AppraisedValue int    `json:"AppraisedValue"`
+	Color          string `json:"Color"`
+	ID             string `json:"ID"`
+	Owner          string `json:"Owner"`
+	Size           int    `json:"Size"`
+}
+
+// Envelope is a decoded asset event. PreviousState is nil for created assets, and NewState is nil for deleted assets.
+// Envelopes decoded from legacy events have no timestamp, invoking MSP ID or, for updated and transferred assets,
+// previous state.
+type Envelope struct {
+	SchemaVersion int       `json:"schemaVersion"`
+	EventType     string    `json:"eventType"`
+	AssetID       string    `json:"assetId"`
+	TransactionID string    `json:"transactionId"`
+	Timestamp     time.Time `json:"timestamp"`
+	InvokingMSP   string    `json:"invokingMsp"`
+	PreviousState *Asset    `json:"previousState,omitempty"`
+	NewState      *Asset    `json:"newState,omitempty"`
+}
+
+// legacyAsset is the payload of a legacy event. Numbers may be encoded as strings.
+type legacyAsset struct {
+	AppraisedValue legacyInt `json:"AppraisedValue"`
+	Color          string    `json:"Color"`
+	ID             string    `json:"ID"`
+	Owner          string    `json:"Owner"`
+	Size           legacyInt `json:"Size"`
+}
+
+// legacyInt is an integer encoded as either a JSON number or a string.
+type legacyInt int
+
+func (value *legacyInt) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if unquoted, err := strconv.Unquote(text); err == nil {
+		text = unquoted
+	}
+
+	result, err := strconv.Atoi(text)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+
+	*value = legacyInt(result)
+	return nil
+}
+
+// Decode parses and validates an envelope from a chaincode event payload. Legacy events are decoded using the
+// chaincode event name, so must be decoded with DecodeChaincodeEvent.
+func Decode(payload []byte) (*Envelope, error) {
+	envelope := &Envelope{}
+	if err := json.Unmarshal(payload, envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse asset event envelope: %w", err)
+	}
+
+	if err := envelope.Validate(); err != nil {
+		return nil, err
+	}
+
+	return envelope, nil
+}
+
+// DecodeChaincodeEvent parses and validates the envelope in a chaincode event payload, and checks that the envelope
+// was emitted by the transaction that delivered the event. A legacy event, whose payload is the plain asset, is
+// decoded into an envelope with the event type of the chaincode event name and the event transaction ID.
+func DecodeChaincodeEvent(event *client.ChaincodeEvent) (*Envelope, error) {
+	legacy, err := isLegacyPayload(event.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		return decodeLegacyEvent(event)
+	}
+
+	envelope, err := Decode(event.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if envelope.TransactionID != event.TransactionID {
+		return nil, fmt.Errorf("envelope transaction ID %s does not match event transaction ID %s", envelope.TransactionID, event.TransactionID)
+	}
+
+	return envelope, nil
+}
+
+// isLegacyPayload returns true if a chaincode event payload is a plain asset rather than an envelope.
+func isLegacyPayload(payload []byte) (bool, error) {
+	var version struct {
+		SchemaVersion *int `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(payload, &version); err != nil {
+		return false, fmt.Errorf("failed to parse asset event envelope: %w", err)
+	}
+	return version.SchemaVersion == nil, nil
+}
+
+// decodeLegacyEvent decodes and validates the plain asset payload of a legacy event as an envelope.
+func decodeLegacyEvent(event *client.ChaincodeEvent) (*Envelope, error) {
+	eventType, ok := legacyEventTypes[event.EventName]
+	if !ok {
+		return nil, fmt.Errorf("unknown legacy asset event %q", event.EventName)
+	}
+
+	var payload legacyAsset
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return nil, fmt.Errorf("failed to parse legacy asset event: %w", err)
+	}
+
+	asset := &Asset{
+		AppraisedValue: int(payload.AppraisedValue),
+		Color:          payload.Color,
+		ID:             payload.ID,
+		Owner:          payload.Owner,
+		Size:           int(payload.Size),
+	}
+	envelope := &Envelope{
+		SchemaVersion: LegacySchemaVersion,
+		EventType:     eventType,
+		AssetID:       asset.ID,
+		TransactionID: event.TransactionID,
+	}
+	if eventType == TypeAssetDeleted {
+		envelope.PreviousState = asset
+	} else {
+		envelope.NewState = asset
+	}
+
+	if err := envelope.Validate(); err != nil {
+		return nil, err
+	}
+
+	return envelope, nil
+}
+
+// Validate checks that the envelope has a supported schema version, and that its content is consistent with its
+// event type. Envelopes decoded from legacy events need not have an invoking MSP ID, or a previous state for
+// updated and transferred assets.
+func (envelope *Envelope) Validate() error {
+	legacy := envelope.SchemaVersion == LegacySchemaVersion
+	if envelope.SchemaVersion != SchemaVersion && !legacy {
+		return fmt.Errorf("unsupported asset event schema version %d", envelope.SchemaVersion)
+	}
+	if envelope.AssetID == "" {
+		return errors.New("asset event has no asset ID")
+	}
+	if envelope.TransactionID == "" {
+		return errors.New("asset event has no transaction ID")
+	}
+	if envelope.InvokingMSP == "" && !legacy {
+		return errors.New("asset event has no invoking MSP ID")
+	}
+
+	switch envelope.EventType {
+	case TypeAssetCreated:
+		if envelope.PreviousState != nil || envelope.NewState == nil {
+			return fmt.Errorf("%s event must have only a new state", envelope.EventType)
+		}
+	case TypeAssetUpdated, TypeAssetTransferred:
+		if legacy && envelope.NewState == nil {
+			return fmt.Errorf("%s event must have a new state", envelope.EventType)
+		}
+		if !legacy && (envelope.PreviousState == nil || envelope.NewState == nil) {
+			return fmt.Errorf("%s event must have previous and new states", envelope.EventType)
+		}
+	case TypeAssetDeleted:
+		if envelope.PreviousState == nil || envelope.NewState != nil {
+			return fmt.Errorf("%s event must have only a previous state", envelope.EventType)
+		}
+	default:
+		return fmt.Errorf("unknown asset event type %q", envelope.EventType)
+	}
+
+	for _, state := range []*Asset{envelope.PreviousState, envelope.NewState} {
+		if state != nil && state.ID != envelope.AssetID {
+			return fmt.Errorf("asset state ID %s does not match asset event ID %s", state.ID, envelope.AssetID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package assetevent
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+const transferredEnvelope = `{
+	"assetId": "asset1",
+	"eventType": "AssetTransferred",
+	"invokingMsp": "Org1MSP",
+	"newState": {"AppraisedValue": 100, "Color": "blue", "ID": "asset1", "Owner": "Mary", "Size": 10},
+	"previousState": {"AppraisedValue": 100, "Color": "blue", "ID": "asset1", "Owner": "Sam", "Size": 10},
+	"schemaVersion": 1,
+	"timestamp": "2024-01-02T03:04:05.000000006Z",
+	"transactionId": "tx1"
+}`
+
+func newChaincodeEvent(name string, transactionID string, payload string) *client.ChaincodeEvent {
+	return &client.ChaincodeEvent{
+		EventName:     name,
+		TransactionID: transactionID,
+		Payload:       []byte(payload),
+	}
+}
+
+func TestDecodeChaincodeEventEnvelope(t *testing.T) {
+	envelope, err := DecodeChaincodeEvent(newChaincodeEvent("TransferAsset", "tx1", transferredEnvelope))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if envelope.SchemaVersion != SchemaVersion || envelope.EventType != TypeAssetTransferred {
+		t.Errorf("unexpected schema version %d or event type %s", envelope.SchemaVersion, envelope.EventType)
+	}
+	if envelope.AssetID != "asset1" || envelope.TransactionID != "tx1" || envelope.InvokingMSP != "Org1MSP" {
+		t.Errorf("unexpected envelope %+v", envelope)
+	}
+	if !envelope.Timestamp.Equal(time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC)) {
+		t.Errorf("unexpected timestamp %v", envelope.Timestamp)
+	}
+	if envelope.PreviousState == nil || envelope.PreviousState.Owner != "Sam" {
+		t.Errorf("unexpected previous state %+v", envelope.PreviousState)
+	}
+	expected := Asset{AppraisedValue: 100, Color: "blue", ID: "asset1", Owner: "Mary", Size: 10}
+	if envelope.NewState == nil || *envelope.NewState != expected {
+		t.Errorf("expected new state %+v, got %+v", expected, envelope.NewState)
+	}
+}
+
+func TestDecodeChaincodeEventEnvelopeErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *client.ChaincodeEvent
+		message string
+	}{
+		{
+			name:    "transaction ID mismatch",
+			event:   newChaincodeEvent("TransferAsset", "tx2", transferredEnvelope),
+			message: "envelope transaction ID tx1 does not match event transaction ID tx2",
+		},
+		{
+			name:    "unsupported schema version",
+			event:   newChaincodeEvent("CreateAsset", "tx1", `{"schemaVersion":2,"eventType":"AssetCreated","assetId":"asset1","transactionId":"tx1","invokingMsp":"Org1MSP","newState":{"ID":"asset1"}}`),
+			message: "unsupported asset event schema version 2",
+		},
+		{
+			name:    "missing invoking MSP",
+			event:   newChaincodeEvent("CreateAsset", "tx1", `{"schemaVersion":1,"eventType":"AssetCreated","assetId":"asset1","transactionId":"tx1","newState":{"ID":"asset1"}}`),
+			message: "asset event has no invoking MSP ID",
+		},
+		{
+			name:    "transfer without previous state",
+			event:   newChaincodeEvent("TransferAsset", "tx1", `{"schemaVersion":1,"eventType":"AssetTransferred","assetId":"asset1","transactionId":"tx1","invokingMsp":"Org1MSP","newState":{"ID":"asset1"}}`),
+			message: "AssetTransferred event must have previous and new states",
+		},
+		{
+			name:    "state ID mismatch",
+			event:   newChaincodeEvent("DeleteAsset", "tx1", `{"schemaVersion":1,"eventType":"AssetDeleted","assetId":"asset1","transactionId":"tx1","invokingMsp":"Org1MSP","previousState":{"ID":"asset2"}}`),
+			message: "asset state ID asset2 does not match asset event ID asset1",
+		},
+		{
+			name:    "invalid JSON",
+			event:   newChaincodeEvent("CreateAsset", "tx1", `not json`),
+			message: "failed to parse asset event envelope",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeChaincodeEvent(test.event)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+}
+
+func TestDecodeChaincodeEventLegacy(t *testing.T) {
+	tests := []struct {
+		name          string
+		eventName     string
+		payload       string
+		eventType     string
+		previousState bool
+	}{
+		{
+			name:      "JavaScript created asset with string numbers",
+			eventName: "CreateAsset",
+			payload:   `{"ID":"asset1","Color":"blue","Size":"10","Owner":"Sam","AppraisedValue":"100"}`,
+			eventType: TypeAssetCreated,
+		},
+		{
+			name:      "Java transferred asset",
+			eventName: "TransferAsset",
+			payload:   `{"AppraisedValue":100,"Color":"blue","ID":"asset1","Owner":"Sam","Size":10}`,
+			eventType: TypeAssetTransferred,
+		},
+		{
+			name:          "deleted asset",
+			eventName:     "DeleteAsset",
+			payload:       `{"ID":"asset1","Color":"blue","Size":10,"Owner":"Sam","AppraisedValue":100}`,
+			eventType:     TypeAssetDeleted,
+			previousState: true,
+		},
+	}
+
+	expected := Asset{AppraisedValue: 100, Color: "blue", ID: "asset1", Owner: "Sam", Size: 10}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envelope, err := DecodeChaincodeEvent(newChaincodeEvent(test.eventName, "tx1", test.payload))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if envelope.SchemaVersion != LegacySchemaVersion || envelope.EventType != test.eventType {
+				t.Errorf("unexpected schema version %d or event type %s", envelope.SchemaVersion, envelope.EventType)
+			}
+			if envelope.AssetID != "asset1" || envelope.TransactionID != "tx1" {
+				t.Errorf("unexpected asset ID %s or transaction ID %s", envelope.AssetID, envelope.TransactionID)
+			}
+			if envelope.InvokingMSP != "" || !envelope.Timestamp.IsZero() {
+				t.Errorf("expected no invoking MSP ID or timestamp, got %q and %v", envelope.InvokingMSP, envelope.Timestamp)
+			}
+
+			state, otherState := envelope.NewState, envelope.PreviousState
+			if test.previousState {
+				state, otherState = envelope.PreviousState, envelope.NewState
+			}
+			if state == nil || *state != expected {
+				t.Errorf("expected state %+v, got %+v", expected, state)
+			}
+			if otherState != nil {
+				t.Errorf("expected only one state, got %+v", otherState)
+			}
+		})
+	}
+}
+
+func TestDecodeChaincodeEventLegacyErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		event   *client.ChaincodeEvent
+		message string
+	}{
+		{
+			name:    "unknown event name",
+			event:   newChaincodeEvent("ReadAsset", "tx1", `{"ID":"asset1"}`),
+			message: `unknown legacy asset event "ReadAsset"`,
+		},
+		{
+			name:    "invalid number",
+			event:   newChaincodeEvent("CreateAsset", "tx1", `{"ID":"asset1","Size":"large"}`),
+			message: "failed to parse legacy asset event",
+		},
+		{
+			name:    "missing asset ID",
+			event:   newChaincodeEvent("CreateAsset", "tx1", `{"Color":"blue"}`),
+			message: "asset event has no asset ID",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeChaincodeEvent(test.event)
+			if err == nil || !strings.Contains(err.Error(), test.message) {
+				t.Errorf("expected error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+}
+
+func TestDecodeRequiresSchemaVersion(t *testing.T) {
+	envelope, err := Decode([]byte(transferredEnvelope))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if envelope.EventType != TypeAssetTransferred {
+		t.Errorf("unexpected event type %s", envelope.EventType)
+	}
+
+	_, err = Decode([]byte(`{"AppraisedValue":100,"Color":"blue","ID":"asset1","Owner":"Sam","Size":10}`))
+	if err == nil {
+		t.Error("expected error decoding a legacy payload without the chaincode event")
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// blockTransaction describes a transaction within a block, including the world state keys it read and wrote.
+// If the transaction could not be parsed, Error describes why, and only the block number, index and validation
+// code are set.
+type blockTransaction struct {
+	BlockNumber    uint64                  `json:"blockNumber"`
+	Index          int                     `json:"index"`
+	TransactionID  string                  `json:"transactionId"`
+	ChannelID      string                  `json:"channelId"`
+	Type           string                  `json:"type"`
+	Timestamp      time.Time               `json:"timestamp"`
+	Creator        transactionCreator      `json:"creator"`
+	ValidationCode string                  `json:"validationCode"`
+	Valid          bool                    `json:"valid"`
+	Namespaces     []namespaceReadWriteSet `json:"namespaces,omitempty"`
+	Error          string                  `json:"error,omitempty"`
+}
+
+// transactionCreator identifies the client that created a transaction.
+type transactionCreator struct {
+	MSPID       string `json:"mspId"`
+	Certificate string `json:"certificate"`
+}
+
+// namespaceReadWriteSet contains the public world state keys read and written by a transaction within a chaincode
+// namespace. Private data collections are not included, since only hashes of their keys are present in blocks.
+type namespaceReadWriteSet struct {
+	Namespace string     `json:"namespace"`
+	Reads     []keyRead  `json:"reads,omitempty"`
+	Writes    []keyWrite `json:"writes,omitempty"`
+}
+
+// keyRead is a key read by a transaction. Version is nil if the key did not exist when it was read.
+type keyRead struct {
+	Key     string      `json:"key"`
+	Version *keyVersion `json:"version,omitempty"`
+}
+
+// keyVersion identifies the transaction that last wrote a key.
+type keyVersion struct {
+	BlockNumber       uint64 `json:"blockNumber"`
+	TransactionNumber uint64 `json:"transactionNumber"`
+}
+
+// keyWrite is a key written or deleted by a transaction.
+type keyWrite struct {
+	Key      string `json:"key"`
+	IsDelete bool   `json:"isDelete,omitempty"`
+	Value    []byte `json:"value,omitempty"`
+}
+
+// parseBlock extracts the transactions contained in a block. A transaction that cannot be parsed is returned with
+// its Error set, so that the remaining transactions of the block can still be processed.
+func parseBlock(block *common.Block) []*blockTransaction {
+	validationCodes := transactionValidationCodes(block)
+
+	var transactions []*blockTransaction
+	for i, envelopeBytes := range block.GetData().GetData() {
+		transaction, err := parseEnvelope(envelopeBytes)
+		if err != nil {
+			transaction = &blockTransaction{
+				Error: fmt.Sprintf("failed to parse transaction %d in block %d: %v", i, block.GetHeader().GetNumber(), err),
+			}
+		}
+
+		transaction.BlockNumber = block.GetHeader().GetNumber()
+		transaction.Index = i
+		code := peer.TxValidationCode_NOT_VALIDATED
+		if i < len(validationCodes) {
+			code = peer.TxValidationCode(validationCodes[i])
+		}
+		transaction.ValidationCode = code.String()
+		transaction.Valid = code == peer.TxValidationCode_VALID
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions
+}
+
+func transactionValidationCodes(block *common.Block) []byte {
+	metadata := block.GetMetadata().GetMetadata()
+	if len(metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		return nil
+	}
+	return metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER]
+}
+
+func parseEnvelope(envelopeBytes []byte) (*blockTransaction, error) {
+	envelope := &common.Envelope{}
+	if err := proto.Unmarshal(envelopeBytes, envelope); err != nil {
+		return nil, err
+	}
+
+	payload := &common.Payload{}
+	if err := proto.Unmarshal(envelope.GetPayload(), payload); err != nil {
+		return nil, err
+	}
+
+	channelHeader := &common.ChannelHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetChannelHeader(), channelHeader); err != nil {
+		return nil, err
+	}
+
+	signatureHeader := &common.SignatureHeader{}
+	if err := proto.Unmarshal(payload.GetHeader().GetSignatureHeader(), signatureHeader); err != nil {
+		return nil, err
+	}
+
+	creator := &msp.SerializedIdentity{}
+	if err := proto.Unmarshal(signatureHeader.GetCreator(), creator); err != nil {
+		return nil, err
+	}
+
+	transaction := &blockTransaction{
+		TransactionID: channelHeader.GetTxId(),
+		ChannelID:     channelHeader.GetChannelId(),
+		Type:          common.HeaderType(channelHeader.GetType()).String(),
+		Timestamp:     channelHeader.GetTimestamp().AsTime(),
+		Creator: transactionCreator{
+			MSPID:       creator.GetMspid(),
+			Certificate: string(creator.GetIdBytes()),
+		},
+	}
+
+	if common.HeaderType(channelHeader.GetType()) != common.HeaderType_ENDORSER_TRANSACTION {
+		return transaction, nil
+	}
+
+	namespaces, err := parseEndorserTransaction(payload.GetData())
+	if err != nil {
+		return nil, err
+	}
+	transaction.Namespaces = namespaces
+
+	return transaction, nil
+}
+
+func parseEndorserTransaction(transactionBytes []byte) ([]namespaceReadWriteSet, error) {
+	transaction := &peer.Transaction{}
+	if err := proto.Unmarshal(transactionBytes, transaction); err != nil {
+		return nil, err
+	}
+
+	var namespaces []namespaceReadWriteSet
+	for _, action := range transaction.GetActions() {
+		actionPayload := &peer.ChaincodeActionPayload{}
+		if err := proto.Unmarshal(action.GetPayload(), actionPayload); err != nil {
+			return nil, err
+		}
+
+		responsePayload := &peer.ProposalResponsePayload{}
+		if err := proto.Unmarshal(actionPayload.GetAction().GetProposalResponsePayload(), responsePayload); err != nil {
+			return nil, err
+		}
+
+		chaincodeAction := &peer.ChaincodeAction{}
+		if err := proto.Unmarshal(responsePayload.GetExtension(), chaincodeAction); err != nil {
+			return nil, err
+		}
+
+		readWriteSet := &rwset.TxReadWriteSet{}
+		if err := proto.Unmarshal(chaincodeAction.GetResults(), readWriteSet); err != nil {
+			return nil, err
+		}
+
+		for _, nsReadWriteSet := range readWriteSet.GetNsRwset() {
+			namespace, err := parseNamespaceReadWriteSet(nsReadWriteSet)
+			if err != nil {
+				return nil, err
+			}
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	return namespaces, nil
+}
+
+func parseNamespaceReadWriteSet(nsReadWriteSet *rwset.NsReadWriteSet) (namespaceReadWriteSet, error) {
+	kvReadWriteSet := &kvrwset.KVRWSet{}
+	if err := proto.Unmarshal(nsReadWriteSet.GetRwset(), kvReadWriteSet); err != nil {
+		return namespaceReadWriteSet{}, err
+	}
+
+	namespace := namespaceReadWriteSet{
+		Namespace: nsReadWriteSet.GetNamespace(),
+	}
+
+	for _, read := range kvReadWriteSet.GetReads() {
+		result := keyRead{Key: read.GetKey()}
+		if version := read.GetVersion(); version != nil {
+			result.Version = &keyVersion{
+				BlockNumber:       version.GetBlockNum(),
+				TransactionNumber: version.GetTxNum(),
+			}
+		}
+		namespace.Reads = append(namespace.Reads, result)
+	}
+
+	for _, write := range kvReadWriteSet.GetWrites() {
+		namespace.Writes = append(namespace.Writes, keyWrite{
+			Key:      write.GetKey(),
+			IsDelete: write.GetIsDelete(),
+			Value:    write.GetValue(),
+		})
+	}
+
+	return namespace, nil
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var testTimestamp = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func marshal(t *testing.T, message proto.Message) []byte {
+	t.Helper()
+	result, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatalf("failed to marshal %T: %v", message, err)
+	}
+	return result
+}
+
+func newEnvelope(t *testing.T, headerType common.HeaderType, transactionID string, data []byte) []byte {
+	t.Helper()
+	channelHeader := &common.ChannelHeader{
+		Type:      int32(headerType),
+		ChannelId: "mychannel",
+		TxId:      transactionID,
+		Timestamp: timestamppb.New(testTimestamp),
+	}
+	signatureHeader := &common.SignatureHeader{
+		Creator: marshal(t, &msp.SerializedIdentity{
+			Mspid:   "Org1MSP",
+			IdBytes: []byte("CERTIFICATE"),
+		}),
+	}
+	payload := &common.Payload{
+		Header: &common.Header{
+			ChannelHeader:   marshal(t, channelHeader),
+			SignatureHeader: marshal(t, signatureHeader),
+		},
+		Data: data,
+	}
+
+	return marshal(t, &common.Envelope{Payload: marshal(t, payload)})
+}
+
+func newEndorserTransaction(t *testing.T, namespace string, readWriteSet *kvrwset.KVRWSet) []byte {
+	t.Helper()
+	txReadWriteSet := &rwset.TxReadWriteSet{
+		DataModel: rwset.TxReadWriteSet_KV,
+		NsRwset: []*rwset.NsReadWriteSet{
+			{
+				Namespace: namespace,
+				Rwset:     marshal(t, readWriteSet),
+			},
+		},
+	}
+	responsePayload := &peer.ProposalResponsePayload{
+		Extension: marshal(t, &peer.ChaincodeAction{Results: marshal(t, txReadWriteSet)}),
+	}
+	actionPayload := &peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{
+			ProposalResponsePayload: marshal(t, responsePayload),
+		},
+	}
+	transaction := &peer.Transaction{
+		Actions: []*peer.TransactionAction{
+			{Payload: marshal(t, actionPayload)},
+		},
+	}
+
+	return marshal(t, transaction)
+}
+
+func newBlock(number uint64, validationCodes []peer.TxValidationCode, envelopes ...[]byte) *common.Block {
+	metadata := make([][]byte, len(common.BlockMetadataIndex_name))
+	if validationCodes != nil {
+		filter := make([]byte, len(validationCodes))
+		for i, code := range validationCodes {
+			filter[i] = byte(code)
+		}
+		metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = filter
+	}
+
+	return &common.Block{
+		Header:   &common.BlockHeader{Number: number},
+		Data:     &common.BlockData{Data: envelopes},
+		Metadata: &common.BlockMetadata{Metadata: metadata},
+	}
+}
+
+func TestParseBlockEndorserTransaction(t *testing.T) {
+	readWriteSet := &kvrwset.KVRWSet{
+		Reads: []*kvrwset.KVRead{
+			{Key: "asset1", Version: &kvrwset.Version{BlockNum: 3, TxNum: 1}},
+			{Key: "asset2"},
+		},
+		Writes: []*kvrwset.KVWrite{
+			{Key: "asset1", Value: []byte(`{"ID":"asset1"}`)},
+			{Key: "asset2", IsDelete: true},
+		},
+	}
+	envelope := newEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, "tx1", newEndorserTransaction(t, "events", readWriteSet))
+	block := newBlock(7, []peer.TxValidationCode{peer.TxValidationCode_VALID}, envelope)
+
+	transactions := parseBlock(block)
+
+	if len(transactions) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(transactions))
+	}
+	transaction := transactions[0]
+	if transaction.Error != "" {
+		t.Fatalf("unexpected error: %s", transaction.Error)
+	}
+	if transaction.BlockNumber != 7 || transaction.Index != 0 {
+		t.Errorf("expected block 7 index 0, got block %d index %d", transaction.BlockNumber, transaction.Index)
+	}
+	if transaction.TransactionID != "tx1" || transaction.ChannelID != "mychannel" {
+		t.Errorf("unexpected transaction ID %q or channel %q", transaction.TransactionID, transaction.ChannelID)
+	}
+	if transaction.Type != "ENDORSER_TRANSACTION" {
+		t.Errorf("unexpected type %q", transaction.Type)
+	}
+	if !transaction.Timestamp.Equal(testTimestamp) {
+		t.Errorf("unexpected timestamp %v", transaction.Timestamp)
+	}
+	if transaction.Creator.MSPID != "Org1MSP" || transaction.Creator.Certificate != "CERTIFICATE" {
+		t.Errorf("unexpected creator %+v", transaction.Creator)
+	}
+	if !transaction.Valid || transaction.ValidationCode != "VALID" {
+		t.Errorf("expected valid transaction, got %s", transaction.ValidationCode)
+	}
+
+	if len(transaction.Namespaces) != 1 {
+		t.Fatalf("expected 1 namespace, got %d", len(transaction.Namespaces))
+	}
+	namespace := transaction.Namespaces[0]
+	if namespace.Namespace != "events" {
+		t.Errorf("unexpected namespace %q", namespace.Namespace)
+	}
+	if len(namespace.Reads) != 2 {
+		t.Fatalf("expected 2 reads, got %d", len(namespace.Reads))
+	}
+	if version := namespace.Reads[0].Version; version == nil || version.BlockNumber != 3 || version.TransactionNumber != 1 {
+		t.Errorf("unexpected version %+v for read of existing key", version)
+	}
+	if namespace.Reads[1].Version != nil {
+		t.Errorf("expected no version for read of missing key, got %+v", namespace.Reads[1].Version)
+	}
+	if len(namespace.Writes) != 2 {
+		t.Fatalf("expected 2 writes, got %d", len(namespace.Writes))
+	}
+	if namespace.Writes[0].IsDelete || !bytes.Equal(namespace.Writes[0].Value, []byte(`{"ID":"asset1"}`)) {
+		t.Errorf("unexpected write %+v", namespace.Writes[0])
+	}
+	if !namespace.Writes[1].IsDelete {
+		t.Errorf("expected delete of asset2, got %+v", namespace.Writes[1])
+	}
+}
+
+func TestParseBlockValidationCodes(t *testing.T) {
+	emptyTransaction := newEndorserTransaction(t, "events", &kvrwset.KVRWSet{})
+	block := newBlock(1, []peer.TxValidationCode{peer.TxValidationCode_VALID, peer.TxValidationCode_MVCC_READ_CONFLICT},
+		newEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, "tx1", emptyTransaction),
+		newEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, "tx2", emptyTransaction),
+		newEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, "tx3", emptyTransaction),
+	)
+
+	transactions := parseBlock(block)
+
+	expected := []string{"VALID", "MVCC_READ_CONFLICT", "NOT_VALIDATED"}
+	if len(transactions) != len(expected) {
+		t.Fatalf("expected %d transactions, got %d", len(expected), len(transactions))
+	}
+	for i, code := range expected {
+		if transactions[i].ValidationCode != code {
+			t.Errorf("transaction %d: expected %s, got %s", i, code, transactions[i].ValidationCode)
+		}
+		if transactions[i].Valid != (code == "VALID") {
+			t.Errorf("transaction %d: unexpected valid %t for %s", i, transactions[i].Valid, code)
+		}
+	}
+}
+
+func TestParseBlockConfigTransaction(t *testing.T) {
+	block := newBlock(0, []peer.TxValidationCode{peer.TxValidationCode_VALID},
+		newEnvelope(t, common.HeaderType_CONFIG, "", []byte("config")))
+
+	transactions := parseBlock(block)
+
+	if len(transactions) != 1 {
+		t.Fatalf("expected 1 transaction, got %d", len(transactions))
+	}
+	if transactions[0].Error != "" {
+		t.Fatalf("unexpected error: %s", transactions[0].Error)
+	}
+	if transactions[0].Type != "CONFIG" {
+		t.Errorf("unexpected type %q", transactions[0].Type)
+	}
+	if transactions[0].Namespaces != nil {
+		t.Errorf("expected no namespaces, got %+v", transactions[0].Namespaces)
+	}
+}
+
+func TestParseBlockSkipsUnparsableTransaction(t *testing.T) {
+	block := newBlock(5, []peer.TxValidationCode{peer.TxValidationCode_BAD_PAYLOAD, peer.TxValidationCode_VALID},
+		[]byte("not an envelope"),
+		newEnvelope(t, common.HeaderType_ENDORSER_TRANSACTION, "tx2", newEndorserTransaction(t, "events", &kvrwset.KVRWSet{})),
+	)
+
+	transactions := parseBlock(block)
+
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 transactions, got %d", len(transactions))
+	}
+	failed := transactions[0]
+	if !strings.Contains(failed.Error, "failed to parse transaction 0 in block 5") {
+		t.Errorf("unexpected error %q", failed.Error)
+	}
+	if failed.BlockNumber != 5 || failed.Index != 0 || failed.ValidationCode != "BAD_PAYLOAD" || failed.Valid {
+		t.Errorf("unexpected unparsable transaction %+v", failed)
+	}
+	if transactions[1].Error != "" || transactions[1].TransactionID != "tx2" || transactions[1].Index != 1 {
+		t.Errorf("unexpected transaction after unparsable transaction %+v", transactions[1])
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// blockHandler processes the transactions in a block. The block is checkpointed only if the handler returns nil.
+type blockHandler func(transactions []*blockTransaction) error
+
+// blockEventListener is a named block event listener that records its progress in a checkpoint file, so listening
+// resumes at the next unprocessed block after a restart.
+type blockEventListener struct {
+	name         string
+	checkpointer *client.FileCheckpointer
+	handler      blockHandler
+}
+
+// newBlockEventListener creates a listener whose checkpoint is stored in <checkpointDir>/<name>.json.
+func newBlockEventListener(name string, checkpointDir string, handler blockHandler) (*blockEventListener, error) {
+	checkpointer, err := newListenerCheckpointer(name, checkpointDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockEventListener{
+		name:         name,
+		checkpointer: checkpointer,
+		handler:      handler,
+	}, nil
+}
+
+// run listens for block events until the context is cancelled, reconnecting with backoff if the event stream fails.
+// Blocks are read from the checkpoint position or, if there is no checkpoint yet, from the position given by the
+// supplied options.
+func (listener *blockEventListener) run(ctx context.Context, network *client.Network, options ...client.BlockEventsOption) error {
+	return runWithReconnect(ctx, listener.name, listener.checkpointer, func(ctx context.Context) error {
+		return listener.listen(ctx, network, options)
+	})
+}
+
+func (listener *blockEventListener) listen(ctx context.Context, network *client.Network, options []client.BlockEventsOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	options = append(options[:len(options):len(options)], client.WithCheckpoint(listener.checkpointer))
+	blocks, err := network.BlockEvents(ctx, options...)
+	if err != nil {
+		return fmt.Errorf("failed to start block event listening: %w", err)
+	}
+
+	for block := range blocks {
+		transactions := parseBlock(block)
+		for _, transaction := range transactions {
+			if transaction.Error != "" {
+				fmt.Printf("\n*** Listener %s unable to parse transaction: %s\n", listener.name, transaction.Error)
+			}
+		}
+
+		if err := listener.handler(transactions); err != nil {
+			return fmt.Errorf("failed to process block %d: %w", block.GetHeader().GetNumber(), err)
+		}
+
+		if err := listener.checkpointer.CheckpointBlock(block.GetHeader().GetNumber()); err != nil {
+			return fmt.Errorf("failed to checkpoint block: %w", err)
+		}
+		if err := syncCheckpoint(listener.checkpointer); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("event stream closed")
+}
+
+// Close releases the listener's checkpoint file.
+func (listener *blockEventListener) Close() error {
+	return listener.checkpointer.Close()
+}
+
+// writeJSONLines returns a handler that writes each transaction to the writer as a line of JSON.
+func writeJSONLines(writer io.Writer) blockHandler {
+	encoder := json.NewEncoder(writer)
+	return func(transactions []*blockTransaction) error {
+		for _, transaction := range transactions {
+			if err := encoder.Encode(transaction); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
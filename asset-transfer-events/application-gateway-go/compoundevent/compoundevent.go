@@ -0,0 +1,84 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package compoundevent splits compound chaincode events back into the individual logical events that a
+// transaction recorded. Since Fabric keeps only one chaincode event per transaction, smart contracts that update
+// several assets in one transaction emit their events together as a single event named CompoundEvent.
+package compoundevent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// EventName is the chaincode event name used for compound events.
+const EventName = "CompoundEvent"
+
+type batchedEvent struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type compoundEvent struct {
+	Events []batchedEvent `json:"events"`
+}
+
+// Event is an individual logical event recorded by a transaction.
+type Event struct {
+	*client.ChaincodeEvent
+	// Index is the position of the event within the transaction's events.
+	Index int
+}
+
+// Split returns the individual events contained in a chaincode event. Each returned event has the block number,
+// transaction ID and chaincode name of the compound event. A chaincode event that is not a compound event is
+// returned as the only element.
+func Split(event *client.ChaincodeEvent) ([]*Event, error) {
+	if event.EventName != EventName {
+		return []*Event{{ChaincodeEvent: event}}, nil
+	}
+
+	var compound compoundEvent
+	if err := json.Unmarshal(event.Payload, &compound); err != nil {
+		return nil, fmt.Errorf("failed to parse compound event in transaction %s: %w", event.TransactionID, err)
+	}
+
+	events := make([]*Event, 0, len(compound.Events))
+	for i, batched := range compound.Events {
+		if batched.Name == "" {
+			return nil, fmt.Errorf("compound event in transaction %s contains an unnamed event at index %d", event.TransactionID, i)
+		}
+
+		events = append(events, &Event{
+			ChaincodeEvent: &client.ChaincodeEvent{
+				BlockNumber:   event.BlockNumber,
+				TransactionID: event.TransactionID,
+				ChaincodeName: event.ChaincodeName,
+				EventName:     batched.Name,
+				Payload:       batched.Payload,
+			},
+			Index: i,
+		})
+	}
+
+	return events, nil
+}
+
+// Decode unmarshals the JSON payload of an individual event into a value of type T.
+func Decode[T any](event *Event) (*T, error) {
+	if event == nil {
+		return nil, errors.New("no event to decode")
+	}
+
+	value := new(T)
+	if err := json.Unmarshal(event.Payload, value); err != nil {
+		return nil, fmt.Errorf("failed to parse %s event payload: %w", event.EventName, err)
+	}
+	return value, nil
+}
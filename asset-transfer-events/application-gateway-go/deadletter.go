@@ -0,0 +1,167 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+// deadLetter is a chaincode event that could not be delivered to a subscription.
+type deadLetter struct {
+	Subscription  string    `json:"subscription"`
+	ChaincodeName string    `json:"chaincodeName"`
+	EventName     string    `json:"eventName"`
+	TransactionID string    `json:"transactionId"`
+	BlockNumber   uint64    `json:"blockNumber"`
+	Payload       []byte    `json:"payload"`
+	Error         string    `json:"error"`
+	FailedAt      time.Time `json:"failedAt"`
+}
+
+func newDeadLetter(subscriptionName string, event *client.ChaincodeEvent, err error) *deadLetter {
+	return &deadLetter{
+		Subscription:  subscriptionName,
+		ChaincodeName: event.ChaincodeName,
+		EventName:     event.EventName,
+		TransactionID: event.TransactionID,
+		BlockNumber:   event.BlockNumber,
+		Payload:       event.Payload,
+		Error:         err.Error(),
+		FailedAt:      time.Now().UTC(),
+	}
+}
+
+func (letter *deadLetter) chaincodeEvent() *client.ChaincodeEvent {
+	return &client.ChaincodeEvent{
+		BlockNumber:   letter.BlockNumber,
+		TransactionID: letter.TransactionID,
+		ChaincodeName: letter.ChaincodeName,
+		EventName:     letter.EventName,
+		Payload:       letter.Payload,
+	}
+}
+
+// deadLetterStore is a local file of undeliverable events, stored as JSON lines.
+type deadLetterStore struct {
+	fileName string
+	lock     sync.Mutex
+}
+
+func newDeadLetterStore(fileName string) *deadLetterStore {
+	return &deadLetterStore{fileName: fileName}
+}
+
+// add appends a dead letter to the store and syncs it to stable storage.
+func (store *deadLetterStore) add(letter *deadLetter) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(store.fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write dead letter: %w", err)
+	}
+	return file.Sync()
+}
+
+// drain calls remove for each stored dead letter, in the order they were added, and rewrites the store without
+// the dead letters for which remove returned true.
+func (store *deadLetterStore) drain(remove func(letter *deadLetter) bool) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	letters, err := store.read()
+	if err != nil {
+		return err
+	}
+
+	var remaining []*deadLetter
+	for _, letter := range letters {
+		if !remove(letter) {
+			remaining = append(remaining, letter)
+		}
+	}
+
+	return store.write(remaining)
+}
+
+func (store *deadLetterStore) read() ([]*deadLetter, error) {
+	file, err := os.Open(store.fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	defer file.Close()
+
+	var letters []*deadLetter
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		letter := &deadLetter{}
+		if err := json.Unmarshal(scanner.Bytes(), letter); err != nil {
+			return nil, fmt.Errorf("failed to parse dead letter: %w", err)
+		}
+		letters = append(letters, letter)
+	}
+
+	return letters, scanner.Err()
+}
+
+// write atomically replaces the store content with the given dead letters.
+func (store *deadLetterStore) write(letters []*deadLetter) error {
+	tempFileName := store.fileName + ".tmp"
+	file, err := os.OpenFile(tempFileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-letter file: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	for _, letter := range letters {
+		data, err := json.Marshal(letter)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.Write(append(data, '\n'))
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write dead-letter file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempFileName, store.fileName)
+}
@@ -0,0 +1,170 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"assetTransfer/compoundevent"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+const (
+	reconnectMinDelay = 1 * time.Second
+	reconnectMaxDelay = 30 * time.Second
+)
+
+var listenerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// chaincodeEventHandler processes a chaincode event. Compound events are split, and the handler is called for each
+// individual event they contain. The transaction is checkpointed only if the handler returns nil for all of them.
+type chaincodeEventHandler func(event *client.ChaincodeEvent) error
+
+// chaincodeEventListener is a named chaincode event listener that records its progress in a checkpoint file, so
+// listening resumes at the exact block and transaction where it stopped after a restart.
+type chaincodeEventListener struct {
+	name          string
+	chaincodeName string
+	checkpointer  *client.FileCheckpointer
+	handler       chaincodeEventHandler
+}
+
+// newChaincodeEventListener creates a listener whose checkpoint is stored in <checkpointDir>/<name>.json.
+func newChaincodeEventListener(name string, chaincodeName string, checkpointDir string, handler chaincodeEventHandler) (*chaincodeEventListener, error) {
+	checkpointer, err := newListenerCheckpointer(name, checkpointDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chaincodeEventListener{
+		name:          name,
+		chaincodeName: chaincodeName,
+		checkpointer:  checkpointer,
+		handler:       handler,
+	}, nil
+}
+
+// newListenerCheckpointer opens the checkpoint file for the named listener, stored in <checkpointDir>/<name>.json.
+func newListenerCheckpointer(name string, checkpointDir string) (*client.FileCheckpointer, error) {
+	if !listenerNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid listener name %q", name)
+	}
+
+	if err := os.MkdirAll(checkpointDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create checkpoint directory: %w", err)
+	}
+
+	checkpointer, err := client.NewFileCheckpointer(filepath.Join(checkpointDir, name+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoint for listener %s: %w", name, err)
+	}
+
+	return checkpointer, nil
+}
+
+// run listens for chaincode events until the context is cancelled, reconnecting with backoff if the event stream
+// fails. Events are read from the checkpoint position or, if there is no checkpoint yet, from the position given by
+// the supplied options.
+func (listener *chaincodeEventListener) run(ctx context.Context, network *client.Network, options ...client.ChaincodeEventsOption) error {
+	return runWithReconnect(ctx, listener.name, listener.checkpointer, func(ctx context.Context) error {
+		return listener.listen(ctx, network, options)
+	})
+}
+
+// runWithReconnect calls listen until the context is cancelled, waiting with exponential backoff between attempts.
+// The backoff is reset once a reconnected listener has processed events, so that a later disconnect is retried
+// promptly.
+func runWithReconnect(ctx context.Context, name string, checkpointer *client.FileCheckpointer, listen func(ctx context.Context) error) error {
+	fmt.Printf("\n*** Listener %s resuming at block %d after transaction %q\n",
+		name, checkpointer.BlockNumber(), checkpointer.TransactionID())
+
+	delay := reconnectMinDelay
+	for {
+		blockNumber, transactionID := checkpointer.BlockNumber(), checkpointer.TransactionID()
+		err := listen(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if checkpointer.BlockNumber() != blockNumber || checkpointer.TransactionID() != transactionID {
+			delay = reconnectMinDelay
+		}
+
+		fmt.Printf("\n*** Listener %s disconnected, reconnecting in %v: %v\n", name, delay, err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, reconnectMaxDelay)
+	}
+}
+
+func (listener *chaincodeEventListener) listen(ctx context.Context, network *client.Network, options []client.ChaincodeEventsOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	options = append(options[:len(options):len(options)], client.WithCheckpoint(listener.checkpointer))
+	events, err := network.ChaincodeEvents(ctx, listener.chaincodeName, options...)
+	if err != nil {
+		return fmt.Errorf("failed to start chaincode event listening: %w", err)
+	}
+
+	for event := range events {
+		if err := listener.handle(event); err != nil {
+			return fmt.Errorf("failed to process event in transaction %s: %w", event.TransactionID, err)
+		}
+
+		if err := listener.checkpoint(event); err != nil {
+			return err
+		}
+	}
+
+	return errors.New("event stream closed")
+}
+
+func (listener *chaincodeEventListener) handle(event *client.ChaincodeEvent) error {
+	individualEvents, err := compoundevent.Split(event)
+	if err != nil {
+		// Pass malformed compound events to the handler unchanged rather than stalling the listener
+		fmt.Printf("\n*** Listener %s unable to split compound event: %v\n", listener.name, err)
+		return listener.handler(event)
+	}
+
+	for _, individualEvent := range individualEvents {
+		if err := listener.handler(individualEvent.ChaincodeEvent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (listener *chaincodeEventListener) checkpoint(event *client.ChaincodeEvent) error {
+	if err := listener.checkpointer.CheckpointChaincodeEvent(event); err != nil {
+		return fmt.Errorf("failed to checkpoint event: %w", err)
+	}
+	return syncCheckpoint(listener.checkpointer)
+}
+
+func syncCheckpoint(checkpointer *client.FileCheckpointer) error {
+	if err := checkpointer.Sync(); err != nil {
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+	return nil
+}
+
+// Close releases the listener's checkpoint file.
+func (listener *chaincodeEventListener) Close() error {
+	return listener.checkpointer.Close()
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2022 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+)
+
+const (
+	signatureHeader     = "X-Fabric-Signature-256"
+	eventNameHeader     = "X-Fabric-Event-Name"
+	transactionIDHeader = "X-Fabric-Transaction-Id"
+	blockNumberHeader   = "X-Fabric-Block-Number"
+)
+
+// relayConfig is the webhook relay configuration file content.
+type relayConfig struct {
+	Subscriptions  []subscription `json:"subscriptions"`
+	MaxAttempts    int            `json:"maxAttempts"`
+	InitialBackoff duration       `json:"initialBackoff"`
+	MaxBackoff     duration       `json:"maxBackoff"`
+	RequestTimeout duration       `json:"requestTimeout"`
+}
+
+// subscription delivers chaincode events whose name matches EventPattern to a webhook URL. EventPattern uses the
+// syntax of path.Match, for example "*Asset" or "TransferAsset".
+type subscription struct {
+	Name         string `json:"name"`
+	EventPattern string `json:"eventPattern"`
+	URL          string `json:"url"`
+	Secret       string `json:"secret"`
+}
+
+// duration is a time.Duration read from a JSON string such as "1.5s".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	value, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = duration(value)
+	return nil
+}
+
+func loadRelayConfig(fileName string) (*relayConfig, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read relay configuration: %w", err)
+	}
+
+	config := &relayConfig{
+		MaxAttempts:    5,
+		InitialBackoff: duration(1 * time.Second),
+		MaxBackoff:     duration(1 * time.Minute),
+		RequestTimeout: duration(10 * time.Second),
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse relay configuration: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for _, sub := range config.Subscriptions {
+		if sub.Name == "" || sub.URL == "" {
+			return nil, errors.New("relay subscriptions require a name and URL")
+		}
+		if names[sub.Name] {
+			return nil, fmt.Errorf("duplicate relay subscription name %q", sub.Name)
+		}
+		names[sub.Name] = true
+
+		if _, err := path.Match(sub.EventPattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid event pattern for subscription %s: %w", sub.Name, err)
+		}
+	}
+	if config.MaxAttempts < 1 {
+		return nil, errors.New("maxAttempts must be at least 1")
+	}
+
+	return config, nil
+}
+
+// webhookRelay posts chaincode events to the webhooks of matching subscriptions. Events are processed one at a time,
+// so each subscription receives its events in ledger order. An event that cannot be delivered after the configured
+// number of attempts is written to the dead-letter store, and delivery continues with the next event. Delivery is
+// at-least-once: an event is delivered again if the application stops before its checkpoint is written, or if a
+// webhook accepts an event after its request has timed out.
+type webhookRelay struct {
+	config     *relayConfig
+	httpClient *http.Client
+	deadLetter *deadLetterStore
+}
+
+func newWebhookRelay(config *relayConfig, deadLetter *deadLetterStore) *webhookRelay {
+	return &webhookRelay{
+		config:     config,
+		httpClient: &http.Client{Timeout: time.Duration(config.RequestTimeout)},
+		deadLetter: deadLetter,
+	}
+}
+
+// handler returns a chaincode event handler that completes only once the event has been delivered to, or
+// dead-lettered for, every matching subscription. This allows the listener checkpoint to be advanced safely.
+func (relay *webhookRelay) handler(ctx context.Context) chaincodeEventHandler {
+	return func(event *client.ChaincodeEvent) error {
+		var wg sync.WaitGroup
+		errs := make([]error, len(relay.config.Subscriptions))
+
+		for i, sub := range relay.config.Subscriptions {
+			if matched, _ := path.Match(sub.EventPattern, event.EventName); !matched {
+				continue
+			}
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = relay.deliverOrDeadLetter(ctx, sub, event)
+			}()
+		}
+
+		wg.Wait()
+		return errors.Join(errs...)
+	}
+}
+
+func (relay *webhookRelay) deliverOrDeadLetter(ctx context.Context, sub subscription, event *client.ChaincodeEvent) error {
+	err := relay.deliverWithRetry(ctx, sub, event)
+	if err == nil {
+		fmt.Printf("\n--> Relayed %s event in transaction %s to %s\n", event.EventName, event.TransactionID, sub.Name)
+		return nil
+	}
+	if ctx.Err() != nil {
+		// Shutting down, so leave the event to be redelivered after restart
+		return err
+	}
+
+	fmt.Printf("\n*** Failed to relay %s event in transaction %s to %s: %v\n", event.EventName, event.TransactionID, sub.Name, err)
+	return relay.deadLetter.add(newDeadLetter(sub.Name, event, err))
+}
+
+// deliverWithRetry attempts delivery, retrying with exponential backoff between attempts.
+func (relay *webhookRelay) deliverWithRetry(ctx context.Context, sub subscription, event *client.ChaincodeEvent) error {
+	backoff := time.Duration(relay.config.InitialBackoff)
+
+	var err error
+	for attempt := 1; attempt <= relay.config.MaxAttempts; attempt++ {
+		if err = relay.deliver(ctx, sub, event); err == nil {
+			return nil
+		}
+		if attempt == relay.config.MaxAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Duration(relay.config.MaxBackoff))
+	}
+
+	return fmt.Errorf("delivery failed after %d attempts: %w", relay.config.MaxAttempts, err)
+}
+
+// deliver posts the event payload to the subscription URL with an HMAC-SHA256 signature of the transaction ID and
+// payload.
+func (relay *webhookRelay) deliver(ctx context.Context, sub subscription, event *client.ChaincodeEvent) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(event.Payload))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(eventNameHeader, event.EventName)
+	request.Header.Set(transactionIDHeader, event.TransactionID)
+	request.Header.Set(blockNumberHeader, strconv.FormatUint(event.BlockNumber, 10))
+	request.Header.Set(signatureHeader, "sha256="+signPayload(sub.Secret, event.TransactionID, event.Payload))
+
+	response, err := relay.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %s", response.Status)
+	}
+	return nil
+}
+
+// signPayload returns the hex-encoded HMAC-SHA256 of the transaction ID, a period and the payload, using the
+// subscription secret. Signing the transaction ID binds the payload to the X-Fabric-Transaction-Id header, so that
+// a captured request cannot be replayed as a different transaction.
+func signPayload(secret string, transactionID string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(transactionID + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// redrive attempts delivery of every dead-lettered event, optionally only for the named subscription. Events that
+// are delivered are removed from the dead-letter store, while those that fail again remain in it.
+func (relay *webhookRelay) redrive(ctx context.Context, subscriptionName string) error {
+	subscriptions := make(map[string]subscription)
+	for _, sub := range relay.config.Subscriptions {
+		subscriptions[sub.Name] = sub
+	}
+
+	return relay.deadLetter.drain(func(letter *deadLetter) bool {
+		if subscriptionName != "" && letter.Subscription != subscriptionName {
+			return false
+		}
+
+		sub, ok := subscriptions[letter.Subscription]
+		if !ok {
+			fmt.Printf("\n*** Skipping dead letter for unknown subscription %s\n", letter.Subscription)
+			return false
+		}
+
+		event := letter.chaincodeEvent()
+		if err := relay.deliverWithRetry(ctx, sub, event); err != nil {
+			fmt.Printf("\n*** Redrive of %s event in transaction %s to %s failed: %v\n", event.EventName, event.TransactionID, sub.Name, err)
+			return false
+		}
+
+		fmt.Printf("\n--> Redrove %s event in transaction %s to %s\n", event.EventName, event.TransactionID, sub.Name)
+		return true
+	})
+}
@@ -0,0 +1,68 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// EventSchemaVersion is the version of the AssetEvent schema. It is incremented whenever a change to the envelope
+// could break existing consumers.
+const EventSchemaVersion = 1
+
+// Event types recorded in AssetEvent envelopes
+const (
+	EventTypeAssetCreated     = "AssetCreated"
+	EventTypeAssetUpdated     = "AssetUpdated"
+	EventTypeAssetTransferred = "AssetTransferred"
+	EventTypeAssetDeleted     = "AssetDeleted"
+)
+
+// AssetEvent is the envelope emitted as the payload of every chaincode event. PreviousState is nil for created
+// assets, and NewState is nil for deleted assets.
+type AssetEvent struct {
+	AssetID       string `json:"assetId"`
+	EventType     string `json:"eventType"`
+	InvokingMSP   string `json:"invokingMsp"`
+	NewState      *Asset `json:"newState,omitempty"`
+	PreviousState *Asset `json:"previousState,omitempty"`
+	SchemaVersion int    `json:"schemaVersion"`
+	Timestamp     string `json:"timestamp"`
+	TransactionID string `json:"transactionId"`
+}
+
+// emitAssetEvent sets the chaincode event for the transaction, using the transaction function name as the event
+// name and an AssetEvent envelope as the payload.
+func emitAssetEvent(ctx contractapi.TransactionContextInterface, eventName string, eventType string, assetID string, previousState *Asset, newState *Asset) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get invoking MSP ID: %w", err)
+	}
+
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return fmt.Errorf("failed to get transaction timestamp: %w", err)
+	}
+
+	event := AssetEvent{
+		AssetID:       assetID,
+		EventType:     eventType,
+		InvokingMSP:   mspID,
+		NewState:      newState,
+		PreviousState: previousState,
+		SchemaVersion: EventSchemaVersion,
+		Timestamp:     timestamp.AsTime().UTC().Format(time.RFC3339Nano),
+		TransactionID: ctx.GetStub().GetTxID(),
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.GetStub().SetEvent(eventName, eventJSON); err != nil {
+		return fmt.Errorf("failed to set %s event: %w", eventName, err)
+	}
+	return nil
+}
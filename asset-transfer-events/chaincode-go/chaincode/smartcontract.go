@@ -42,7 +42,9 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
-	ctx.GetStub().SetEvent("CreateAsset", assetJSON)
+	if err := emitAssetEvent(ctx, "CreateAsset", EventTypeAssetCreated, id, nil, &asset); err != nil {
+		return err
+	}
 	return ctx.GetStub().PutState(id, assetJSON)
 }
 
@@ -76,7 +78,7 @@ func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, i
 
 // UpdateAsset updates an existing asset in the world state with provided parameters.
 func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface, id string, color string, size int, owner string, appraisedValue int) error {
-	_, err := s.readState(ctx, id)
+	previous, err := s.ReadAsset(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -94,18 +96,22 @@ func (s *SmartContract) UpdateAsset(ctx contractapi.TransactionContextInterface,
 		return err
 	}
 
-	ctx.GetStub().SetEvent("UpdateAsset", assetJSON)
+	if err := emitAssetEvent(ctx, "UpdateAsset", EventTypeAssetUpdated, id, previous, &asset); err != nil {
+		return err
+	}
 	return ctx.GetStub().PutState(id, assetJSON)
 }
 
 // DeleteAsset deletes an given asset from the world state.
 func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface, id string) error {
-	assetJSON, err := s.readState(ctx, id)
+	asset, err := s.ReadAsset(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	ctx.GetStub().SetEvent("DeleteAsset", assetJSON)
+	if err := emitAssetEvent(ctx, "DeleteAsset", EventTypeAssetDeleted, id, asset, nil); err != nil {
+		return err
+	}
 	return ctx.GetStub().DelState(id)
 }
 
@@ -116,6 +122,7 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return "", err
 	}
 
+	previous := *asset
 	oldOwner := asset.Owner
 	asset.Owner = newOwner
 
@@ -124,7 +131,9 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return "", err
 	}
 
-	ctx.GetStub().SetEvent("TransferAsset", assetJSON)
+	if err := emitAssetEvent(ctx, "TransferAsset", EventTypeAssetTransferred, id, &previous, asset); err != nil {
+		return "", err
+	}
 	err = ctx.GetStub().PutState(id, assetJSON)
 	if err != nil {
 		return "", err
@@ -0,0 +1,166 @@
+/*
+Copyright 2024 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// This application transfers all assets of a color to a new owner using the TransferAssetByColorBatch
+// chaincode function. Each batch is submitted as a separate transaction, continuing from the key
+// returned by the previous batch, so that no transaction has an unbounded write set. Batches that
+// fail validation because of a read conflict with another transaction are retried.
+//
+// Usage: go run . -color blue -owner jerry [-batch-size 50] [-max-retries 5]
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/hash"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+)
+
+const (
+	channelName   = "mychannel"
+	chaincodeName = "ledger"
+)
+
+// colorTransferProgress is the result of the TransferAssetByColorBatch chaincode function.
+type colorTransferProgress struct {
+	ProcessedCount      int    `json:"processedCount"`
+	TransferredCount    int    `json:"transferredCount"`
+	RemovedIndexEntries int    `json:"removedIndexEntries"`
+	ContinuationKey     string `json:"continuationKey"`
+	Done                bool   `json:"done"`
+}
+
+// conflictError is returned when a batch transaction fails validation because assets it read
+// were changed by another transaction, in which case the batch can be retried.
+type conflictError struct {
+	transactionID string
+	code          peer.TxValidationCode
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("transaction %s failed validation with status code %v", e.transactionID, e.code)
+}
+
+func main() {
+	color := flag.String("color", "", "color of the assets to transfer")
+	newOwner := flag.String("owner", "", "new owner of the assets")
+	batchSize := flag.Int("batch-size", 50, "number of assets transferred in each transaction")
+	maxRetries := flag.Int("max-retries", 5, "number of times a batch is retried after a read conflict")
+	flag.Parse()
+
+	if *color == "" || *newOwner == "" {
+		fmt.Fprintln(os.Stderr, "-color and -owner are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	clientConnection := newGrpcConnection()
+	defer clientConnection.Close()
+
+	id := newIdentity()
+	sign := newSign()
+
+	gateway, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithHash(hash.SHA256),
+		client.WithClientConnection(clientConnection),
+		client.WithEvaluateTimeout(5*time.Second),
+		client.WithEndorseTimeout(15*time.Second),
+		client.WithSubmitTimeout(5*time.Second),
+		client.WithCommitStatusTimeout(1*time.Minute),
+	)
+	if err != nil {
+		panic(err)
+	}
+	defer gateway.Close()
+
+	contract := gateway.GetNetwork(channelName).GetContract(chaincodeName)
+
+	if err := transferAssetsByColor(contract, *color, *newOwner, *batchSize, *maxRetries); err != nil {
+		panic(err)
+	}
+}
+
+// transferAssetsByColor submits batches until all assets of the color have been transferred.
+func transferAssetsByColor(contract *client.Contract, color string, newOwner string, batchSize int, maxRetries int) error {
+	var processed, transferred, removed int
+	startAfterKey := ""
+
+	for {
+		progress, err := transferBatchWithRetry(contract, color, newOwner, batchSize, startAfterKey, maxRetries)
+		if err != nil {
+			return err
+		}
+
+		processed += progress.ProcessedCount
+		transferred += progress.TransferredCount
+		removed += progress.RemovedIndexEntries
+		fmt.Printf("*** Batch complete: %d assets processed, %d transferred, %d stale index entries removed so far\n", processed, transferred, removed)
+
+		if progress.Done {
+			break
+		}
+		startAfterKey = progress.ContinuationKey
+	}
+
+	fmt.Printf("\n*** Transferred %d %s assets to %s\n", transferred, color, newOwner)
+	return nil
+}
+
+// transferBatchWithRetry submits a batch, retrying it from the same key with an increasing delay
+// if it fails validation because of a read conflict.
+func transferBatchWithRetry(contract *client.Contract, color string, newOwner string, batchSize int, startAfterKey string, maxRetries int) (*colorTransferProgress, error) {
+	for attempt := 0; ; attempt++ {
+		progress, err := transferBatch(contract, color, newOwner, batchSize, startAfterKey)
+
+		var conflict *conflictError
+		if !errors.As(err, &conflict) || attempt == maxRetries {
+			return progress, err
+		}
+
+		delay := time.Duration(attempt+1) * 500 * time.Millisecond
+		fmt.Printf("*** %v, retrying in %v\n", conflict, delay)
+		time.Sleep(delay)
+	}
+}
+
+// transferBatch submits a single TransferAssetByColorBatch transaction and waits for it to commit.
+func transferBatch(contract *client.Contract, color string, newOwner string, batchSize int, startAfterKey string) (*colorTransferProgress, error) {
+	fmt.Printf("\n--> Submit Transaction: TransferAssetByColorBatch, %s assets to %s after %q\n", color, newOwner, startAfterKey)
+
+	result, commit, err := contract.SubmitAsync("TransferAssetByColorBatch", client.WithArguments(color, newOwner, strconv.Itoa(batchSize), startAfterKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to submit transaction: %w", err)
+	}
+
+	status, err := commit.Status()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transaction commit status: %w", err)
+	}
+
+	switch status.Code {
+	case peer.TxValidationCode_VALID:
+	case peer.TxValidationCode_MVCC_READ_CONFLICT, peer.TxValidationCode_PHANTOM_READ_CONFLICT:
+		return nil, &conflictError{transactionID: status.TransactionID, code: status.Code}
+	default:
+		return nil, fmt.Errorf("transaction %s failed to commit with status code %v", status.TransactionID, status.Code)
+	}
+
+	var progress colorTransferProgress
+	if err := json.Unmarshal(result, &progress); err != nil {
+		return nil, fmt.Errorf("failed to parse result: %w", err)
+	}
+
+	return &progress, nil
+}
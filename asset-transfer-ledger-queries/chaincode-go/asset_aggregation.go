@@ -0,0 +1,345 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// maxAggregateScan is the largest number of keys read by a single call to AggregateAssets
+const maxAggregateScan = 1000
+
+// aggregateFields are the Asset fields, by JSON name, that numeric metrics can be calculated over
+var aggregateFields = map[string]bool{
+	"size":           true,
+	"appraisedValue": true,
+}
+
+// aggregateOperations are the supported metric operations
+var aggregateOperations = map[string]bool{
+	"count": true,
+	"sum":   true,
+	"min":   true,
+	"max":   true,
+	"avg":   true,
+}
+
+// AggregateResult structure used for returning grouped metrics over assets. If ContinuationToken
+// is not empty, the scan budget was reached before all assets were read, and the groups only cover
+// the assets scanned so far. The remaining assets are aggregated by calling AggregateAssets again
+// with the same arguments and the continuation token, and the results combined by the client.
+type AggregateResult struct {
+	GroupBy           string           `json:"groupBy"`
+	Metric            string           `json:"metric"`
+	Groups            []AggregateGroup `json:"groups"`
+	ScannedCount      int              `json:"scannedCount"`
+	ContinuationToken string           `json:"continuationToken"`
+}
+
+// AggregateGroup structure used for returning the metric for one group of assets. Count is the
+// number of assets in the group, so that averages from several calls can be combined.
+type AggregateGroup struct {
+	Key   string  `json:"key"`
+	Count int     `json:"count"`
+	Value float64 `json:"value"`
+}
+
+// filterCondition is a parsed structured filter clause, evaluated against assets by the chaincode
+type filterCondition struct {
+	fieldIndex int
+	operator   string
+	value      interface{}
+}
+
+// AggregateAssets calculates a metric over assets, grouped by the value of an asset field.
+// The metric is either "count", or an operation and a numeric field separated by a colon, where the
+// operation is one of sum, min, max or avg, and the field is size or appraisedValue.
+// The optional filter is a structured filter, as used by QueryAssetsByFilter, without sort or limit.
+// Assets are streamed from a range query, so only assets that exist are aggregated. At most
+// maxAggregateScan keys are read per call; if more keys remain, pass the returned continuation token
+// to continue the aggregation.
+// Example: AggregateAssets("owner", "sum:appraisedValue", "", "")
+func (t *SimpleChaincode) AggregateAssets(ctx contractapi.TransactionContextInterface, groupByField string, metric string, filterJSON string, continuationToken string) (*AggregateResult, error) {
+	groupByIndex, err := assetFieldIndex(groupByField)
+	if err != nil {
+		return nil, err
+	}
+
+	operation, metricIndex, err := parseAggregateMetric(metric)
+	if err != nil {
+		return nil, err
+	}
+
+	var conditions []filterCondition
+	if filterJSON != "" {
+		conditions, err = parseFilterConditions(filterJSON)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	aggregator := newAssetAggregator(operation)
+	result := &AggregateResult{
+		GroupBy: groupByField,
+		Metric:  metric,
+	}
+
+	resultsIterator, responseMetadata, err := ctx.GetStub().GetStateByRangeWithPagination("", "", maxAggregateScan, continuationToken)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResult, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		result.ScannedCount++
+		if isColorIndexKey(queryResult.Key) {
+			continue
+		}
+
+		var asset Asset
+		err = json.Unmarshal(queryResult.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+		if asset.DocType != assetDocType || !matchesFilter(&asset, conditions) {
+			continue
+		}
+
+		assetValue := reflect.ValueOf(asset)
+		var value int
+		if metricIndex >= 0 {
+			value = int(assetValue.Field(metricIndex).Int())
+		}
+		aggregator.add(fmt.Sprint(assetValue.Field(groupByIndex).Interface()), value)
+	}
+
+	result.Groups = aggregator.groups()
+	if result.ScannedCount == maxAggregateScan {
+		more, err := hasMoreKeys(ctx, responseMetadata.Bookmark)
+		if err != nil {
+			return nil, err
+		}
+		if more {
+			result.ContinuationToken = responseMetadata.Bookmark
+		}
+	}
+
+	return result, nil
+}
+
+// hasMoreKeys returns true if a range query over all keys has results after a bookmark. A full page
+// does not mean that there are more results, so this reads the first key of the next page.
+func hasMoreKeys(ctx contractapi.TransactionContextInterface, bookmark string) (bool, error) {
+	if bookmark == "" {
+		return false, nil
+	}
+
+	resultsIterator, _, err := ctx.GetStub().GetStateByRangeWithPagination("", "", 1, bookmark)
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	return resultsIterator.HasNext(), nil
+}
+
+// parseAggregateMetric returns the operation of a metric, and the index of the Asset field it is
+// calculated over, or -1 for count.
+func parseAggregateMetric(metric string) (string, int, error) {
+	if metric == "count" {
+		return metric, -1, nil
+	}
+
+	operation, field, found := strings.Cut(metric, ":")
+	if !found || operation == "count" || !aggregateOperations[operation] || !aggregateFields[field] {
+		return "", 0, fmt.Errorf("unknown metric %q, expected count or one of sum, min, max, avg followed by :size or :appraisedValue", metric)
+	}
+
+	fieldIndex, err := assetFieldIndex(field)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return operation, fieldIndex, nil
+}
+
+// parseFilterConditions parses a structured filter into conditions evaluated by the chaincode.
+func parseFilterConditions(filterJSON string) ([]filterCondition, error) {
+	filter, err := parseAssetFilter(filterJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(filter.Sort) > 0 || filter.Limit != 0 {
+		return nil, fmt.Errorf("sort and limit cannot be used in an aggregation filter")
+	}
+	if len(filter.Clauses) > maxFilterClauses {
+		return nil, fmt.Errorf("filter cannot have more than %d clauses", maxFilterClauses)
+	}
+
+	conditions := make([]filterCondition, 0, len(filter.Clauses))
+	for _, clause := range filter.Clauses {
+		_, value, err := parseFilterClause(clause)
+		if err != nil {
+			return nil, err
+		}
+		fieldIndex, err := assetFieldIndex(clause.Field)
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, filterCondition{
+			fieldIndex: fieldIndex,
+			operator:   clause.Operator,
+			value:      value,
+		})
+	}
+
+	return conditions, nil
+}
+
+// matchesFilter returns true if an asset matches all of the filter conditions.
+func matchesFilter(asset *Asset, conditions []filterCondition) bool {
+	assetValue := reflect.ValueOf(*asset)
+	for _, condition := range conditions {
+		fieldValue := assetValue.Field(condition.fieldIndex).Interface()
+
+		if condition.operator == "in" {
+			found := false
+			for _, value := range condition.value.([]interface{}) {
+				if compareFilterValues(fieldValue, value) == 0 {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+			continue
+		}
+
+		comparison := compareFilterValues(fieldValue, condition.value)
+		var matched bool
+		switch condition.operator {
+		case "eq":
+			matched = comparison == 0
+		case "ne":
+			matched = comparison != 0
+		case "gt":
+			matched = comparison > 0
+		case "gte":
+			matched = comparison >= 0
+		case "lt":
+			matched = comparison < 0
+		case "lte":
+			matched = comparison <= 0
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compareFilterValues compares two values of the same filter field type.
+func compareFilterValues(a interface{}, b interface{}) int {
+	switch a := a.(type) {
+	case string:
+		return strings.Compare(a, b.(string))
+	case int:
+		b := b.(int)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	default:
+		return 0
+	}
+}
+
+// assetFieldIndex returns the index in the Asset struct of the field with a JSON name.
+func assetFieldIndex(name string) (int, error) {
+	if _, ok := assetFilterFields[name]; !ok {
+		return 0, fmt.Errorf("unknown asset field %q, expected one of %s", name, strings.Join(sortedKeys(assetFilterFields), ", "))
+	}
+
+	assetType := reflect.TypeOf(Asset{})
+	for i := 0; i < assetType.NumField(); i++ {
+		if strings.Split(assetType.Field(i).Tag.Get("json"), ",")[0] == name {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown asset field %q", name)
+}
+
+// assetAggregator accumulates a metric for groups of assets
+type assetAggregator struct {
+	operation string
+	counts    map[string]int
+	values    map[string]int
+}
+
+func newAssetAggregator(operation string) *assetAggregator {
+	return &assetAggregator{
+		operation: operation,
+		counts:    map[string]int{},
+		values:    map[string]int{},
+	}
+}
+
+func (aggregator *assetAggregator) add(key string, value int) {
+	count := aggregator.counts[key]
+	aggregator.counts[key] = count + 1
+
+	current := aggregator.values[key]
+	switch aggregator.operation {
+	case "sum", "avg":
+		aggregator.values[key] = current + value
+	case "min":
+		if count == 0 || value < current {
+			aggregator.values[key] = value
+		}
+	case "max":
+		if count == 0 || value > current {
+			aggregator.values[key] = value
+		}
+	}
+}
+
+// groups returns the aggregated groups, ordered by key.
+func (aggregator *assetAggregator) groups() []AggregateGroup {
+	groups := make([]AggregateGroup, 0, len(aggregator.counts))
+	for key, count := range aggregator.counts {
+		value := float64(aggregator.values[key])
+		switch aggregator.operation {
+		case "count":
+			value = float64(count)
+		case "avg":
+			value /= float64(count)
+		}
+		groups = append(groups, AggregateGroup{Key: key, Count: count, Value: value})
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Key < groups[j].Key
+	})
+
+	return groups
+}
@@ -0,0 +1,351 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-ledger-queries/chaincode-go/couchdbindex"
+)
+
+// maxFilterResults is the largest number of assets returned by a structured filter query, or in a
+// page of a paginated structured filter query
+const maxFilterResults = 100
+
+// maxFilterClauses is the largest number of clauses in a structured filter
+const maxFilterClauses = 10
+
+// maxFilterInValues is the largest number of values in an "in" clause
+const maxFilterInValues = 100
+
+// assetDocType is the docType of assets, added to the selector of every structured filter query
+const assetDocType = "asset"
+
+// assetIndexes are the indexes annotated on the Asset struct, which are packaged in
+// META-INF/statedb/couchdb/indexes. Structured filter queries are only run using one of these indexes.
+var assetIndexes = loadAssetIndexes()
+
+// filterOperators maps structured filter operators to CouchDB selector operators
+var filterOperators = map[string]string{
+	"eq":  "$eq",
+	"ne":  "$ne",
+	"gt":  "$gt",
+	"gte": "$gte",
+	"lt":  "$lt",
+	"lte": "$lte",
+	"in":  "$in",
+}
+
+// assetFilterFields are the Asset fields, by JSON name, that can be used in structured filters,
+// with the type of their values. docType is set by the chaincode.
+var assetFilterFields = filterFields(reflect.TypeOf(Asset{}), "docType")
+
+// AssetFilter is a structured query for assets. Clauses are combined with AND. If Limit is zero,
+// at most maxFilterResults assets are returned.
+// Example: {"clauses":[{"field":"owner","op":"eq","value":"tom"},{"field":"size","op":"gt","value":3}],"sort":[{"field":"owner"}],"limit":10}
+type AssetFilter struct {
+	Clauses []FilterClause `json:"clauses"`
+	Sort    []FilterSort   `json:"sort,omitempty"`
+	Limit   int            `json:"limit,omitempty"`
+}
+
+// FilterClause compares an asset field to a value. The value of an "in" clause is an array.
+type FilterClause struct {
+	Field    string          `json:"field"`
+	Operator string          `json:"op"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// FilterSort orders results by an asset field. Direction is "asc" (the default) or "desc".
+type FilterSort struct {
+	Field     string `json:"field"`
+	Direction string `json:"direction,omitempty"`
+}
+
+// couchDBQuery is the CouchDB query built from a structured filter. Values are only ever
+// added to the query by marshaling it, so they cannot change the structure of the query.
+type couchDBQuery struct {
+	Selector map[string]map[string]interface{} `json:"selector"`
+	Sort     []map[string]string               `json:"sort,omitempty"`
+	Limit    int                               `json:"limit,omitempty"`
+	UseIndex []string                          `json:"use_index"`
+}
+
+// QueryAssetsByFilter queries for assets using a structured filter, passed as JSON. Unlike
+// QueryAssets, the query is built by the chaincode: only Asset fields can be queried, values
+// must match the type of the field, a packaged index must support the query, and the number
+// of results is capped.
+// Only available on state databases that support rich query (e.g. CouchDB)
+// Example: Structured rich query
+func (t *SimpleChaincode) QueryAssetsByFilter(ctx contractapi.TransactionContextInterface, filterJSON string) ([]*Asset, error) {
+	filter, err := parseAssetFilter(filterJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit == 0 {
+		limit = maxFilterResults
+	}
+	if limit < 0 || limit > maxFilterResults {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxFilterResults)
+	}
+
+	queryString, err := buildAssetQuery(filter, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	assets, err := getQueryResultForQueryString(ctx, queryString)
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) > limit {
+		assets = assets[:limit]
+	}
+
+	return assets, nil
+}
+
+// QueryAssetsByFilterWithPagination queries for a page of assets using a structured filter,
+// page size and a bookmark. The filter must not set a limit, since the page size limits the results.
+// Only available on state databases that support rich query (e.g. CouchDB)
+// Paginated queries are only valid for read only transactions.
+// Example: Pagination with structured rich query
+func (t *SimpleChaincode) QueryAssetsByFilterWithPagination(ctx contractapi.TransactionContextInterface, filterJSON string, pageSize int, bookmark string) (*PaginatedQueryResult, error) {
+	filter, err := parseAssetFilter(filterJSON)
+	if err != nil {
+		return nil, err
+	}
+	if filter.Limit != 0 {
+		return nil, fmt.Errorf("limit cannot be used with pagination, use pageSize instead")
+	}
+	if pageSize <= 0 || pageSize > maxFilterResults {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", maxFilterResults)
+	}
+
+	queryString, err := buildAssetQuery(filter, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return getQueryResultForQueryStringWithPagination(ctx, queryString, int32(pageSize), bookmark)
+}
+
+// parseAssetFilter parses a structured filter, rejecting unknown properties.
+func parseAssetFilter(filterJSON string) (*AssetFilter, error) {
+	var filter AssetFilter
+	decoder := json.NewDecoder(strings.NewReader(filterJSON))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse filter: %v", err)
+	}
+
+	return &filter, nil
+}
+
+// buildAssetQuery builds a CouchDB query string for a structured filter, using the first
+// packaged index that supports the filtered and sorted fields.
+func buildAssetQuery(filter *AssetFilter, limit int) (string, error) {
+	if len(filter.Clauses) > maxFilterClauses {
+		return "", fmt.Errorf("filter cannot have more than %d clauses", maxFilterClauses)
+	}
+
+	query := couchDBQuery{
+		Selector: map[string]map[string]interface{}{
+			"docType": {"$eq": assetDocType},
+		},
+		Limit: limit,
+	}
+
+	for _, clause := range filter.Clauses {
+		operator, value, err := parseFilterClause(clause)
+		if err != nil {
+			return "", err
+		}
+
+		conditions, ok := query.Selector[clause.Field]
+		if !ok {
+			conditions = map[string]interface{}{}
+			query.Selector[clause.Field] = conditions
+		}
+		if _, ok := conditions[operator]; ok {
+			return "", fmt.Errorf("duplicate %s clause for field %s", clause.Operator, clause.Field)
+		}
+		conditions[operator] = value
+	}
+
+	var sortFields []couchdbindex.SortField
+	for _, sortField := range filter.Sort {
+		if _, ok := assetFilterFields[sortField.Field]; !ok {
+			return "", fmt.Errorf("unknown sort field %q", sortField.Field)
+		}
+		direction := sortField.Direction
+		if direction == "" {
+			direction = "asc"
+		}
+		if direction != "asc" && direction != "desc" {
+			return "", fmt.Errorf("unknown sort direction %q for field %s, expected asc or desc", sortField.Direction, sortField.Field)
+		}
+		if len(sortFields) > 0 && sortFields[0].Descending != (direction == "desc") {
+			return "", fmt.Errorf("all sort fields must have the same direction")
+		}
+		query.Sort = append(query.Sort, map[string]string{sortField.Field: direction})
+		sortFields = append(sortFields, couchdbindex.SortField{Name: sortField.Field, Descending: direction == "desc"})
+	}
+
+	selectorFields := make([]string, 0, len(query.Selector))
+	for field := range query.Selector {
+		selectorFields = append(selectorFields, field)
+	}
+
+	index, err := findAssetIndex(selectorFields, sortFields)
+	if err != nil {
+		return "", err
+	}
+	query.UseIndex = []string{"_design/" + index.DesignDoc, index.Name}
+
+	queryBytes, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal query: %v", err)
+	}
+
+	return string(queryBytes), nil
+}
+
+// parseFilterClause checks the field and operator of a clause, and returns the CouchDB selector
+// operator and the value decoded as the type of the field.
+func parseFilterClause(clause FilterClause) (string, interface{}, error) {
+	kind, ok := assetFilterFields[clause.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown filter field %q, expected one of %s", clause.Field, strings.Join(sortedKeys(assetFilterFields), ", "))
+	}
+	operator, ok := filterOperators[clause.Operator]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown filter operator %q for field %s, expected one of %s", clause.Operator, clause.Field, strings.Join(sortedKeys(filterOperators), ", "))
+	}
+
+	value, err := filterValue(clause, kind)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return operator, value, nil
+}
+
+// filterValue decodes the value of a clause as the type of the filtered field.
+func filterValue(clause FilterClause, kind reflect.Kind) (interface{}, error) {
+	if clause.Operator == "in" {
+		var values []json.RawMessage
+		err := json.Unmarshal(clause.Value, &values)
+		if err != nil {
+			return nil, fmt.Errorf("value of in clause for field %s must be an array", clause.Field)
+		}
+		if len(values) == 0 || len(values) > maxFilterInValues {
+			return nil, fmt.Errorf("in clause for field %s must have between 1 and %d values", clause.Field, maxFilterInValues)
+		}
+
+		result := make([]interface{}, 0, len(values))
+		for _, value := range values {
+			decoded, err := decodeFilterValue(clause.Field, value, kind)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, decoded)
+		}
+		return result, nil
+	}
+
+	return decodeFilterValue(clause.Field, clause.Value, kind)
+}
+
+func decodeFilterValue(field string, value json.RawMessage, kind reflect.Kind) (interface{}, error) {
+	switch kind {
+	case reflect.String:
+		var result string
+		if err := json.Unmarshal(value, &result); err != nil {
+			return nil, fmt.Errorf("value for field %s must be a string", field)
+		}
+		return result, nil
+	case reflect.Int:
+		var result int
+		if err := json.Unmarshal(value, &result); err != nil {
+			return nil, fmt.Errorf("value for field %s must be an integer", field)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("field %s cannot be filtered", field)
+	}
+}
+
+// findAssetIndex returns a packaged index that can be used for a query. All of the index fields
+// must be in the selector, and the sort fields must be the leading index fields, in order and with
+// the sort direction of the index.
+func findAssetIndex(selectorFields []string, sortFields []couchdbindex.SortField) (*couchdbindex.Index, error) {
+	for i := range assetIndexes {
+		index := &assetIndexes[i]
+		if index.Supports(selectorFields, sortFields) {
+			return index, nil
+		}
+	}
+
+	sort.Strings(selectorFields)
+	description := strings.Join(selectorFields, ", ")
+	if len(sortFields) > 0 {
+		description += " sorted by " + describeSort(sortFields)
+	}
+	return nil, fmt.Errorf("no packaged index supports a query on fields %s; filter on the fields of an index in META-INF/statedb/couchdb/indexes", description)
+}
+
+// describeSort returns the sort fields in order, with the direction of descending fields.
+func describeSort(sortFields []couchdbindex.SortField) string {
+	names := make([]string, 0, len(sortFields))
+	for _, sortField := range sortFields {
+		names = append(names, sortField.String())
+	}
+	return strings.Join(names, ", ")
+}
+
+// filterFields returns the JSON names and kinds of the fields of a struct, excluding the named fields.
+func filterFields(structType reflect.Type, excluded ...string) map[string]reflect.Kind {
+	fields := map[string]reflect.Kind{}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = field.Type.Kind()
+	}
+	for _, name := range excluded {
+		delete(fields, name)
+	}
+
+	return fields
+}
+
+func loadAssetIndexes() []couchdbindex.Index {
+	indexes, err := couchdbindex.FromStruct(reflect.TypeOf(Asset{}))
+	if err != nil {
+		log.Panicf("Error reading asset index tags: %v", err)
+	}
+	return indexes
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
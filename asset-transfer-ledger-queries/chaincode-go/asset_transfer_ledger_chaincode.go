@@ -11,12 +11,17 @@ peer chaincode invoke -C myc1 -n asset_transfer -c '{"Args":["CreateAsset","asse
 peer chaincode invoke -C myc1 -n asset_transfer -c '{"Args":["CreateAsset","asset3","blue","6","tom","70"]}'
 peer chaincode invoke -C myc1 -n asset_transfer -c '{"Args":["TransferAsset","asset2","jerry"]}'
 peer chaincode invoke -C myc1 -n asset_transfer -c '{"Args":["TransferAssetByColor","blue","jerry"]}'
+peer chaincode invoke -C myc1 -n asset_transfer -c '{"Args":["TransferAssetByColorBatch","blue","jerry","50",""]}'
 peer chaincode invoke -C myc1 -n asset_transfer -c '{"Args":["DeleteAsset","asset1"]}'
 
 ==== Query assets ====
 peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["ReadAsset","asset1"]}'
 peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["GetAssetsByRange","asset1","asset3"]}'
 peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["GetAssetHistory","asset1"]}'
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["GetAssetHistoryPaged","asset1","2024-01-01T00:00:00Z","","10","0"]}'
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["GetAssetHistoryDiff","asset1","10","0"]}'
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["AggregateAssets","color","count","",""]}'
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["AggregateAssets","owner","sum:appraisedValue","{\"clauses\":[{\"field\":\"size\",\"op\":\"gte\",\"value\":5}]}",""]}'
 
 Rich Query (Only supported if CouchDB is used as state database):
 peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssetsByOwner","tom"]}'
@@ -25,6 +30,12 @@ peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssets","{\"se
 Rich Query with Pagination (Only supported if CouchDB is used as state database):
 peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssetsWithPagination","{\"selector\":{\"owner\":\"tom\"}}","3",""]}'
 
+Structured Rich Query (Only supported if CouchDB is used as state database):
+The query is built by the chaincode from field, operator and value clauses. Only Asset fields can be
+queried, the query must be supported by a packaged index, and the number of results is capped.
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssetsByFilter","{\"clauses\":[{\"field\":\"owner\",\"op\":\"eq\",\"value\":\"tom\"},{\"field\":\"size\",\"op\":\"gt\",\"value\":4}],\"limit\":10}"]}'
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssetsByFilterWithPagination","{\"clauses\":[{\"field\":\"owner\",\"op\":\"in\",\"value\":[\"tom\",\"jerry\"]}]}","3",""]}'
+
 INDEXES TO SUPPORT COUCHDB RICH QUERIES
 
 Indexes in CouchDB are required in order to make JSON queries efficient and are required for
@@ -34,8 +45,10 @@ text file with extension *.json with the index definition formatted in JSON foll
 CouchDB index JSON syntax as documented at:
 http://docs.couchdb.org/en/2.3.1/api/database/find.html#db-index
 
-This asset transfer ledger example chaincode demonstrates a packaged
-index which you can find in META-INF/statedb/couchdb/indexes/indexOwner.json.
+This asset transfer ledger example chaincode demonstrates packaged
+indexes which you can find in META-INF/statedb/couchdb/indexes. The index definitions are generated
+from the index tags on the Asset struct by running go generate, and checked against the packaged
+files and the structured filters in the chaincode by running go run ./cmd/indexgen -check.
 
 If you have access to the your peer's CouchDB state database in a development environment,
 you may want to iteratively test various indexes in support of your chaincode queries.  You
@@ -55,43 +68,62 @@ Example curl command line to define index in the CouchDB channel_chaincode datab
 curl -i -X POST -H "Content-Type: application/json" -d "{\"index\":{\"fields\":[\"docType\",\"owner\"]},\"name\":\"indexOwner\",\"ddoc\":\"indexOwnerDoc\",\"type\":\"json\"}" http://hostname:port/myc1_assets/_index
 
 
-Index for docType, owner, size (descending order).
+Index for size, docType, owner (descending order).
 
 Example curl command line to define index in the CouchDB channel_chaincode database:
-curl -i -X POST -H "Content-Type: application/json" -d "{\"index\":{\"fields\":[{\"size\":\"desc\"},{\"docType\":\"desc\"},{\"owner\":\"desc\"}]},\"ddoc\":\"indexSizeSortDoc\", \"name\":\"indexSizeSortDesc\",\"type\":\"json\"}" http://hostname:port/myc1_assets/_index
+curl -i -X POST -H "Content-Type: application/json" -d "{\"index\":{\"fields\":[{\"size\":\"desc\"},{\"docType\":\"desc\"},{\"owner\":\"desc\"}]},\"ddoc\":\"indexSizeSortDescDoc\", \"name\":\"indexSizeSortDesc\",\"type\":\"json\"}" http://hostname:port/myc1_assets/_index
 
 Rich Query with index design doc and index name specified (Only supported if CouchDB is used as state database):
 peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssets","{\"selector\":{\"docType\":\"asset\",\"owner\":\"tom\"}, \"use_index\":[\"_design/indexOwnerDoc\", \"indexOwner\"]}"]}'
 
 Rich Query with index design doc specified only (Only supported if CouchDB is used as state database):
-peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssets","{\"selector\":{\"docType\":{\"$eq\":\"asset\"},\"owner\":{\"$eq\":\"tom\"},\"size\":{\"$gt\":0}},\"fields\":[\"docType\",\"owner\",\"size\"],\"sort\":[{\"size\":\"desc\"}],\"use_index\":\"_design/indexSizeSortDoc\"}"]}'
+peer chaincode query -C myc1 -n asset_transfer -c '{"Args":["QueryAssets","{\"selector\":{\"docType\":{\"$eq\":\"asset\"},\"owner\":{\"$eq\":\"tom\"},\"size\":{\"$gt\":0}},\"fields\":[\"docType\",\"owner\",\"size\"],\"sort\":[{\"size\":\"desc\"}],\"use_index\":\"_design/indexSizeSortDescDoc\"}"]}'
 */
 
+//go:generate go run ./cmd/indexgen
+
 package main
 
 import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
 )
 
 const index = "color~name"
 
+// colorIndexPrefix is the prefix of the simple key color index used by TransferAssetByColorBatch.
+// Unlike composite keys, simple keys can be used as the start and end of GetStateByRange in
+// transactions that write. The prefix contains a null character, which is not allowed in asset IDs.
+const colorIndexPrefix = "colorIndex\x00"
+
+// maxColorTransferBatch is the largest number of assets transferred by TransferAssetByColorBatch
+const maxColorTransferBatch = 100
+
+// maxHistoryPageSize is the largest number of history records returned by GetAssetHistoryPaged
+// and GetAssetHistoryDiff
+const maxHistoryPageSize = 100
+
 // SimpleChaincode implements the fabric-contract-api-go programming model
 type SimpleChaincode struct {
 	contractapi.Contract
 }
 
+// Asset fields tagged with index are included in the CouchDB indexes generated by go generate,
+// using the annotations described in the couchdbindex package.
 type Asset struct {
-	DocType        string `json:"docType"` //docType is used to distinguish the various types of objects in state database
-	ID             string `json:"ID"`      //the field tags are needed to keep case from bouncing around
+	DocType        string `json:"docType" index:"indexOwner:1,indexSizeSortDesc:2:desc"` //docType is used to distinguish the various types of objects in state database
+	ID             string `json:"ID"`                                                    //the field tags are needed to keep case from bouncing around
 	Color          string `json:"color"`
-	Size           int    `json:"size"`
-	Owner          string `json:"owner"`
+	Size           int    `json:"size" index:"indexSizeSortDesc:1:desc"`
+	Owner          string `json:"owner" index:"indexOwner:2,indexSizeSortDesc:3:desc"`
 	AppraisedValue int    `json:"appraisedValue"`
 }
 
@@ -103,6 +135,50 @@ type HistoryQueryResult struct {
 	IsDelete  bool      `json:"isDelete"`
 }
 
+// HistoryPage structure used for returning a page of history query results. If HasMore is true,
+// the next page is read by passing NextSkip as the skip of the next query.
+type HistoryPage struct {
+	Records             []HistoryQueryResult `json:"records"`
+	FetchedRecordsCount int                  `json:"fetchedRecordsCount"`
+	HasMore             bool                 `json:"hasMore"`
+	NextSkip            int                  `json:"nextSkip"`
+}
+
+// FieldChange structure used for returning a change to a field between two versions of an asset.
+// Values are formatted as strings, and are empty if the field had no value.
+type FieldChange struct {
+	Field    string `json:"field"`
+	OldValue string `json:"oldValue"`
+	NewValue string `json:"newValue"`
+}
+
+// HistoryDiff structure used for returning the fields changed by a transaction
+type HistoryDiff struct {
+	TxId      string        `json:"txId"`
+	Timestamp time.Time     `json:"timestamp"`
+	IsDelete  bool          `json:"isDelete"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// HistoryDiffPage structure used for returning a page of history diffs. If HasMore is true, the
+// next page is read by passing NextSkip as the skip of the next query.
+type HistoryDiffPage struct {
+	Records             []HistoryDiff `json:"records"`
+	FetchedRecordsCount int           `json:"fetchedRecordsCount"`
+	HasMore             bool          `json:"hasMore"`
+	NextSkip            int           `json:"nextSkip"`
+}
+
+// ColorTransferProgress structure used for returning the progress of a batched transfer by color.
+// If Done is false, the next batch is transferred by passing ContinuationKey as the startAfterKey.
+type ColorTransferProgress struct {
+	ProcessedCount      int    `json:"processedCount"`
+	TransferredCount    int    `json:"transferredCount"`
+	RemovedIndexEntries int    `json:"removedIndexEntries"`
+	ContinuationKey     string `json:"continuationKey"`
+	Done                bool   `json:"done"`
+}
+
 // PaginatedQueryResult structure used for returning paginated query results and metadata
 type PaginatedQueryResult struct {
 	Records             []*Asset `json:"records"`
@@ -150,7 +226,13 @@ func (t *SimpleChaincode) CreateAsset(ctx contractapi.TransactionContextInterfac
 	//  Save index entry to world state. Only the key name is needed, no need to store a duplicate copy of the asset.
 	//  Note - passing a 'nil' value will effectively delete the key from state, therefore we pass null character as value
 	value := []byte{0x00}
-	return ctx.GetStub().PutState(colorNameIndexKey, value)
+	err = ctx.GetStub().PutState(colorNameIndexKey, value)
+	if err != nil {
+		return err
+	}
+
+	//  Save the simple key color index entry used by TransferAssetByColorBatch
+	return ctx.GetStub().PutState(colorIndexKey(asset.Color, asset.ID), value)
 }
 
 // ReadAsset retrieves an asset from the ledger
@@ -184,13 +266,20 @@ func (t *SimpleChaincode) DeleteAsset(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed to delete asset %s: %v", assetID, err)
 	}
 
-	colorNameIndexKey, err := ctx.GetStub().CreateCompositeKey(index, []string{asset.Color, asset.ID})
-	if err != nil {
-		return err
-	}
+	// Delete index entries
+	return deleteColorIndexEntries(ctx, asset.Color, asset.ID)
+}
 
-	// Delete index entry
-	return ctx.GetStub().DelState(colorNameIndexKey)
+// colorIndexKey returns the simple key color index entry for an asset. The color and asset ID are
+// separated by a null character, so that the entries for a color are a contiguous key range.
+func colorIndexKey(color string, assetID string) string {
+	return colorIndexPrefix + color + "\x00" + assetID
+}
+
+// isColorIndexKey returns true if a key returned by a range query is a color index entry rather
+// than an asset. Range queries over all simple keys return both.
+func isColorIndexKey(key string) bool {
+	return strings.HasPrefix(key, colorIndexPrefix)
 }
 
 // TransferAsset transfers an asset by setting a new owner name on the asset
@@ -217,6 +306,9 @@ func constructQueryResponseFromIterator(resultsIterator shim.StateQueryIteratorI
 		if err != nil {
 			return nil, err
 		}
+		if isColorIndexKey(queryResult.Key) {
+			continue
+		}
 		var asset Asset
 		err = json.Unmarshal(queryResult.Value, &asset)
 		if err != nil {
@@ -252,6 +344,7 @@ func (t *SimpleChaincode) GetAssetsByRange(ctx contractapi.TransactionContextInt
 // between endorsement time and commit time. The transaction is invalidated by the
 // committing peers if the result set has changed between endorsement time and commit time.
 // Therefore, range queries are a safe option for performing update transactions based on query results.
+// A TransferAsset event is recorded for each transferred asset, and emitted in a single compound event.
 // Example: GetStateByPartialCompositeKey/RangeQuery
 func (t *SimpleChaincode) TransferAssetByColor(ctx contractapi.TransactionContextInterface, color, newOwner string) error {
 	// Execute a key range query on all keys starting with 'color'
@@ -261,6 +354,7 @@ func (t *SimpleChaincode) TransferAssetByColor(ctx contractapi.TransactionContex
 	}
 	defer coloredAssetResultsIterator.Close()
 
+	var transferred []*Asset
 	for coloredAssetResultsIterator.HasNext() {
 		responseRange, err := coloredAssetResultsIterator.Next()
 		if err != nil {
@@ -287,10 +381,137 @@ func (t *SimpleChaincode) TransferAssetByColor(ctx contractapi.TransactionContex
 			if err != nil {
 				return fmt.Errorf("transfer failed for asset %s: %v", returnedAssetID, err)
 			}
+			transferred = append(transferred, asset)
 		}
 	}
 
-	return nil
+	return emitTransferEvents(ctx, transferred)
+}
+
+// TransferAssetByColorBatch transfers at most maxAssets assets of a given color to a new owner,
+// starting after the asset ID startAfterKey, or from the first asset of the color if it is empty.
+// Unlike TransferAssetByColor, the write set of each transaction is bounded, so any number of
+// assets can be transferred by calling it repeatedly with the returned continuation key until done.
+// Each color index entry is checked against the asset it refers to; entries for assets that no
+// longer exist or have changed color are removed. Assets already owned by the new owner are not rewritten.
+// The shim rejects composite keys in GetStateByRange, and paginated queries cannot be used in
+// transactions that write, so the color~name composite key index cannot be read from a continuation
+// key. Instead, a range query over the simple key color index starts after startAfterKey, so each
+// batch reads only the entries it processes.
+// Committing peers re-execute the range query, so a batch is invalidated if another transaction
+// changes the assets of the color it read, and can be retried with the same startAfterKey.
+// Example: GetStateByRange/RangeQuery with a continuation key
+func (t *SimpleChaincode) TransferAssetByColorBatch(ctx contractapi.TransactionContextInterface, color, newOwner string, maxAssets int, startAfterKey string) (*ColorTransferProgress, error) {
+	if maxAssets <= 0 || maxAssets > maxColorTransferBatch {
+		return nil, fmt.Errorf("maxAssets must be between 1 and %d", maxColorTransferBatch)
+	}
+
+	// Entries of the color start after the null character separating the color from the asset ID.
+	// Appending a null character to startAfterKey gives the first key after it.
+	colorPrefix := colorIndexPrefix + color + "\x00"
+	startKey := colorPrefix
+	if startAfterKey != "" {
+		startKey = colorPrefix + startAfterKey + "\x00"
+	}
+	endKey := colorIndexPrefix + color + "\x01"
+
+	coloredAssetResultsIterator, err := ctx.GetStub().GetStateByRange(startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer coloredAssetResultsIterator.Close()
+
+	progress := &ColorTransferProgress{Done: true}
+	var transferred []*Asset
+	for coloredAssetResultsIterator.HasNext() {
+		if progress.ProcessedCount == maxAssets {
+			progress.Done = false
+			break
+		}
+
+		responseRange, err := coloredAssetResultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		returnedAssetID := strings.TrimPrefix(responseRange.Key, colorPrefix)
+		progress.ProcessedCount++
+		progress.ContinuationKey = returnedAssetID
+
+		assetBytes, err := ctx.GetStub().GetState(returnedAssetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read asset %s: %v", returnedAssetID, err)
+		}
+
+		var asset Asset
+		if assetBytes != nil {
+			err = json.Unmarshal(assetBytes, &asset)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if assetBytes == nil || asset.Color != color {
+			err = deleteColorIndexEntries(ctx, color, returnedAssetID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete stale index entry for asset %s: %v", returnedAssetID, err)
+			}
+			progress.RemovedIndexEntries++
+			continue
+		}
+
+		if asset.Owner == newOwner && asset.DocType == assetDocType {
+			continue
+		}
+
+		// Keep the docType used by the CouchDB owner index
+		asset.DocType = assetDocType
+		asset.Owner = newOwner
+		assetBytes, err = json.Marshal(asset)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.GetStub().PutState(returnedAssetID, assetBytes)
+		if err != nil {
+			return nil, fmt.Errorf("transfer failed for asset %s: %v", returnedAssetID, err)
+		}
+		progress.TransferredCount++
+		transferred = append(transferred, &asset)
+	}
+
+	if progress.Done {
+		progress.ContinuationKey = ""
+	}
+
+	err = emitTransferEvents(ctx, transferred)
+	if err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// deleteColorIndexEntries deletes the color~name and simple key color index entries of an asset.
+func deleteColorIndexEntries(ctx contractapi.TransactionContextInterface, color string, assetID string) error {
+	colorNameIndexKey, err := ctx.GetStub().CreateCompositeKey(index, []string{color, assetID})
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().DelState(colorNameIndexKey)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().DelState(colorIndexKey(color, assetID))
+}
+
+// emitTransferEvents records a TransferAsset event for each transferred asset, emitted together
+// in a single compound event.
+func emitTransferEvents(ctx contractapi.TransactionContextInterface, assets []*Asset) error {
+	var events eventBatch
+	for _, asset := range assets {
+		events.add(transferAssetEventName, asset)
+	}
+
+	return events.emit(ctx)
 }
 
 // QueryAssetsByOwner queries for assets based on the owners name.
@@ -299,14 +520,27 @@ func (t *SimpleChaincode) TransferAssetByColor(ctx contractapi.TransactionContex
 // Only available on state databases that support rich query (e.g. CouchDB)
 // Example: Parameterized rich query
 func (t *SimpleChaincode) QueryAssetsByOwner(ctx contractapi.TransactionContextInterface, owner string) ([]*Asset, error) {
-	queryString := fmt.Sprintf(`{"selector":{"docType":"asset","owner":"%s"}}`, owner)
+	ownerJSON, err := json.Marshal(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	// The query is built from a structured filter so that the owner cannot change the selector
+	queryString, err := buildAssetQuery(&AssetFilter{
+		Clauses: []FilterClause{{Field: "owner", Operator: "eq", Value: ownerJSON}},
+	}, 0)
+	if err != nil {
+		return nil, err
+	}
+
 	return getQueryResultForQueryString(ctx, queryString)
 }
 
 // QueryAssets uses a query string to perform a query for assets.
 // Query string matching state database syntax is passed in and executed as is.
 // Supports ad hoc queries that can be defined at runtime by the client.
-// If this is not desired, follow the QueryAssetsForOwner example for parameterized queries.
+// If this is not desired, follow the QueryAssetsForOwner example for parameterized queries,
+// or use QueryAssetsByFilter for structured queries checked by the chaincode.
 // Only available on state databases that support rich query (e.g. CouchDB)
 // Example: Ad hoc rich query
 func (t *SimpleChaincode) QueryAssets(ctx contractapi.TransactionContextInterface, queryString string) ([]*Asset, error) {
@@ -354,7 +588,8 @@ func (t *SimpleChaincode) GetAssetsByRangeWithPagination(ctx contractapi.Transac
 // for assets. Query string matching state database syntax is passed in and executed as is.
 // The number of fetched records would be equal to or lesser than the specified page size.
 // Supports ad hoc queries that can be defined at runtime by the client.
-// If this is not desired, follow the QueryAssetsForOwner example for parameterized queries.
+// If this is not desired, follow the QueryAssetsForOwner example for parameterized queries,
+// or use QueryAssetsByFilterWithPagination for structured queries checked by the chaincode.
 // Only available on state databases that support rich query (e.g. CouchDB)
 // Paginated queries are only valid for read only transactions.
 // Example: Pagination with Ad hoc Rich Query
@@ -402,28 +637,209 @@ func (t *SimpleChaincode) GetAssetHistory(ctx contractapi.TransactionContextInte
 			return nil, err
 		}
 
-		var asset Asset
-		if len(response.Value) > 0 {
-			err = json.Unmarshal(response.Value, &asset)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			asset = Asset{
-				ID: assetID,
-			}
+		record, err := newHistoryQueryResult(assetID, response)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	return records, nil
+}
+
+// GetAssetHistoryPaged returns a page of the chain of custody for an asset, in the order returned
+// by the ledger. Only records with a timestamp from fromTime (inclusive) to toTime (exclusive) are
+// returned; either may be empty for no bound, or an RFC 3339 timestamp. The first skip matching
+// records are skipped, and at most limit records are returned.
+// Example: GetAssetHistoryPaged("asset1", "2024-01-01T00:00:00Z", "", 10, 0)
+func (t *SimpleChaincode) GetAssetHistoryPaged(ctx contractapi.TransactionContextInterface, assetID string, fromTime string, toTime string, limit int, skip int) (*HistoryPage, error) {
+	log.Printf("GetAssetHistoryPaged: ID %v, from %v, to %v, limit %v, skip %v", assetID, fromTime, toTime, limit, skip)
+
+	if limit <= 0 || limit > maxHistoryPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxHistoryPageSize)
+	}
+	if skip < 0 {
+		return nil, fmt.Errorf("skip must not be negative")
+	}
+	from, err := parseOptionalTime("fromTime", fromTime)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parseOptionalTime("toTime", toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	page := &HistoryPage{Records: []HistoryQueryResult{}}
+	matched := 0
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		timestamp := response.Timestamp.AsTime()
+		if (!from.IsZero() && timestamp.Before(from)) || (!to.IsZero() && !timestamp.Before(to)) {
+			continue
+		}
+
+		matched++
+		if matched <= skip {
+			continue
+		}
+		if len(page.Records) == limit {
+			page.HasMore = true
+			break
 		}
 
-		record := HistoryQueryResult{
-			TxId:      response.TxId,
-			Timestamp: response.Timestamp.AsTime(),
-			Record:    &asset,
-			IsDelete:  response.IsDelete,
+		record, err := newHistoryQueryResult(assetID, response)
+		if err != nil {
+			return nil, err
 		}
-		records = append(records, record)
+		page.Records = append(page.Records, *record)
 	}
 
-	return records, nil
+	page.FetchedRecordsCount = len(page.Records)
+	page.NextSkip = skip + page.FetchedRecordsCount
+
+	return page, nil
+}
+
+// GetAssetHistoryDiff returns a page of the chain of custody for an asset, in the order returned
+// by the ledger (newest first), with the fields changed by each transaction rather than the full
+// asset. The changes of the first version, or of a version created after a delete, are from empty
+// values. The first skip records are skipped, and at most limit records are returned. Each change is
+// relative to the previous version, so the record following the page is also read, and the last
+// record of a page is compared with the first record of the next page.
+// Example: GetAssetHistoryDiff("asset1", 10, 0)
+func (t *SimpleChaincode) GetAssetHistoryDiff(ctx contractapi.TransactionContextInterface, assetID string, limit int, skip int) (*HistoryDiffPage, error) {
+	log.Printf("GetAssetHistoryDiff: ID %v, limit %v, skip %v", assetID, limit, skip)
+
+	if limit <= 0 || limit > maxHistoryPageSize {
+		return nil, fmt.Errorf("limit must be between 1 and %d", maxHistoryPageSize)
+	}
+	if skip < 0 {
+		return nil, fmt.Errorf("skip must not be negative")
+	}
+
+	resultsIterator, err := ctx.GetStub().GetHistoryForKey(assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	// Read the records of the page, followed by the previous version of the last record
+	var records []HistoryQueryResult
+	for read := 0; len(records) <= limit && resultsIterator.HasNext(); read++ {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		if read < skip {
+			continue
+		}
+
+		record, err := newHistoryQueryResult(assetID, response)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, *record)
+	}
+
+	page := &HistoryDiffPage{Records: []HistoryDiff{}}
+	for i := 0; i < len(records) && i < limit; i++ {
+		previous := &Asset{}
+		if i+1 < len(records) && !records[i+1].IsDelete {
+			previous = records[i+1].Record
+		}
+		current := records[i].Record
+		if records[i].IsDelete {
+			current = &Asset{}
+		}
+
+		page.Records = append(page.Records, HistoryDiff{
+			TxId:      records[i].TxId,
+			Timestamp: records[i].Timestamp,
+			IsDelete:  records[i].IsDelete,
+			Changes:   diffAssets(previous, current),
+		})
+	}
+
+	page.FetchedRecordsCount = len(page.Records)
+	page.HasMore = len(records) > limit
+	page.NextSkip = skip + page.FetchedRecordsCount
+
+	return page, nil
+}
+
+// newHistoryQueryResult creates a history query result from a ledger history record.
+func newHistoryQueryResult(assetID string, response *queryresult.KeyModification) (*HistoryQueryResult, error) {
+	var asset Asset
+	if len(response.Value) > 0 {
+		err := json.Unmarshal(response.Value, &asset)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		asset = Asset{
+			ID: assetID,
+		}
+	}
+
+	return &HistoryQueryResult{
+		TxId:      response.TxId,
+		Timestamp: response.Timestamp.AsTime(),
+		Record:    &asset,
+		IsDelete:  response.IsDelete,
+	}, nil
+}
+
+// diffAssets returns the fields, by JSON name, that differ between two versions of an asset.
+func diffAssets(previous *Asset, current *Asset) []FieldChange {
+	changes := []FieldChange{}
+
+	previousValue := reflect.ValueOf(*previous)
+	currentValue := reflect.ValueOf(*current)
+	assetType := previousValue.Type()
+	for i := 0; i < assetType.NumField(); i++ {
+		oldValue := formatFieldValue(previousValue.Field(i))
+		newValue := formatFieldValue(currentValue.Field(i))
+		if oldValue != newValue {
+			changes = append(changes, FieldChange{
+				Field:    assetType.Field(i).Tag.Get("json"),
+				OldValue: oldValue,
+				NewValue: newValue,
+			})
+		}
+	}
+
+	return changes
+}
+
+func formatFieldValue(value reflect.Value) string {
+	if value.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(value.Interface())
+}
+
+// parseOptionalTime parses an RFC 3339 timestamp, returning the zero time if the value is empty.
+func parseOptionalTime(name string, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp: %v", name, err)
+	}
+	return parsed, nil
 }
 
 // AssetExists returns true when asset with given ID exists in the ledger.
@@ -0,0 +1,413 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command indexgen generates the CouchDB index definitions packaged with the asset transfer ledger
+// queries chaincode from the index tags on chaincode struct fields, as described in the couchdbindex
+// package. It is run from the chaincode directory by go generate.
+//
+// With -check, no files are written. Instead, the command fails if the packaged index definitions
+// differ from the struct tags, if no index supports the query that the chaincode query builder
+// produces for a structured filter in the chaincode source, or if a query string in the chaincode
+// source names an index in use_index that is not packaged or does not support the query.
+//
+// Usage:
+//
+//	go run ./cmd/indexgen [-dir .] [-output META-INF/statedb/couchdb/indexes] [-check]
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-ledger-queries/chaincode-go/couchdbindex"
+)
+
+// filterTypeName is the type of the structured filters that the chaincode builds queries from
+const filterTypeName = "AssetFilter"
+
+// useIndexKey marks the JSON object string literals in the chaincode source that are checked as
+// CouchDB queries
+const useIndexKey = `"use_index"`
+
+// builderSelectorFields are the fields that buildAssetQuery adds to the selector of every query
+var builderSelectorFields = []string{"docType"}
+
+func main() {
+	dir := flag.String("dir", ".", "directory containing the chaincode source")
+	output := flag.String("output", filepath.Join("META-INF", "statedb", "couchdb", "indexes"), "directory of the packaged index definitions, relative to -dir")
+	check := flag.Bool("check", false, "check the packaged index definitions and chaincode filters instead of writing files")
+	flag.Parse()
+
+	fileSet := token.NewFileSet()
+	files, err := parseSource(fileSet, *dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing chaincode source: %v\n", err)
+		os.Exit(1)
+	}
+
+	indexes, err := indexesFromSource(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading index tags: %v\n", err)
+		os.Exit(1)
+	}
+
+	outputDir := filepath.Join(*dir, *output)
+	if !*check {
+		if err := writeIndexes(outputDir, indexes); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing index definitions: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	problems, err := checkIndexFiles(outputDir, indexes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error checking index definitions: %v\n", err)
+		os.Exit(1)
+	}
+	problems = append(problems, checkQueries(fileSet, files, indexes)...)
+
+	for _, problem := range problems {
+		fmt.Fprintln(os.Stderr, problem)
+	}
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parseSource parses the non-test Go files in a directory.
+func parseSource(fileSet *token.FileSet, dir string) ([]*ast.File, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var files []*ast.File
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fileSet, path, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+// indexesFromSource returns the indexes annotated on the fields of the struct types in the source files.
+func indexesFromSource(files []*ast.File) ([]couchdbindex.Index, error) {
+	var indexes []couchdbindex.Index
+	seen := map[string]string{}
+
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				structType, ok := typeSpec.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+
+				structIndexes, err := couchdbindex.Parse(taggedFields(structType))
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", typeSpec.Name.Name, err)
+				}
+				for _, index := range structIndexes {
+					if other, ok := seen[index.Name]; ok {
+						return nil, fmt.Errorf("index %s is annotated on both %s and %s", index.Name, other, typeSpec.Name.Name)
+					}
+					seen[index.Name] = typeSpec.Name.Name
+					indexes = append(indexes, index)
+				}
+			}
+		}
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+
+	return indexes, nil
+}
+
+// taggedFields returns the fields of a struct type that have an index tag.
+func taggedFields(structType *ast.StructType) []couchdbindex.Field {
+	var fields []couchdbindex.Field
+	for _, field := range structType.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tagValue, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			continue
+		}
+		tag := reflect.StructTag(tagValue)
+		indexTag, ok := tag.Lookup(couchdbindex.TagName)
+		if !ok {
+			continue
+		}
+		for _, name := range field.Names {
+			fields = append(fields, couchdbindex.Field{Name: couchdbindex.JSONName(name.Name, tag.Get("json")), Tag: indexTag})
+		}
+	}
+
+	return fields
+}
+
+func writeIndexes(outputDir string, indexes []couchdbindex.Index) error {
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		definition, err := index.Definition()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(outputDir, index.FileName()), append(definition, '\n'), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkIndexFiles returns problems with the packaged index definitions: generated indexes that are
+// missing or out of date, and packaged indexes that are not annotated on any struct.
+func checkIndexFiles(outputDir string, indexes []couchdbindex.Index) ([]string, error) {
+	var problems []string
+	generated := map[string]bool{}
+
+	for _, index := range indexes {
+		fileName := index.FileName()
+		generated[fileName] = true
+
+		definition, err := index.Definition()
+		if err != nil {
+			return nil, err
+		}
+
+		packaged, err := os.ReadFile(filepath.Join(outputDir, fileName))
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("index %s is not packaged in %s, run go generate", index.Name, outputDir))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		equal, err := equalJSON(definition, packaged)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fileName, err)
+		}
+		if !equal {
+			problems = append(problems, fmt.Sprintf("packaged index %s does not match the index tags, run go generate", fileName))
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(outputDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		if !generated[filepath.Base(path)] {
+			problems = append(problems, fmt.Sprintf("packaged index %s is not annotated on any struct field", filepath.Base(path)))
+		}
+	}
+
+	return problems, nil
+}
+
+// checkQueries returns problems with the structured filters and query strings in the source files.
+// Each AssetFilter composite literal is checked for a packaged index that supports the selector and
+// sort of the query that buildAssetQuery produces for it, and each string literal containing
+// use_index is checked as a CouchDB query. Filters passed to the chaincode by clients are checked by
+// buildAssetQuery when the query is built.
+func checkQueries(fileSet *token.FileSet, files []*ast.File, indexes []couchdbindex.Index) []string {
+	var problems []string
+
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			if stringLiteral, ok := node.(*ast.BasicLit); ok && stringLiteral.Kind == token.STRING {
+				if err := checkQueryString(stringLiteral, indexes); err != nil {
+					problems = append(problems, fmt.Sprintf("%s: %v", fileSet.Position(stringLiteral.Pos()), err))
+				}
+				return true
+			}
+
+			literal, ok := node.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			if typeName, ok := literal.Type.(*ast.Ident); !ok || typeName.Name != filterTypeName {
+				return true
+			}
+
+			selectorFields, sortFields, err := filterFields(literal)
+			if err == nil {
+				err = checkQuery(selectorFields, sortFields, indexes)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", fileSet.Position(literal.Pos()), err))
+			}
+			return true
+		})
+	}
+
+	return problems
+}
+
+// filterFields returns the selector fields and sort fields of the query built from a structured
+// filter literal.
+func filterFields(filter *ast.CompositeLit) ([]string, []couchdbindex.SortField, error) {
+	selectorFields := append([]string{}, builderSelectorFields...)
+	var sortFields []couchdbindex.SortField
+
+	for _, element := range filter.Elts {
+		keyValue, ok := element.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot check %s without field names", filterTypeName)
+		}
+		key, _ := keyValue.Key.(*ast.Ident)
+		if key == nil || (key.Name != "Clauses" && key.Name != "Sort") {
+			continue
+		}
+
+		entries, ok := keyValue.Value.(*ast.CompositeLit)
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot check %s, %s is not a composite literal", filterTypeName, key.Name)
+		}
+		for _, entry := range entries.Elts {
+			values, err := stringFields(entry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot check %s: %w", filterTypeName, err)
+			}
+			if key.Name == "Clauses" {
+				selectorFields = append(selectorFields, values["Field"])
+			} else {
+				sortFields = append(sortFields, couchdbindex.SortField{Name: values["Field"], Descending: values["Direction"] == "desc"})
+			}
+		}
+	}
+
+	return selectorFields, sortFields, nil
+}
+
+// stringFields returns the string literal fields of a struct literal, by field name.
+func stringFields(expr ast.Expr) (map[string]string, error) {
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil, fmt.Errorf("clause or sort is not a composite literal")
+	}
+
+	values := map[string]string{}
+	for _, element := range literal.Elts {
+		keyValue, ok := element.(*ast.KeyValueExpr)
+		if !ok {
+			return nil, fmt.Errorf("clause or sort without field names")
+		}
+		key, _ := keyValue.Key.(*ast.Ident)
+		if key == nil || (key.Name != "Field" && key.Name != "Direction") {
+			continue
+		}
+		value, ok := keyValue.Value.(*ast.BasicLit)
+		if !ok || value.Kind != token.STRING {
+			return nil, fmt.Errorf("%s is not a string literal", key.Name)
+		}
+		values[key.Name], _ = strconv.Unquote(value.Value)
+	}
+
+	return values, nil
+}
+
+// checkQueryString returns an error if a string literal containing use_index is not a CouchDB query,
+// or if the index it uses is not packaged or does not support its selector and sort.
+func checkQueryString(literal *ast.BasicLit, indexes []couchdbindex.Index) error {
+	queryString, err := strconv.Unquote(literal.Value)
+	if err != nil || !strings.HasPrefix(strings.TrimSpace(queryString), "{") || !strings.Contains(queryString, useIndexKey) {
+		return nil
+	}
+
+	query, err := couchdbindex.ParseQuery(queryString)
+	if err != nil {
+		return fmt.Errorf("cannot check query string: %w", err)
+	}
+	if query.UseIndexDesignDoc == "" {
+		return checkQuery(query.SelectorFields, query.SortFields, indexes)
+	}
+
+	found := false
+	for _, index := range indexes {
+		if index.DesignDoc != query.UseIndexDesignDoc || (query.UseIndexName != "" && index.Name != query.UseIndexName) {
+			continue
+		}
+		found = true
+		if index.Supports(query.SelectorFields, query.SortFields) {
+			return nil
+		}
+	}
+
+	useIndex := "_design/" + query.UseIndexDesignDoc
+	if query.UseIndexName != "" {
+		useIndex += " " + query.UseIndexName
+	}
+	if !found {
+		return fmt.Errorf("use_index %s is not a packaged index", useIndex)
+	}
+	return fmt.Errorf("use_index %s does not support a query on fields %s", useIndex, describeQuery(query.SelectorFields, query.SortFields))
+}
+
+// checkQuery returns an error if no index supports a query with the selector and sort fields.
+func checkQuery(selectorFields []string, sortFields []couchdbindex.SortField, indexes []couchdbindex.Index) error {
+	for _, index := range indexes {
+		if index.Supports(selectorFields, sortFields) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no packaged index supports a query on fields %s", describeQuery(selectorFields, sortFields))
+}
+
+// describeQuery returns the selector fields of a query, followed by its sort fields if it is sorted.
+func describeQuery(selectorFields []string, sortFields []couchdbindex.SortField) string {
+	sort.Strings(selectorFields)
+	description := strings.Join(selectorFields, ", ")
+	if len(sortFields) > 0 {
+		sortNames := make([]string, 0, len(sortFields))
+		for _, sortField := range sortFields {
+			sortNames = append(sortNames, sortField.String())
+		}
+		description += " sorted by " + strings.Join(sortNames, ", ")
+	}
+	return description
+}
+
+func equalJSON(a []byte, b []byte) (bool, error) {
+	var aValue, bValue interface{}
+	if err := json.Unmarshal(a, &aValue); err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, &bValue); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(aValue, bValue), nil
+}
@@ -0,0 +1,325 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+// Package couchdbindex reads CouchDB index annotations from struct field tags. The generated index
+// definitions are packaged with the chaincode in META-INF/statedb/couchdb/indexes, and the same
+// annotations are used by the chaincode to select an index for the queries it builds.
+//
+// A field is added to an index with an index tag containing the index name and the position of the
+// field in the index, optionally followed by desc for a descending index. A field can be in several
+// indexes, separated by commas:
+//
+//	Owner string `json:"owner" index:"indexOwner:2,indexSizeSortDesc:3:desc"`
+//
+// The design document of an index is the index name followed by Doc.
+package couchdbindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TagName is the struct tag key containing index annotations
+const TagName = "index"
+
+// Field is a struct field, by JSON name, with the value of its index tag.
+type Field struct {
+	Name string
+	Tag  string
+}
+
+// Index is a CouchDB index built from the tags of struct fields.
+type Index struct {
+	DesignDoc  string
+	Name       string
+	Fields     []string
+	Descending bool
+}
+
+// definition is the JSON format of a packaged CouchDB index.
+type definition struct {
+	Index struct {
+		Fields []interface{} `json:"fields"`
+	} `json:"index"`
+	DesignDoc string `json:"ddoc"`
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+}
+
+type indexField struct {
+	name       string
+	position   int
+	descending bool
+}
+
+// FromStruct returns the indexes annotated on the fields of a struct type, ordered by name.
+func FromStruct(structType reflect.Type) ([]Index, error) {
+	var fields []Field
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		tag, ok := field.Tag.Lookup(TagName)
+		if !ok {
+			continue
+		}
+		fields = append(fields, Field{Name: JSONName(field.Name, field.Tag.Get("json")), Tag: tag})
+	}
+
+	return Parse(fields)
+}
+
+// JSONName returns the name of a field in JSON, given the field name and the value of its json tag.
+func JSONName(fieldName string, jsonTag string) string {
+	name := strings.Split(jsonTag, ",")[0]
+	if name == "" {
+		return fieldName
+	}
+	return name
+}
+
+// Parse returns the indexes annotated on fields, ordered by name.
+func Parse(fields []Field) ([]Index, error) {
+	indexFields := map[string][]indexField{}
+	for _, field := range fields {
+		for _, annotation := range strings.Split(field.Tag, ",") {
+			indexName, parsed, err := parseAnnotation(field.Name, annotation)
+			if err != nil {
+				return nil, err
+			}
+			indexFields[indexName] = append(indexFields[indexName], parsed)
+		}
+	}
+
+	indexes := make([]Index, 0, len(indexFields))
+	for name, fields := range indexFields {
+		sort.Slice(fields, func(i, j int) bool {
+			return fields[i].position < fields[j].position
+		})
+
+		index := Index{DesignDoc: name + "Doc", Name: name, Descending: fields[0].descending}
+		for i, field := range fields {
+			if i > 0 && field.position == fields[i-1].position {
+				return nil, fmt.Errorf("fields %s and %s have the same position in index %s", fields[i-1].name, field.name, name)
+			}
+			if field.descending != index.Descending {
+				return nil, fmt.Errorf("all fields of index %s must have the same sort direction", name)
+			}
+			index.Fields = append(index.Fields, field.name)
+		}
+		indexes = append(indexes, index)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Name < indexes[j].Name
+	})
+
+	return indexes, nil
+}
+
+func parseAnnotation(fieldName string, annotation string) (string, indexField, error) {
+	parts := strings.Split(strings.TrimSpace(annotation), ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return "", indexField{}, fmt.Errorf("invalid index annotation %q on field %s, expected name:position[:desc]", annotation, fieldName)
+	}
+
+	position, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", indexField{}, fmt.Errorf("invalid position in index annotation %q on field %s", annotation, fieldName)
+	}
+
+	descending := false
+	if len(parts) == 3 {
+		if parts[2] != "desc" {
+			return "", indexField{}, fmt.Errorf("invalid sort direction in index annotation %q on field %s, expected desc", annotation, fieldName)
+		}
+		descending = true
+	}
+
+	return parts[0], indexField{name: fieldName, position: position, descending: descending}, nil
+}
+
+// FileName returns the name of the file containing the packaged index definition.
+func (index Index) FileName() string {
+	return index.Name + ".json"
+}
+
+// Definition returns the JSON index definition, as packaged in META-INF/statedb/couchdb/indexes.
+func (index Index) Definition() ([]byte, error) {
+	var result definition
+	for _, field := range index.Fields {
+		if index.Descending {
+			result.Index.Fields = append(result.Index.Fields, map[string]string{field: "desc"})
+		} else {
+			result.Index.Fields = append(result.Index.Fields, field)
+		}
+	}
+	result.DesignDoc = index.DesignDoc
+	result.Name = index.Name
+	result.Type = "json"
+
+	return json.Marshal(result)
+}
+
+// SortField is a field of a query sort, by JSON name, with its sort direction.
+type SortField struct {
+	Name       string
+	Descending bool
+}
+
+// String returns the field name, followed by desc if the field is sorted in descending order.
+func (field SortField) String() string {
+	if field.Descending {
+		return field.Name + " desc"
+	}
+	return field.Name
+}
+
+// Supports returns true if the index can be used for a query with a selector on the selector fields,
+// sorted by the sort fields. All of the index fields must be in the selector, and the sort fields must
+// be the leading index fields, in the same order as in the index and with the sort direction of the index.
+func (index Index) Supports(selectorFields []string, sortFields []SortField) bool {
+	if !containsAll(selectorFields, index.Fields) || len(sortFields) > len(index.Fields) {
+		return false
+	}
+	for i, sortField := range sortFields {
+		if sortField.Name != index.Fields[i] || sortField.Descending != index.Descending {
+			return false
+		}
+	}
+	return true
+}
+
+// Query is the part of a CouchDB query string that determines the indexes that can be used for it.
+// UseIndexDesignDoc and UseIndexName are the design document, without the _design/ prefix, and the
+// index name given by use_index, and are empty if the query does not specify them.
+type Query struct {
+	SelectorFields    []string
+	SortFields        []SortField
+	UseIndexDesignDoc string
+	UseIndexName      string
+}
+
+// ParseQuery parses a CouchDB query string. The selector fields are the fields at the top level of
+// the selector, and of any selectors combined with $and.
+func ParseQuery(queryString string) (*Query, error) {
+	var raw struct {
+		Selector map[string]json.RawMessage `json:"selector"`
+		Sort     []json.RawMessage          `json:"sort"`
+		UseIndex json.RawMessage            `json:"use_index"`
+	}
+	if err := json.Unmarshal([]byte(queryString), &raw); err != nil {
+		return nil, fmt.Errorf("invalid query: %w", err)
+	}
+	if raw.Selector == nil {
+		return nil, fmt.Errorf("query has no selector")
+	}
+
+	query := &Query{}
+	selectorFields, err := parseSelectorFields(raw.Selector)
+	if err != nil {
+		return nil, err
+	}
+	query.SelectorFields = selectorFields
+
+	for _, entry := range raw.Sort {
+		sortField, err := parseSortField(entry)
+		if err != nil {
+			return nil, err
+		}
+		query.SortFields = append(query.SortFields, sortField)
+	}
+
+	if len(raw.UseIndex) > 0 {
+		if err := query.parseUseIndex(raw.UseIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	return query, nil
+}
+
+func parseSelectorFields(selector map[string]json.RawMessage) ([]string, error) {
+	var fields []string
+	for name, value := range selector {
+		if name != "$and" {
+			if !strings.HasPrefix(name, "$") {
+				fields = append(fields, name)
+			}
+			continue
+		}
+
+		var selectors []map[string]json.RawMessage
+		if err := json.Unmarshal(value, &selectors); err != nil {
+			return nil, fmt.Errorf("$and must be an array of selectors")
+		}
+		for _, nested := range selectors {
+			nestedFields, err := parseSelectorFields(nested)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, nestedFields...)
+		}
+	}
+
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// parseSortField parses a sort entry, which is either a field name sorted in ascending order, or an
+// object with a single field name and its sort direction.
+func parseSortField(entry json.RawMessage) (SortField, error) {
+	var name string
+	if err := json.Unmarshal(entry, &name); err == nil {
+		return SortField{Name: name}, nil
+	}
+
+	var directions map[string]string
+	if err := json.Unmarshal(entry, &directions); err != nil || len(directions) != 1 {
+		return SortField{}, fmt.Errorf("invalid sort entry %s", entry)
+	}
+	for name, direction := range directions {
+		if direction != "asc" && direction != "desc" {
+			return SortField{}, fmt.Errorf("invalid sort direction %q for field %s", direction, name)
+		}
+		return SortField{Name: name, Descending: direction == "desc"}, nil
+	}
+	return SortField{}, nil
+}
+
+// parseUseIndex parses use_index, which is either a design document, or an array with a design
+// document and optionally an index name.
+func (query *Query) parseUseIndex(useIndex json.RawMessage) error {
+	var values []string
+	var designDoc string
+	if err := json.Unmarshal(useIndex, &designDoc); err == nil {
+		values = []string{designDoc}
+	} else if err := json.Unmarshal(useIndex, &values); err != nil || len(values) < 1 || len(values) > 2 {
+		return fmt.Errorf("use_index must be a design document, or an array of a design document and index name")
+	}
+
+	query.UseIndexDesignDoc = strings.TrimPrefix(values[0], "_design/")
+	if len(values) == 2 {
+		query.UseIndexName = values[1]
+	}
+	return nil
+}
+
+func containsAll(values []string, required []string) bool {
+	for _, r := range required {
+		found := false
+		for _, v := range values {
+			if v == r {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package couchdbindex
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type taggedAsset struct {
+	DocType string `json:"docType" index:"indexOwner:1,indexSizeSortDesc:2:desc"`
+	ID      string `json:"ID"`
+	Size    int    `json:"size" index:"indexSizeSortDesc:1:desc"`
+	Owner   string `json:"owner" index:"indexOwner:2,indexSizeSortDesc:3:desc"`
+}
+
+func TestFromStruct(t *testing.T) {
+	indexes, err := FromStruct(reflect.TypeOf(taggedAsset{}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Index{
+		{DesignDoc: "indexOwnerDoc", Name: "indexOwner", Fields: []string{"docType", "owner"}},
+		{DesignDoc: "indexSizeSortDescDoc", Name: "indexSizeSortDesc", Fields: []string{"size", "docType", "owner"}, Descending: true},
+	}
+	if !reflect.DeepEqual(indexes, expected) {
+		t.Errorf("expected %+v, got %+v", expected, indexes)
+	}
+}
+
+func TestParseInvalidAnnotations(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []Field
+		err    string
+	}{
+		{
+			name:   "missing position",
+			fields: []Field{{Name: "owner", Tag: "indexOwner"}},
+			err:    `invalid index annotation "indexOwner" on field owner, expected name:position[:desc]`,
+		},
+		{
+			name:   "invalid position",
+			fields: []Field{{Name: "owner", Tag: "indexOwner:first"}},
+			err:    `invalid position in index annotation "indexOwner:first" on field owner`,
+		},
+		{
+			name:   "invalid direction",
+			fields: []Field{{Name: "owner", Tag: "indexOwner:1:asc"}},
+			err:    `invalid sort direction in index annotation "indexOwner:1:asc" on field owner, expected desc`,
+		},
+		{
+			name:   "same position",
+			fields: []Field{{Name: "docType", Tag: "indexOwner:1"}, {Name: "owner", Tag: "indexOwner:1"}},
+			err:    "fields docType and owner have the same position in index indexOwner",
+		},
+		{
+			name:   "mixed directions",
+			fields: []Field{{Name: "docType", Tag: "indexOwner:1"}, {Name: "owner", Tag: "indexOwner:2:desc"}},
+			err:    "all fields of index indexOwner must have the same sort direction",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.fields)
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	ascending := Index{DesignDoc: "indexOwnerDoc", Name: "indexOwner", Fields: []string{"docType", "owner"}}
+	definition, err := ascending.Definition()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"index":{"fields":["docType","owner"]},"ddoc":"indexOwnerDoc","name":"indexOwner","type":"json"}`
+	if string(definition) != expected {
+		t.Errorf("expected %s, got %s", expected, definition)
+	}
+	if ascending.FileName() != "indexOwner.json" {
+		t.Errorf("unexpected file name %s", ascending.FileName())
+	}
+
+	descending := Index{DesignDoc: "indexSizeSortDescDoc", Name: "indexSizeSortDesc", Fields: []string{"size", "docType"}, Descending: true}
+	definition, err = descending.Definition()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = `{"index":{"fields":[{"size":"desc"},{"docType":"desc"}]},"ddoc":"indexSizeSortDescDoc","name":"indexSizeSortDesc","type":"json"}`
+	if string(definition) != expected {
+		t.Errorf("expected %s, got %s", expected, definition)
+	}
+}
+
+func TestSupports(t *testing.T) {
+	index := Index{Name: "indexSizeSortDesc", Fields: []string{"size", "docType", "owner"}, Descending: true}
+
+	tests := []struct {
+		name           string
+		selectorFields []string
+		sortFields     []SortField
+		supported      bool
+	}{
+		{"all fields", []string{"owner", "docType", "size"}, nil, true},
+		{"extra selector field", []string{"owner", "docType", "size", "color"}, nil, true},
+		{"missing selector field", []string{"docType", "size"}, nil, false},
+		{"leading sort field", []string{"owner", "docType", "size"}, []SortField{{Name: "size", Descending: true}}, true},
+		{"sort direction", []string{"owner", "docType", "size"}, []SortField{{Name: "size"}}, false},
+		{"sort order", []string{"owner", "docType", "size"}, []SortField{{Name: "docType", Descending: true}}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if supported := index.Supports(test.selectorFields, test.sortFields); supported != test.supported {
+				t.Errorf("expected %t, got %t", test.supported, supported)
+			}
+		})
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected Query
+	}{
+		{
+			name:  "design doc and index name",
+			query: `{"selector":{"docType":"asset","owner":"tom"},"use_index":["_design/indexOwnerDoc","indexOwner"]}`,
+			expected: Query{
+				SelectorFields:    []string{"docType", "owner"},
+				UseIndexDesignDoc: "indexOwnerDoc",
+				UseIndexName:      "indexOwner",
+			},
+		},
+		{
+			name:  "design doc only",
+			query: `{"selector":{"docType":{"$eq":"asset"},"owner":{"$eq":"tom"},"size":{"$gt":0}},"fields":["docType","owner","size"],"sort":[{"size":"desc"}],"use_index":"_design/indexSizeSortDescDoc"}`,
+			expected: Query{
+				SelectorFields:    []string{"docType", "owner", "size"},
+				SortFields:        []SortField{{Name: "size", Descending: true}},
+				UseIndexDesignDoc: "indexSizeSortDescDoc",
+			},
+		},
+		{
+			name:  "and selector with ascending sort",
+			query: `{"selector":{"$and":[{"docType":"asset"},{"owner":"tom"}]},"sort":["owner"]}`,
+			expected: Query{
+				SelectorFields: []string{"docType", "owner"},
+				SortFields:     []SortField{{Name: "owner"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := ParseQuery(test.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*query, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, *query)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		err   string
+	}{
+		{"invalid JSON", `{"selector":`, "invalid query"},
+		{"no selector", `{"use_index":"_design/indexOwnerDoc"}`, "query has no selector"},
+		{"invalid sort direction", `{"selector":{"owner":"tom"},"sort":[{"owner":"up"}]}`, `invalid sort direction "up" for field owner`},
+		{"invalid sort entry", `{"selector":{"owner":"tom"},"sort":[{"owner":"asc","size":"asc"}]}`, "invalid sort entry"},
+		{"invalid use_index", `{"selector":{"owner":"tom"},"use_index":["a","b","c"]}`, "use_index must be a design document"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseQuery(test.query)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Define names for chaincode events
+const (
+	transferAssetEventName = "TransferAsset"
+	compoundEventName      = "CompoundEvent"
+)
+
+// eventBatch collects the logical events of a transaction that updates several assets. Fabric
+// keeps only one chaincode event per transaction, so the events are emitted together as a single
+// CompoundEvent, {"events":[{"name":...,"payload":...}]}, which the asset-transfer-events Go
+// application splits back into individual events.
+type eventBatch struct {
+	Events []batchedEvent `json:"events"`
+}
+
+type batchedEvent struct {
+	Name    string      `json:"name"`
+	Payload interface{} `json:"payload"`
+}
+
+// add appends an event to the batch. The payload is encoded as JSON when the batch is emitted.
+func (batch *eventBatch) add(name string, payload interface{}) {
+	batch.Events = append(batch.Events, batchedEvent{Name: name, Payload: payload})
+}
+
+// emit sets the compound event of the transaction. Nothing is emitted if the batch is empty.
+func (batch *eventBatch) emit(ctx contractapi.TransactionContextInterface) error {
+	if len(batch.Events) == 0 {
+		return nil
+	}
+
+	eventJSON, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(compoundEventName, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
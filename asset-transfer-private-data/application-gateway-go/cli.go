@@ -0,0 +1,251 @@
+/*
+Copyright 2024 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// cliCommand holds the flags shared by all subcommands, and runs transactions as the client of
+// the selected organization profile.
+type cliCommand struct {
+	*flag.FlagSet
+	configPath    *string
+	org           *string
+	output        *string
+	transientJSON *string
+	transientFile *string
+	stdout        io.Writer
+}
+
+// commandResult is the output of a subcommand in JSON output mode.
+type commandResult struct {
+	Function      string          `json:"function"`
+	TransactionID string          `json:"transactionId,omitempty"`
+	BlockNumber   *uint64         `json:"blockNumber,omitempty"`
+	Result        json.RawMessage `json:"result"`
+}
+
+// commandError is the output of a failed subcommand in JSON output mode.
+type commandError struct {
+	Error   string        `json:"error"`
+	Details []errorDetail `json:"details,omitempty"`
+}
+
+type errorDetail struct {
+	Address string `json:"address"`
+	MSPID   string `json:"mspId"`
+	Message string `json:"message"`
+}
+
+func newCLICommand(name string) *cliCommand {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &cliCommand{
+		FlagSet:    flags,
+		configPath: flags.String("config", "", "org profiles config file; defaults to the Fabric test network Org1 and Org2 users"),
+		org:        flags.String("org", "org1", "name of the org profile used to connect"),
+		output:     flags.String("output", outputText, "output format: text or json"),
+		stdout:     os.Stdout,
+	}
+}
+
+// parse parses the subcommand arguments and checks the shared flags.
+func (cmd *cliCommand) parse(args []string) error {
+	if err := cmd.Parse(args); err != nil {
+		return err
+	}
+	if cmd.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", cmd.Args())
+	}
+	if *cmd.output != outputText && *cmd.output != outputJSON {
+		return fmt.Errorf("unknown output format %s, expected %s or %s", *cmd.output, outputText, outputJSON)
+	}
+	return nil
+}
+
+// transient returns the transient JSON passed using the -transient or -transient-file flags, or
+// the marshaled value created from the other flags if neither is set. The transient flags are
+// defined by subcommands that take transient data using transientFlags.
+func (cmd *cliCommand) transient(fromFlags func() (any, error)) ([]byte, error) {
+	if *cmd.transientJSON != "" && *cmd.transientFile != "" {
+		return nil, errors.New("only one of -transient and -transient-file can be set")
+	}
+
+	var data []byte
+	switch {
+	case *cmd.transientJSON != "":
+		data = []byte(*cmd.transientJSON)
+	case *cmd.transientFile != "":
+		fileData, err := os.ReadFile(*cmd.transientFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transient file: %w", err)
+		}
+		data = fileData
+	default:
+		value, err := fromFlags()
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(value)
+	}
+
+	if !json.Valid(data) {
+		return nil, errors.New("transient data is not valid JSON")
+	}
+	return data, nil
+}
+
+// profile returns the selected organization profile.
+func (cmd *cliCommand) profile() (*cliConfig, *orgProfile, error) {
+	config, err := loadConfig(*cmd.configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	profile, err := config.profile(*cmd.org)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return config, profile, nil
+}
+
+// contract connects to the Gateway as the selected organization.
+func (cmd *cliCommand) contract() (*client.Contract, func(), error) {
+	config, profile, err := cmd.profile()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gateway, closeGateway, err := profile.connect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return gateway.GetNetwork(config.Channel).GetContract(config.Chaincode), closeGateway, nil
+}
+
+// submit submits a transaction and waits for it to be committed.
+func (cmd *cliCommand) submit(function string, args []string, transientData transient) error {
+	contract, closeGateway, err := cmd.contract()
+	if err != nil {
+		return err
+	}
+	defer closeGateway()
+
+	cmd.printf("\n--> Submit Transaction: %s, args: %v\n", function, args)
+
+	result, commit, err := contract.SubmitAsync(function, client.WithArguments(args...), client.WithTransient(transientData))
+	if err != nil {
+		return err
+	}
+
+	commitStatus, err := commit.Status()
+	if err != nil {
+		return err
+	}
+	if !commitStatus.Successful {
+		return fmt.Errorf("transaction %s failed to commit with status code %d (%s)", commitStatus.TransactionID, int32(commitStatus.Code), commitStatus.Code)
+	}
+
+	cmd.printf("*** Transaction %s committed successfully in block %d\n", commitStatus.TransactionID, commitStatus.BlockNumber)
+	return cmd.printResult(commandResult{
+		Function:      function,
+		TransactionID: commitStatus.TransactionID,
+		BlockNumber:   &commitStatus.BlockNumber,
+		Result:        jsonResult(result),
+	})
+}
+
+// evaluate evaluates a transaction and prints the result.
+func (cmd *cliCommand) evaluate(function string, args ...string) error {
+	contract, closeGateway, err := cmd.contract()
+	if err != nil {
+		return err
+	}
+	defer closeGateway()
+
+	cmd.printf("\n--> Evaluate Transaction: %s, args: %v\n", function, args)
+
+	result, err := contract.EvaluateTransaction(function, args...)
+	if err != nil {
+		return err
+	}
+
+	return cmd.printResult(commandResult{
+		Function: function,
+		Result:   jsonResult(result),
+	})
+}
+
+// printf writes progress messages in text output mode.
+func (cmd *cliCommand) printf(format string, args ...any) {
+	if *cmd.output == outputText {
+		fmt.Fprintf(cmd.stdout, format, args...)
+	}
+}
+
+func (cmd *cliCommand) printResult(result commandResult) error {
+	if *cmd.output == outputJSON {
+		return json.NewEncoder(cmd.stdout).Encode(result)
+	}
+
+	if string(result.Result) == "null" {
+		fmt.Fprintln(cmd.stdout, "*** No result")
+		return nil
+	}
+	fmt.Fprintf(cmd.stdout, "*** Result: %s\n", formatJSON(result.Result))
+	return nil
+}
+
+// printError reports a failed subcommand, in JSON to standard output if JSON output was selected
+// so that scripts can parse it, or as text to standard error otherwise.
+func (cmd *cliCommand) printError(err error) {
+	if *cmd.output == outputJSON {
+		result := commandError{Error: err.Error()}
+		for _, detail := range status.Convert(err).Details() {
+			if detail, ok := detail.(*gateway.ErrorDetail); ok {
+				result.Details = append(result.Details, errorDetail{
+					Address: detail.GetAddress(),
+					MSPID:   detail.GetMspId(),
+					Message: detail.GetMessage(),
+				})
+			}
+		}
+		_ = json.NewEncoder(cmd.stdout).Encode(result)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "%sError: %v%s\n", Red, errorWithDetails(err), Reset)
+}
+
+// jsonResult returns a transaction result as JSON. Results that are not JSON, such as the string
+// representation of a boolean, are returned as a JSON string, and an empty result as null.
+func jsonResult(result []byte) json.RawMessage {
+	if len(result) == 0 {
+		return json.RawMessage("null")
+	}
+	if json.Valid(result) {
+		return result
+	}
+	quoted, _ := json.Marshal(string(result))
+	return quoted
+}
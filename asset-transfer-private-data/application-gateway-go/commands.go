@@ -0,0 +1,214 @@
+/*
+Copyright 2024 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// subcommand defines the flags of a subcommand, and returns the function that runs it once the
+// flags have been parsed.
+type subcommand struct {
+	name        string
+	description string
+	define      func(cmd *cliCommand) func() error
+}
+
+var subcommands = []subcommand{
+	{"create", "create an asset owned by the client", defineCreate},
+	{"read", "read an asset, or its transfer agreement", defineRead},
+	{"agree", "agree to buy an asset for its appraised value", defineAgree},
+	{"transfer", "transfer an asset to the buyer that agreed to buy it", defineTransfer},
+	{"delete", "delete an asset owned by the client", defineDelete},
+	{"purge", "purge the private data of an asset owned by the client", definePurge},
+	{"read-private", "read the private details of an asset from an org collection", defineReadPrivate},
+	{"range", "read assets with IDs in a range", defineRange},
+}
+
+func defineCreate(cmd *cliCommand) func() error {
+	cmd.transientJSON, cmd.transientFile = transientFlags(cmd, "asset_properties")
+	id := cmd.String("id", "", "asset ID")
+	assetType := cmd.String("type", "ValuableAsset", "asset object type")
+	color := cmd.String("color", "", "asset color")
+	size := cmd.Int("size", 0, "asset size")
+	value := cmd.Int("value", 0, "asset appraised value")
+
+	return func() error {
+		properties, err := cmd.transient(func() (any, error) {
+			if *id == "" {
+				return nil, errors.New("-id is required")
+			}
+			return struct {
+				ObjectType     string `json:"objectType"`
+				AssetID        string `json:"assetID"`
+				Color          string `json:"color"`
+				Size           int    `json:"size"`
+				AppraisedValue int    `json:"appraisedValue"`
+			}{*assetType, *id, *color, *size, *value}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return cmd.submit("CreateAsset", nil, transient{"asset_properties": properties})
+	}
+}
+
+func defineRead(cmd *cliCommand) func() error {
+	id := cmd.String("id", "", "asset ID")
+	agreement := cmd.Bool("agreement", false, "read the transfer agreement instead of the asset")
+
+	return func() error {
+		if *id == "" {
+			return errors.New("-id is required")
+		}
+		if *agreement {
+			return cmd.evaluate("ReadTransferAgreement", *id)
+		}
+		return cmd.evaluate("ReadAsset", *id)
+	}
+}
+
+func defineAgree(cmd *cliCommand) func() error {
+	cmd.transientJSON, cmd.transientFile = transientFlags(cmd, "asset_value")
+	id := cmd.String("id", "", "asset ID")
+	value := cmd.Int("value", 0, "agreed appraised value")
+	expires := cmd.String("expires", "", "agreement expiry as an RFC 3339 timestamp; defaults to the chaincode default")
+
+	return func() error {
+		assetValue, err := cmd.transient(func() (any, error) {
+			if *id == "" {
+				return nil, errors.New("-id is required")
+			}
+			return struct {
+				AssetID        string `json:"assetID"`
+				AppraisedValue int    `json:"appraisedValue"`
+			}{*id, *value}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		transientData := transient{"asset_value": assetValue}
+		if *expires != "" {
+			expiresAt, err := time.Parse(time.RFC3339, *expires)
+			if err != nil {
+				return errors.New("-expires must be an RFC 3339 timestamp")
+			}
+			transientData["agreement_terms"] = marshal(struct {
+				ExpiresAt time.Time `json:"expiresAt"`
+			}{expiresAt})
+		}
+
+		return cmd.submit("AgreeToTransfer", nil, transientData)
+	}
+}
+
+func defineTransfer(cmd *cliCommand) func() error {
+	cmd.transientJSON, cmd.transientFile = transientFlags(cmd, "asset_owner")
+	id := cmd.String("id", "", "asset ID")
+	buyerMSP := cmd.String("buyer-msp", "", "MSP ID of the buyer")
+	requireVerification := cmd.Bool("require-verification", false, "require both orgs to have verified each other's private details")
+	nonce := cmd.String("nonce", "", "nonce of the reviewed transfer agreement, to prevent transfer if it has been replaced")
+
+	return func() error {
+		assetOwner, err := cmd.transient(func() (any, error) {
+			if *id == "" || *buyerMSP == "" {
+				return nil, errors.New("-id and -buyer-msp are required")
+			}
+			return struct {
+				AssetID             string `json:"assetID"`
+				BuyerMSP            string `json:"buyerMSP"`
+				RequireVerification bool   `json:"requireVerification,omitempty"`
+				AgreementNonce      string `json:"agreementNonce,omitempty"`
+			}{*id, *buyerMSP, *requireVerification, *nonce}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return cmd.submit("TransferAsset", nil, transient{"asset_owner": assetOwner})
+	}
+}
+
+func defineDelete(cmd *cliCommand) func() error {
+	return defineAssetIDTransaction(cmd, "DeleteAsset", "asset_delete")
+}
+
+func definePurge(cmd *cliCommand) func() error {
+	return defineAssetIDTransaction(cmd, "PurgeAsset", "asset_purge")
+}
+
+// defineAssetIDTransaction defines a subcommand that submits a transaction taking only an asset
+// ID in its transient data.
+func defineAssetIDTransaction(cmd *cliCommand, function string, transientKey string) func() error {
+	cmd.transientJSON, cmd.transientFile = transientFlags(cmd, transientKey)
+	id := cmd.String("id", "", "asset ID")
+
+	return func() error {
+		assetID, err := cmd.transient(func() (any, error) {
+			if *id == "" {
+				return nil, errors.New("-id is required")
+			}
+			return struct {
+				AssetID string `json:"assetID"`
+			}{*id}, nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return cmd.submit(function, nil, transient{transientKey: assetID})
+	}
+}
+
+func defineReadPrivate(cmd *cliCommand) func() error {
+	id := cmd.String("id", "", "asset ID")
+	collection := cmd.String("collection", "", "collection to read; defaults to the private collection of the -org profile")
+
+	return func() error {
+		if *id == "" {
+			return errors.New("-id is required")
+		}
+
+		collectionName := *collection
+		if collectionName == "" {
+			_, profile, err := cmd.profile()
+			if err != nil {
+				return err
+			}
+			collectionName = profile.privateCollectionName()
+		}
+
+		return cmd.evaluate("ReadAssetPrivateDetails", collectionName, *id)
+	}
+}
+
+func defineRange(cmd *cliCommand) func() error {
+	start := cmd.String("start", "", "first asset ID in the range (inclusive)")
+	end := cmd.String("end", "", "last asset ID in the range (exclusive)")
+	pageSize := cmd.Int("page-size", 0, "number of assets in a page; if zero, the range is read without paging")
+	startAfter := cmd.String("start-after", "", "continuation key returned by the previous page")
+
+	return func() error {
+		if *pageSize > 0 {
+			return cmd.evaluate("GetAssetByRangePaged", *start, *end, strconv.Itoa(*pageSize), *startAfter)
+		}
+		if *startAfter != "" {
+			return errors.New("-start-after requires -page-size")
+		}
+		return cmd.evaluate("GetAssetByRange", *start, *end)
+	}
+}
+
+func transientFlags(cmd *cliCommand, transientKey string) (*string, *string) {
+	transientJSON := cmd.String("transient", "", transientKey+" transient data as JSON, used instead of the other flags")
+	transientFile := cmd.String("transient-file", "", "file containing "+transientKey+" transient data as JSON, used instead of the other flags")
+	return transientJSON, transientFile
+}
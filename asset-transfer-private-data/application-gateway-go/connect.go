@@ -12,6 +12,8 @@ import (
 	"os"
 	"path"
 
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/hash"
 	"github.com/hyperledger/fabric-gateway/pkg/identity"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -32,16 +34,53 @@ const (
 	peerNameOrg2          = "peer0.org2.example.com"
 )
 
+// connect creates a Gateway connection for the organization profile. The returned function closes
+// both the Gateway and the underlying gRPC connection.
+func (profile *orgProfile) connect() (*client.Gateway, func(), error) {
+	clientConnection, err := newGrpcConnection(profile.TLSCertPath, profile.PeerEndpoint, profile.PeerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := newIdentity(profile.CertDirectoryPath, profile.MSPID)
+	if err != nil {
+		clientConnection.Close()
+		return nil, nil, err
+	}
+
+	sign, err := newSign(profile.KeyDirectoryPath)
+	if err != nil {
+		clientConnection.Close()
+		return nil, nil, err
+	}
+
+	gateway, err := client.Connect(
+		id,
+		client.WithSign(sign),
+		client.WithClientConnection(clientConnection),
+		client.WithHash(hash.SHA256),
+	)
+	if err != nil {
+		clientConnection.Close()
+		return nil, nil, err
+	}
+
+	return gateway, func() {
+		gateway.Close()
+		clientConnection.Close()
+	}, nil
+}
+
 // newGrpcConnection creates a gRPC connection to the Gateway server.
-func newGrpcConnection(tlsCertPath, peerEndpoint, peerName string) *grpc.ClientConn {
+func newGrpcConnection(tlsCertPath, peerEndpoint, peerName string) (*grpc.ClientConn, error) {
 	certificatePEM, err := os.ReadFile(tlsCertPath)
 	if err != nil {
-		panic(fmt.Errorf("failed to read TLS certificate file: %w", err))
+		return nil, fmt.Errorf("failed to read TLS certificate file: %w", err)
 	}
 
 	certificate, err := identity.CertificateFromPEM(certificatePEM)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	certPool := x509.NewCertPool()
@@ -50,50 +89,40 @@ func newGrpcConnection(tlsCertPath, peerEndpoint, peerName string) *grpc.ClientC
 
 	connection, err := grpc.NewClient(peerEndpoint, grpc.WithTransportCredentials(transportCredentials))
 	if err != nil {
-		panic(fmt.Errorf("failed to create gRPC connection: %w", err))
+		return nil, fmt.Errorf("failed to create gRPC connection: %w", err)
 	}
 
-	return connection
+	return connection, nil
 }
 
 // newIdentity creates a client identity for this Gateway connection using an X.509 certificate.
-func newIdentity(certDirectoryPath, mspId string) *identity.X509Identity {
+func newIdentity(certDirectoryPath, mspId string) (*identity.X509Identity, error) {
 	certificatePEM, err := readFirstFile(certDirectoryPath)
 	if err != nil {
-		panic(fmt.Errorf("failed to read certificate file: %w", err))
+		return nil, fmt.Errorf("failed to read certificate file: %w", err)
 	}
 
 	certificate, err := identity.CertificateFromPEM(certificatePEM)
 	if err != nil {
-		panic(err)
-	}
-
-	id, err := identity.NewX509Identity(mspId, certificate)
-	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return id
+	return identity.NewX509Identity(mspId, certificate)
 }
 
 // newSign creates a function that generates a digital signature from a message digest using a private key.
-func newSign(keyDirectoryPash string) identity.Sign {
+func newSign(keyDirectoryPash string) (identity.Sign, error) {
 	privateKeyPEM, err := readFirstFile(keyDirectoryPash)
 	if err != nil {
-		panic(fmt.Errorf("failed to read private key file: %w", err))
+		return nil, fmt.Errorf("failed to read private key file: %w", err)
 	}
 
 	privateKey, err := identity.PrivateKeyFromPEM(privateKeyPEM)
 	if err != nil {
-		panic(err)
-	}
-
-	sign, err := identity.NewPrivateKeySign(privateKey)
-	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return sign
+	return identity.NewPrivateKeySign(privateKey)
 }
 
 func readFirstFile(dirPath string) ([]byte, error) {
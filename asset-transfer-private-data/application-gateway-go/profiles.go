@@ -0,0 +1,153 @@
+/*
+Copyright 2024 IBM All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// orgProfile describes how to connect to the network as a client of an organization.
+type orgProfile struct {
+	MSPID             string `json:"mspId"`
+	PeerEndpoint      string `json:"peerEndpoint"`
+	PeerName          string `json:"peerName"`
+	TLSCertPath       string `json:"tlsCertPath"`
+	CertDirectoryPath string `json:"certDirectoryPath"`
+	KeyDirectoryPath  string `json:"keyDirectoryPath"`
+}
+
+// cliConfig is the configuration file format, containing organization profiles by name.
+type cliConfig struct {
+	Channel   string                 `json:"channel"`
+	Chaincode string                 `json:"chaincode"`
+	Orgs      map[string]*orgProfile `json:"orgs"`
+}
+
+// defaultConfig returns profiles for the Org1 and Org2 users of the Fabric test network.
+func defaultConfig() *cliConfig {
+	return &cliConfig{
+		Channel:   "mychannel",
+		Chaincode: "private",
+		Orgs: map[string]*orgProfile{
+			"org1": {
+				MSPID:             "Org1MSP",
+				PeerEndpoint:      peerEndpointOrg1,
+				PeerName:          peerNameOrg1,
+				TLSCertPath:       tlsCertPathOrg1,
+				CertDirectoryPath: certDirectoryPathOrg1,
+				KeyDirectoryPath:  keyDirectoryPathOrg1,
+			},
+			"org2": {
+				MSPID:             "Org2MSP",
+				PeerEndpoint:      peerEndpointOrg2,
+				PeerName:          peerNameOrg2,
+				TLSCertPath:       tlsCertPathOrg2,
+				CertDirectoryPath: certDirectoryPathOrg2,
+				KeyDirectoryPath:  keyDirectoryPathOrg2,
+			},
+		},
+	}
+}
+
+// loadConfig reads a configuration file, or returns the default configuration if the path is
+// empty. Relative file paths in profiles are resolved against the directory of the configuration file.
+func loadConfig(path string) (*cliConfig, error) {
+	if path == "" {
+		return defaultConfig(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	config := &cliConfig{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	defaults := defaultConfig()
+	if config.Channel == "" {
+		config.Channel = defaults.Channel
+	}
+	if config.Chaincode == "" {
+		config.Chaincode = defaults.Chaincode
+	}
+	if len(config.Orgs) == 0 {
+		return nil, fmt.Errorf("config file %s contains no org profiles", path)
+	}
+
+	baseDir := filepath.Dir(path)
+	for name, profile := range config.Orgs {
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %s: %w", name, err)
+		}
+		profile.TLSCertPath = resolvePath(baseDir, profile.TLSCertPath)
+		profile.CertDirectoryPath = resolvePath(baseDir, profile.CertDirectoryPath)
+		profile.KeyDirectoryPath = resolvePath(baseDir, profile.KeyDirectoryPath)
+	}
+
+	return config, nil
+}
+
+// profile returns the named organization profile.
+func (config *cliConfig) profile(name string) (*orgProfile, error) {
+	profile, ok := config.Orgs[name]
+	if !ok {
+		names := make([]string, 0, len(config.Orgs))
+		for name := range config.Orgs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("no org profile named %s, available profiles: %s", name, strings.Join(names, ", "))
+	}
+
+	return profile, nil
+}
+
+func (profile *orgProfile) validate() error {
+	var missing []string
+	for field, value := range map[string]string{
+		"mspId":             profile.MSPID,
+		"peerEndpoint":      profile.PeerEndpoint,
+		"peerName":          profile.PeerName,
+		"tlsCertPath":       profile.TLSCertPath,
+		"certDirectoryPath": profile.CertDirectoryPath,
+		"keyDirectoryPath":  profile.KeyDirectoryPath,
+	} {
+		if value == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return errors.New("missing " + strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// privateCollectionName returns the name of the organization's private data collection.
+func (profile *orgProfile) privateCollectionName() string {
+	return profile.MSPID + "PrivateCollection"
+}
+
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
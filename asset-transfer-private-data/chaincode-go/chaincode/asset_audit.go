@@ -0,0 +1,133 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package chaincode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const auditRecordObjectType = "assetAudit"
+
+// Audited operations that remove private data
+const (
+	AuditOperationDelete = "DeleteAsset"
+	AuditOperationPurge  = "PurgeAsset"
+)
+
+// AuditRecord is a public record, written to the world state, of an operation that removed the
+// private data of an asset. The hashes are of the private data before it was removed, and are
+// empty if the data did not exist. The record is kept in the world state, rather than a collection,
+// so that it can be read by any channel member and is not removed by blockToLive. It is endorsed
+// under the chaincode endorsement policy, OR('Org1MSP.peer','Org2MSP.peer') in this sample.
+type AuditRecord struct {
+	ID                       string    `json:"assetID"`
+	Operation                string    `json:"operation"`
+	TxID                     string    `json:"txID"`
+	ClientID                 string    `json:"clientID"`
+	ClientMSP                string    `json:"clientMSP"`
+	Timestamp                time.Time `json:"timestamp"`
+	AssetHash                string    `json:"assetHash"`
+	PrivateDetailsCollection string    `json:"privateDetailsCollection"`
+	PrivateDetailsHash       string    `json:"privateDetailsHash"`
+}
+
+// GetAssetAuditTrail returns the audit records of the operations that removed the private data of
+// an asset, in transaction order. The audit trail is public, so it can be read by any channel member.
+func (s *SmartContract) GetAssetAuditTrail(ctx contractapi.TransactionContextInterface, assetID string) ([]*AuditRecord, error) {
+	log.Printf("GetAssetAuditTrail: ID %v", assetID)
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(auditRecordObjectType, []string{assetID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	records := []*AuditRecord{}
+	for resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var record *AuditRecord
+		err = json.Unmarshal(response.Value, &record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		records = append(records, record)
+	}
+
+	// Keys are ordered by transaction ID, so order the records by time
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+
+	return records, nil
+}
+
+// writeAuditRecord is an internal helper function used to record an operation that removes the
+// private data of an asset. It must be called before the private data is removed.
+func writeAuditRecord(ctx contractapi.TransactionContextInterface, operation string, assetID string, ownerCollection string) error {
+	clientID, err := submittingClientIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	assetHash, err := ctx.GetStub().GetPrivateDataHash(assetCollection, assetID)
+	if err != nil {
+		return fmt.Errorf("failed to get hash of asset from collection %v: %v", assetCollection, err)
+	}
+	privateDetailsHash, err := ctx.GetStub().GetPrivateDataHash(ownerCollection, assetID)
+	if err != nil {
+		return fmt.Errorf("failed to get hash of private details from collection %v: %v", ownerCollection, err)
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	record := AuditRecord{
+		ID:                       assetID,
+		Operation:                operation,
+		TxID:                     txID,
+		ClientID:                 clientID,
+		ClientMSP:                clientMSPID,
+		Timestamp:                now.UTC(),
+		AssetHash:                hex.EncodeToString(assetHash),
+		PrivateDetailsCollection: ownerCollection,
+		PrivateDetailsHash:       hex.EncodeToString(privateDetailsHash),
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit record into JSON: %v", err)
+	}
+
+	auditKey, err := ctx.GetStub().CreateCompositeKey(auditRecordObjectType, []string{assetID, txID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	log.Printf("%v audit: ID %v, Key %v", operation, assetID, auditKey)
+	err = ctx.GetStub().PutState(auditKey, recordJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put audit record: %v", err)
+	}
+
+	return nil
+}
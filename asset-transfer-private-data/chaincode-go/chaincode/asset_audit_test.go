@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+package chaincode_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-private-data/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-private-data/chaincode-go/chaincode/mocks"
+	"github.com/stretchr/testify/require"
+)
+
+const auditRecordObjectType = "assetAudit"
+
+func TestDeleteAssetWritesAuditRecord(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+	chaincodeStub.GetTransientReturns(map[string][]byte{"asset_delete": []byte(`{"assetID":"id1"}`)}, nil)
+	setReturnPrivateDataInStub(t, chaincodeStub, &chaincode.Asset{ID: "id1", Owner: myOrg1Clientid})
+	chaincodeStub.GetTxIDReturns("tx1")
+	chaincodeStub.CreateCompositeKeyReturns(auditRecordObjectType+"id1tx1", nil)
+	chaincodeStub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+		if key != "id1" {
+			return nil, nil
+		}
+		return []byte(collection + "hash"), nil
+	}
+
+	err := assetTransferCC.DeleteAsset(transactionContext)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, chaincodeStub.PutPrivateDataCallCount())
+	require.Equal(t, 1, chaincodeStub.PutStateCallCount())
+	calledKey, calledWithBytes := chaincodeStub.PutStateArgsForCall(0)
+	require.Equal(t, auditRecordObjectType+"id1tx1", calledKey)
+	expectedRecord, err := json.Marshal(chaincode.AuditRecord{
+		ID:                       "id1",
+		Operation:                chaincode.AuditOperationDelete,
+		TxID:                     "tx1",
+		ClientID:                 myOrg1Clientid,
+		ClientMSP:                myOrg1Msp,
+		Timestamp:                txTime,
+		AssetHash:                hex.EncodeToString([]byte(assetCollectionName + "hash")),
+		PrivateDetailsCollection: myOrg1PrivCollection,
+		PrivateDetailsHash:       hex.EncodeToString([]byte(myOrg1PrivCollection + "hash")),
+	})
+	require.NoError(t, err)
+	require.Equal(t, expectedRecord, calledWithBytes)
+	require.Equal(t, 2, chaincodeStub.DelPrivateDataCallCount())
+}
+
+func TestPurgeAssetWritesAuditRecord(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+	chaincodeStub.GetTransientReturns(map[string][]byte{"asset_purge": []byte(`{"assetID":"id1"}`)}, nil)
+	chaincodeStub.GetTxIDReturns("tx1")
+
+	// Data deleted before the purge has no hash
+	err := assetTransferCC.PurgeAsset(transactionContext)
+	require.NoError(t, err)
+
+	require.Equal(t, 0, chaincodeStub.PutPrivateDataCallCount())
+	require.Equal(t, 1, chaincodeStub.PutStateCallCount())
+	_, calledWithBytes := chaincodeStub.PutStateArgsForCall(0)
+	var record chaincode.AuditRecord
+	require.NoError(t, json.Unmarshal(calledWithBytes, &record))
+	require.Equal(t, chaincode.AuditOperationPurge, record.Operation)
+	require.Equal(t, "", record.AssetHash)
+	require.Equal(t, "", record.PrivateDetailsHash)
+	require.Equal(t, 2, chaincodeStub.PurgePrivateDataCallCount())
+}
+
+func TestGetAssetAuditTrail(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+
+	deleteRecord := &chaincode.AuditRecord{ID: "id1", Operation: chaincode.AuditOperationDelete, TxID: "txb", Timestamp: txTime}
+	purgeRecord := &chaincode.AuditRecord{ID: "id1", Operation: chaincode.AuditOperationPurge, TxID: "txa", Timestamp: txTime.Add(time.Minute)}
+	deleteBytes, err := json.Marshal(deleteRecord)
+	require.NoError(t, err)
+	purgeBytes, err := json.Marshal(purgeRecord)
+	require.NoError(t, err)
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturnsOnCall(0, true)
+	iterator.HasNextReturnsOnCall(1, true)
+	iterator.HasNextReturnsOnCall(2, false)
+	iterator.NextReturnsOnCall(0, &queryresult.KV{Value: purgeBytes}, nil)
+	iterator.NextReturnsOnCall(1, &queryresult.KV{Value: deleteBytes}, nil)
+	chaincodeStub.GetStateByPartialCompositeKeyReturns(iterator, nil)
+
+	records, err := assetTransferCC.GetAssetAuditTrail(transactionContext, "id1")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.AuditRecord{deleteRecord, purgeRecord}, records)
+	objectType, attributes := chaincodeStub.GetStateByPartialCompositeKeyArgsForCall(0)
+	require.Equal(t, auditRecordObjectType, objectType)
+	require.Equal(t, []string{"id1"}, attributes)
+}
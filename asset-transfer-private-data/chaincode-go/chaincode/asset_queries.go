@@ -11,9 +11,24 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
 
+// maxQueryResults is the largest number of assets returned by a query that is not paged
+const maxQueryResults = 1000
+
+// maxPageSize is the largest page size accepted by paged queries
+const maxPageSize = 100
+
+// PagedQueryResult is a page of assets returned by a paged query. NextStartAfterKey is passed
+// as startAfterKey to read the next page, and is empty once the last page has been read.
+type PagedQueryResult struct {
+	Records             []*Asset `json:"records"`
+	FetchedRecordsCount int      `json:"fetchedRecordsCount"`
+	NextStartAfterKey   string   `json:"nextStartAfterKey"`
+}
+
 // ReadAsset reads the information from collection
 func (s *SmartContract) ReadAsset(ctx contractapi.TransactionContextInterface, assetID string) (*Asset, error) {
 
@@ -69,53 +84,138 @@ func (s *SmartContract) ReadTransferAgreement(ctx contractapi.TransactionContext
 		return nil, fmt.Errorf("failed to create composite key: %v", err)
 	}
 
-	buyerIdentity, err := ctx.GetStub().GetPrivateData(assetCollection, transferAgreeKey) // Get the identity from collection
+	agreementJSON, err := ctx.GetStub().GetPrivateData(assetCollection, transferAgreeKey) // Get the agreement from collection
 	if err != nil {
 		return nil, fmt.Errorf("failed to read TransferAgreement: %v", err)
 	}
-	if buyerIdentity == nil {
+	if len(agreementJSON) == 0 {
 		log.Printf("TransferAgreement for %v does not exist", assetID)
 		return nil, nil
 	}
-	agreement := &TransferAgreement{
-		ID:      assetID,
-		BuyerID: string(buyerIdentity),
+
+	var agreement *TransferAgreement
+	err = json.Unmarshal(agreementJSON, &agreement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
 	}
 	return agreement, nil
 }
 
-// GetAssetByRange performs a range query based on the start and end keys provided. Range
-// queries can be used to read data from private data collections, but can not be used in
-// a transaction that also writes to private data.
-func (s *SmartContract) GetAssetByRange(ctx contractapi.TransactionContextInterface, startKey string, endKey string) ([]*Asset, error) {
+// ExpiredAgreementsPage is a page of expired transfer agreements returned by QueryExpiredAgreements.
+// FetchedRecordsCount is the number of agreements read for the page, of which only the expired
+// agreements are included in Records. NextStartAfterKey is passed as startAfterKey to read the next
+// page, and is empty once the last page has been read.
+type ExpiredAgreementsPage struct {
+	Records             []*TransferAgreement `json:"records"`
+	FetchedRecordsCount int                  `json:"fetchedRecordsCount"`
+	NextStartAfterKey   string               `json:"nextStartAfterKey"`
+}
 
-	resultsIterator, err := ctx.GetStub().GetPrivateDataByRange(assetCollection, startKey, endKey)
+// QueryExpiredAgreements returns the transfer agreements that have expired at the time of the
+// transaction, so that asset owners can delete them using DeleteTranferAgreement. At most pageSize
+// agreements with keys after startAfterKey are read; an empty startAfterKey reads the first page.
+// Range queries do not accept composite keys, so the agreements up to startAfterKey are skipped
+// rather than excluded by the query.
+func (s *SmartContract) QueryExpiredAgreements(ctx contractapi.TransactionContextInterface, pageSize int, startAfterKey string) (*ExpiredAgreementsPage, error) {
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(assetCollection, transferAgreementObjectType, []string{})
 	if err != nil {
 		return nil, err
 	}
 	defer resultsIterator.Close()
 
-	results := []*Asset{}
+	page := &ExpiredAgreementsPage{Records: []*TransferAgreement{}}
 
-	for resultsIterator.HasNext() {
+	var lastKey string
+	for page.FetchedRecordsCount < pageSize && resultsIterator.HasNext() {
 		response, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
+		if response.Key <= startAfterKey {
+			continue
+		}
 
-		var asset *Asset
-		err = json.Unmarshal(response.Value, &asset)
+		var agreement *TransferAgreement
+		err = json.Unmarshal(response.Value, &agreement)
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
 		}
 
-		results = append(results, asset)
+		page.FetchedRecordsCount++
+		lastKey = response.Key
+		if !now.Before(agreement.ExpiresAt) {
+			page.Records = append(page.Records, agreement)
+		}
+	}
+
+	if resultsIterator.HasNext() {
+		page.NextStartAfterKey = lastKey
+	}
+
+	return page, nil
+}
+
+// GetAssetByRange performs a range query based on the start and end keys provided. Range
+// queries can be used to read data from private data collections, but can not be used in
+// a transaction that also writes to private data.
+// At most maxQueryResults assets are returned; use GetAssetByRangePaged for larger result sets.
+func (s *SmartContract) GetAssetByRange(ctx contractapi.TransactionContextInterface, startKey string, endKey string) ([]*Asset, error) {
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByRange(assetCollection, startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	results, err := constructAssetsFromIterator(resultsIterator, maxQueryResults)
+	if err != nil {
+		return nil, err
+	}
+	if resultsIterator.HasNext() {
+		return nil, fmt.Errorf("range query returned more than %v assets, use GetAssetByRangePaged instead", maxQueryResults)
 	}
 
 	return results, nil
 
 }
 
+// GetAssetByRangePaged performs a range query based on the start and end keys provided, returning
+// at most pageSize assets with keys after startAfterKey. Private data collections do not support
+// bookmarks, so the result includes the key to pass as startAfterKey to read the next page. An
+// empty startAfterKey reads the first page.
+func (s *SmartContract) GetAssetByRangePaged(ctx contractapi.TransactionContextInterface, startKey string, endKey string, pageSize int, startAfterKey string) (*PagedQueryResult, error) {
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Append the lowest possible character to start reading at the key following startAfterKey
+	if startAfterKey != "" && startAfterKey+"\x00" > startKey {
+		startKey = startAfterKey + "\x00"
+	}
+	if endKey != "" && startKey >= endKey {
+		return &PagedQueryResult{Records: []*Asset{}}, nil
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataByRange(assetCollection, startKey, endKey)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructPagedQueryResult(resultsIterator, pageSize)
+}
+
 // =======Rich queries =========================================================================
 // Two examples of rich queries are provided below (parameterized query and ad hoc query).
 // Rich queries pass a query string to the state database.
@@ -152,6 +252,7 @@ func (s *SmartContract) QueryAssetByOwner(ctx contractapi.TransactionContextInte
 // Supports ad hoc queries that can be defined at runtime by the client.
 // If this is not desired, follow the QueryAssetByOwner example for parameterized queries.
 // Only available on state databases that support rich query (e.g. CouchDB)
+// At most maxQueryResults assets are returned; use QueryAssetsPaged for larger result sets.
 func (s *SmartContract) QueryAssets(ctx contractapi.TransactionContextInterface, queryString string) ([]*Asset, error) {
 
 	queryResults, err := s.getQueryResultForQueryString(ctx, queryString)
@@ -161,6 +262,31 @@ func (s *SmartContract) QueryAssets(ctx contractapi.TransactionContextInterface,
 	return queryResults, nil
 }
 
+// QueryAssetsPaged uses a query string to perform a query for assets, returning at most pageSize
+// assets with keys after startAfterKey. Results are ordered by key, so the query string must not
+// specify a sort. The result includes the key to pass as startAfterKey to read the next page. An
+// empty startAfterKey reads the first page.
+// Only available on state databases that support rich query (e.g. CouchDB)
+func (s *SmartContract) QueryAssetsPaged(ctx contractapi.TransactionContextInterface, queryString string, pageSize int, startAfterKey string) (*PagedQueryResult, error) {
+	err := validatePageSize(pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	pagedQueryString, err := pagedQuery(queryString, pageSize, startAfterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetPrivateDataQueryResult(assetCollection, pagedQueryString)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	return constructPagedQueryResult(resultsIterator, pageSize)
+}
+
 // getQueryResultForQueryString executes the passed in query string.
 func (s *SmartContract) getQueryResultForQueryString(ctx contractapi.TransactionContextInterface, queryString string) ([]*Asset, error) {
 
@@ -170,15 +296,28 @@ func (s *SmartContract) getQueryResultForQueryString(ctx contractapi.Transaction
 	}
 	defer resultsIterator.Close()
 
+	results, err := constructAssetsFromIterator(resultsIterator, maxQueryResults)
+	if err != nil {
+		return nil, err
+	}
+	if resultsIterator.HasNext() {
+		return nil, fmt.Errorf("query returned more than %v assets, use QueryAssetsPaged instead", maxQueryResults)
+	}
+
+	return results, nil
+}
+
+// constructAssetsFromIterator reads at most limit assets from the results iterator.
+func constructAssetsFromIterator(resultsIterator shim.StateQueryIteratorInterface, limit int) ([]*Asset, error) {
 	results := []*Asset{}
 
-	for resultsIterator.HasNext() {
+	for len(results) < limit && resultsIterator.HasNext() {
 		response, err := resultsIterator.Next()
 		if err != nil {
 			return nil, err
 		}
-		var asset *Asset
 
+		var asset *Asset
 		err = json.Unmarshal(response.Value, &asset)
 		if err != nil {
 			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
@@ -186,5 +325,84 @@ func (s *SmartContract) getQueryResultForQueryString(ctx contractapi.Transaction
 
 		results = append(results, asset)
 	}
+
 	return results, nil
 }
+
+// constructPagedQueryResult reads a page of at most pageSize assets from the results iterator.
+// The continuation key is set only if the iterator has further results.
+func constructPagedQueryResult(resultsIterator shim.StateQueryIteratorInterface, pageSize int) (*PagedQueryResult, error) {
+	result := &PagedQueryResult{Records: []*Asset{}}
+
+	var lastKey string
+	for len(result.Records) < pageSize && resultsIterator.HasNext() {
+		response, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var asset *Asset
+		err = json.Unmarshal(response.Value, &asset)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+
+		result.Records = append(result.Records, asset)
+		lastKey = response.Key
+	}
+
+	result.FetchedRecordsCount = len(result.Records)
+	if resultsIterator.HasNext() {
+		result.NextStartAfterKey = lastKey
+	}
+
+	return result, nil
+}
+
+// validatePageSize checks that a page size is between 1 and maxPageSize.
+func validatePageSize(pageSize int) error {
+	if pageSize <= 0 || pageSize > maxPageSize {
+		return fmt.Errorf("pageSize must be between 1 and %v", maxPageSize)
+	}
+	return nil
+}
+
+// pagedQuery rewrites a query string to return results ordered by key, starting after
+// startAfterKey, and limited to one more result than the page size so that the presence of
+// a further page can be detected without reading the whole result set.
+func pagedQuery(queryString string, pageSize int, startAfterKey string) (string, error) {
+	var query map[string]interface{}
+	err := json.Unmarshal([]byte(queryString), &query)
+	if err != nil {
+		return "", fmt.Errorf("failed to unmarshal query string: %v", err)
+	}
+
+	selector, ok := query["selector"]
+	if !ok {
+		return "", fmt.Errorf("query string must contain a selector")
+	}
+	if _, ok := query["sort"]; ok {
+		return "", fmt.Errorf("paged query results are ordered by key, query string must not contain a sort")
+	}
+	if _, ok := query["bookmark"]; ok {
+		return "", fmt.Errorf("paged queries use startAfterKey, query string must not contain a bookmark")
+	}
+
+	if startAfterKey != "" {
+		query["selector"] = map[string]interface{}{
+			"$and": []interface{}{
+				selector,
+				map[string]interface{}{"_id": map[string]interface{}{"$gt": startAfterKey}},
+			},
+		}
+	}
+	query["sort"] = []interface{}{map[string]interface{}{"_id": "asc"}}
+	query["limit"] = pageSize + 1
+
+	pagedQueryJSON, err := json.Marshal(query)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal paged query: %v", err)
+	}
+
+	return string(pagedQueryJSON), nil
+}
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
 
@@ -77,11 +78,14 @@ func TestReadTransferAgreement(t *testing.T) {
 	require.NoError(t, err)
 	require.Nil(t, assetBytes)
 
-	chaincodeStub.GetPrivateDataReturns([]byte(myOrg2Clientid), nil)
 	expectedData := &chaincode.TransferAgreement{
-		ID:      "id1",
-		BuyerID: myOrg2Clientid,
+		ID:        "id1",
+		BuyerID:   myOrg2Clientid,
+		BuyerMSP:  myOrg2Msp,
+		Nonce:     "tx1",
+		ExpiresAt: txTime,
 	}
+	chaincodeStub.GetPrivateDataReturns(transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime), nil)
 	dataRead, err := assetTransferCC.ReadTransferAgreement(transactionContext, "id1")
 	require.NoError(t, err)
 	require.Equal(t, expectedData, dataRead)
@@ -183,3 +187,187 @@ func TestGetAssetByRange(t *testing.T) {
 	require.Equal(t, []*chaincode.Asset{asset}, assets)
 
 }
+
+func TestGetAssetByRangePaged(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := &chaincode.SmartContract{}
+
+	_, err := assetTransferCC.GetAssetByRangePaged(transactionContext, "st", "end", 0, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+	_, err = assetTransferCC.GetAssetByRangePaged(transactionContext, "st", "end", 101, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+
+	asset1 := &chaincode.Asset{Type: "valuableasset", ID: "asset1", Owner: "user1"}
+	asset1Bytes, err := json.Marshal(asset1)
+	require.NoError(t, err)
+	asset2 := &chaincode.Asset{Type: "valuableasset", ID: "asset2", Owner: "user1"}
+	asset2Bytes, err := json.Marshal(asset2)
+	require.NoError(t, err)
+
+	// More records than the page size returns a continuation key
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(true)
+	iterator.NextReturnsOnCall(0, &queryresult.KV{Key: "asset1", Value: asset1Bytes}, nil)
+	iterator.NextReturnsOnCall(1, &queryresult.KV{Key: "asset2", Value: asset2Bytes}, nil)
+	chaincodeStub.GetPrivateDataByRangeReturns(iterator, nil)
+
+	result, err := assetTransferCC.GetAssetByRangePaged(transactionContext, "st", "", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Asset{asset1, asset2}, result.Records)
+	require.Equal(t, 2, result.FetchedRecordsCount)
+	require.Equal(t, "asset2", result.NextStartAfterKey)
+	collection, startKey, endKey := chaincodeStub.GetPrivateDataByRangeArgsForCall(0)
+	require.Equal(t, "assetCollection", collection)
+	require.Equal(t, "st", startKey)
+	require.Equal(t, "", endKey)
+	require.Equal(t, 1, iterator.CloseCallCount())
+
+	// Last page starts after the continuation key and has no continuation key
+	iterator = &mocks.StateQueryIterator{}
+	iterator.HasNextReturnsOnCall(0, true)
+	iterator.HasNextReturnsOnCall(1, false)
+	iterator.NextReturns(&queryresult.KV{Key: "asset3", Value: asset1Bytes}, nil)
+	chaincodeStub.GetPrivateDataByRangeReturns(iterator, nil)
+
+	result, err = assetTransferCC.GetAssetByRangePaged(transactionContext, "a", "", 2, "asset2")
+	require.NoError(t, err)
+	require.Equal(t, 1, result.FetchedRecordsCount)
+	require.Equal(t, "", result.NextStartAfterKey)
+	_, startKey, _ = chaincodeStub.GetPrivateDataByRangeArgsForCall(1)
+	require.Equal(t, "asset2\x00", startKey)
+
+	// Continuation key beyond the end of the range returns an empty page without a query
+	result, err = assetTransferCC.GetAssetByRangePaged(transactionContext, "a", "b", 2, "b")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Asset{}, result.Records)
+	require.Equal(t, 2, chaincodeStub.GetPrivateDataByRangeCallCount())
+
+	iterator = &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(true)
+	iterator.NextReturns(nil, fmt.Errorf("failed retrieving next item"))
+	chaincodeStub.GetPrivateDataByRangeReturns(iterator, nil)
+	result, err = assetTransferCC.GetAssetByRangePaged(transactionContext, "a", "z", 2, "")
+	require.EqualError(t, err, "failed retrieving next item")
+	require.Nil(t, result)
+}
+
+func TestGetAssetByRangeLimit(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := &chaincode.SmartContract{}
+
+	assetBytes, err := json.Marshal(&chaincode.Asset{Type: "valuableasset", ID: "asset1", Owner: "user1"})
+	require.NoError(t, err)
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(true)
+	iterator.NextReturns(&queryresult.KV{Value: assetBytes}, nil)
+	chaincodeStub.GetPrivateDataByRangeReturns(iterator, nil)
+
+	assets, err := assetTransferCC.GetAssetByRange(transactionContext, "st", "end")
+	require.EqualError(t, err, "range query returned more than 1000 assets, use GetAssetByRangePaged instead")
+	require.Nil(t, assets)
+	require.Equal(t, 1000, iterator.NextCallCount())
+}
+
+func TestQueryAssetsPaged(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := &chaincode.SmartContract{}
+
+	_, err := assetTransferCC.QueryAssetsPaged(transactionContext, `{"selector":{}}`, 0, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+	_, err = assetTransferCC.QueryAssetsPaged(transactionContext, "querystr", 10, "")
+	require.ErrorContains(t, err, "failed to unmarshal query string")
+	_, err = assetTransferCC.QueryAssetsPaged(transactionContext, `{"limit":5}`, 10, "")
+	require.EqualError(t, err, "query string must contain a selector")
+	_, err = assetTransferCC.QueryAssetsPaged(transactionContext, `{"selector":{},"sort":[{"size":"asc"}]}`, 10, "")
+	require.EqualError(t, err, "paged query results are ordered by key, query string must not contain a sort")
+
+	asset := &chaincode.Asset{Type: "valuableasset", ID: "asset1", Owner: "user1"}
+	assetBytes, err := json.Marshal(asset)
+	require.NoError(t, err)
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(true)
+	iterator.NextReturns(&queryresult.KV{Key: "asset1", Value: assetBytes}, nil)
+	chaincodeStub.GetPrivateDataQueryResultReturns(iterator, nil)
+
+	result, err := assetTransferCC.QueryAssetsPaged(transactionContext, `{"selector":{"owner":"user1"}}`, 1, "")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Asset{asset}, result.Records)
+	require.Equal(t, "asset1", result.NextStartAfterKey)
+	_, queryString := chaincodeStub.GetPrivateDataQueryResultArgsForCall(0)
+	require.JSONEq(t, `{"selector":{"owner":"user1"},"sort":[{"_id":"asc"}],"limit":2}`, queryString)
+
+	iterator = &mocks.StateQueryIterator{}
+	iterator.HasNextReturns(false)
+	chaincodeStub.GetPrivateDataQueryResultReturns(iterator, nil)
+
+	result, err = assetTransferCC.QueryAssetsPaged(transactionContext, `{"selector":{"owner":"user1"}}`, 1, "asset1")
+	require.NoError(t, err)
+	require.Equal(t, []*chaincode.Asset{}, result.Records)
+	require.Equal(t, "", result.NextStartAfterKey)
+	_, queryString = chaincodeStub.GetPrivateDataQueryResultArgsForCall(1)
+	require.JSONEq(t, `{"selector":{"$and":[{"owner":"user1"},{"_id":{"$gt":"asset1"}}]},"sort":[{"_id":"asc"}],"limit":2}`, queryString)
+}
+
+func TestQueryExpiredAgreements(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := &chaincode.SmartContract{}
+
+	iterator := &mocks.StateQueryIterator{}
+	iterator.HasNextReturnsOnCall(0, true)
+	iterator.HasNextReturnsOnCall(1, true)
+	iterator.HasNextReturnsOnCall(2, false)
+	iterator.NextReturnsOnCall(0, &queryresult.KV{Key: "agreement1", Value: transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime)}, nil)
+	iterator.NextReturnsOnCall(1, &queryresult.KV{Key: "agreement2", Value: transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Second))}, nil)
+	chaincodeStub.GetPrivateDataByPartialCompositeKeyReturns(iterator, nil)
+
+	page, err := assetTransferCC.QueryExpiredAgreements(transactionContext, 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, txTime, page.Records[0].ExpiresAt)
+	require.Equal(t, 2, page.FetchedRecordsCount)
+	require.Equal(t, "", page.NextStartAfterKey)
+	collection, objectType, _ := chaincodeStub.GetPrivateDataByPartialCompositeKeyArgsForCall(0)
+	require.Equal(t, assetCollectionName, collection)
+	require.Equal(t, transferAgreementObjectType, objectType)
+
+	_, err = assetTransferCC.QueryExpiredAgreements(transactionContext, 101, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+}
+
+func TestQueryExpiredAgreementsPaged(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := &chaincode.SmartContract{}
+
+	newIterator := func() *mocks.StateQueryIterator {
+		iterator := &mocks.StateQueryIterator{}
+		for i := 0; i < 3; i++ {
+			iterator.HasNextReturnsOnCall(i, true)
+			iterator.NextReturnsOnCall(i, &queryresult.KV{
+				Key:   fmt.Sprintf("agreement%d", i+1),
+				Value: transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime),
+			}, nil)
+		}
+		return iterator
+	}
+
+	// The first page stops after pageSize agreements have been read
+	iterator := newIterator()
+	chaincodeStub.GetPrivateDataByPartialCompositeKeyReturns(iterator, nil)
+	page, err := assetTransferCC.QueryExpiredAgreements(transactionContext, 2, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 2)
+	require.Equal(t, 2, page.FetchedRecordsCount)
+	require.Equal(t, "agreement2", page.NextStartAfterKey)
+	require.Equal(t, 2, iterator.NextCallCount())
+
+	// The next page skips the agreements up to the continuation key
+	iterator = newIterator()
+	chaincodeStub.GetPrivateDataByPartialCompositeKeyReturns(iterator, nil)
+	page, err = assetTransferCC.QueryExpiredAgreements(transactionContext, 2, "agreement2")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+	require.Equal(t, 1, page.FetchedRecordsCount)
+	require.Equal(t, "", page.NextStartAfterKey)
+}
@@ -8,10 +8,13 @@ package chaincode
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
@@ -19,6 +22,13 @@ import (
 
 const assetCollection = "assetCollection"
 const transferAgreementObjectType = "transferAgreement"
+const assetVerificationObjectType = "assetVerification"
+
+// defaultAgreementDuration is how long a transfer agreement is valid if no expiry is given
+const defaultAgreementDuration = 24 * time.Hour
+
+// collectionProbeKey is read from an inferred collection to check that the collection exists
+const collectionProbeKey = "collectionProbe"
 
 // SmartContract of this fabric sample
 type SmartContract struct {
@@ -40,10 +50,26 @@ type AssetPrivateDetails struct {
 	AppraisedValue int    `json:"appraisedValue"`
 }
 
-// TransferAgreement describes the buyer agreement returned by ReadTransferAgreement
+// TransferAgreement describes the buyer agreement stored in the assetCollection. The nonce
+// identifies a specific agreement, so that an owner can ensure an agreement they have reviewed
+// is not replaced before the transfer.
 type TransferAgreement struct {
-	ID      string `json:"assetID"`
-	BuyerID string `json:"buyerID"`
+	ID        string    `json:"assetID"`
+	BuyerID   string    `json:"buyerID"`
+	BuyerMSP  string    `json:"buyerMSP"`
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// AssetVerification records that an organization has verified the private details of an asset
+// held in another organization's collection. The hash is the hex encoded SHA-256 of the verified
+// details, so that a later change to the details invalidates the verification.
+type AssetVerification struct {
+	ID          string `json:"assetID"`
+	Collection  string `json:"collection"`
+	VerifierMSP string `json:"verifierMSP"`
+	VerifierID  string `json:"verifierID"`
+	Hash        string `json:"hash"`
 }
 
 // CreateAsset creates a new asset by placing the main asset details in the assetCollection
@@ -167,8 +193,10 @@ func (s *SmartContract) CreateAsset(ctx contractapi.TransactionContextInterface)
 
 // AgreeToTransfer is used by the potential buyer of the asset to agree to the
 // asset value. The agreed to appraisal value is stored in the buying orgs
-// org specifc collection, while the buyer client ID is stored in the asset collection
-// using a composite key
+// org specifc collection, while the transfer agreement is stored in the asset collection
+// using a composite key. The agreement expires after 24 hours, unless an expiresAt
+// timestamp is passed in the agreement_terms transient field. An existing agreement can
+// only be replaced by the buyer who made it.
 func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterface) error {
 
 	// Get ID of submitting client identity
@@ -212,6 +240,41 @@ func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterf
 	if asset == nil {
 		return fmt.Errorf("%v does not exist", valueJSON.ID)
 	}
+
+	// Only the buyer who made an existing agreement may replace it
+	existingAgreement, err := s.ReadTransferAgreement(ctx, valueJSON.ID)
+	if err != nil {
+		return fmt.Errorf("error reading transfer agreement: %v", err)
+	}
+	if existingAgreement != nil && existingAgreement.BuyerID != clientID {
+		return fmt.Errorf("a transfer agreement for %v already exists and can only be replaced by the buyer who made it", valueJSON.ID)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := now.Add(defaultAgreementDuration)
+	if termsJSON, ok := transientMap["agreement_terms"]; ok {
+		var terms struct {
+			ExpiresAt time.Time `json:"expiresAt"`
+		}
+		err = json.Unmarshal(termsJSON, &terms)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal JSON: %v", err)
+		}
+		if !terms.ExpiresAt.After(now) {
+			return fmt.Errorf("expiresAt field must be later than the transaction timestamp %v", now.Format(time.RFC3339))
+		}
+		expiresAt = terms.ExpiresAt
+	}
+
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
 	// Verify that the client is submitting request to peer in their organization
 	err = verifyClientOrgMatchesPeerOrg(ctx)
 	if err != nil {
@@ -232,15 +295,26 @@ func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterf
 	}
 
 	// Create agreeement that indicates which identity has agreed to purchase
-	// In a more realistic transfer scenario, a transfer agreement would be secured to ensure that it cannot
-	// be overwritten by another channel member
+	// The transaction ID is used as a nonce that identifies this agreement
+	transferAgreement := TransferAgreement{
+		ID:        valueJSON.ID,
+		BuyerID:   clientID,
+		BuyerMSP:  clientMSPID,
+		Nonce:     ctx.GetStub().GetTxID(),
+		ExpiresAt: expiresAt.UTC(),
+	}
+	transferAgreementJSON, err := json.Marshal(transferAgreement)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer agreement into JSON: %v", err)
+	}
+
 	transferAgreeKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{valueJSON.ID})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key: %v", err)
 	}
 
 	log.Printf("AgreeToTransfer Put: collection %v, ID %v, Key %v", assetCollection, valueJSON.ID, transferAgreeKey)
-	err = ctx.GetStub().PutPrivateData(assetCollection, transferAgreeKey, []byte(clientID))
+	err = ctx.GetStub().PutPrivateData(assetCollection, transferAgreeKey, transferAgreementJSON)
 	if err != nil {
 		return fmt.Errorf("failed to put asset bid: %v", err)
 	}
@@ -248,7 +322,9 @@ func (s *SmartContract) AgreeToTransfer(ctx contractapi.TransactionContextInterf
 	return nil
 }
 
-// TransferAsset transfers the asset to the new owner by setting a new owner ID
+// TransferAsset transfers the asset to the new owner by setting a new owner ID. The transfer
+// agreement must have been made by a buyer from buyerMSP and must not have expired. If an
+// agreementNonce is passed, the transfer is made only if the agreement has not been replaced.
 func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface) error {
 
 	transientMap, err := ctx.GetStub().GetTransient()
@@ -262,9 +338,13 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("asset owner not found in the transient map")
 	}
 
+	// RequireVerification makes the transfer conditional on both organizations having verified
+	// the private details held by the other using VerifyAssetPrivateDetails
 	type assetTransferTransientInput struct {
-		ID       string `json:"assetID"`
-		BuyerMSP string `json:"buyerMSP"`
+		ID                  string `json:"assetID"`
+		BuyerMSP            string `json:"buyerMSP"`
+		RequireVerification bool   `json:"requireVerification"`
+		AgreementNonce      string `json:"agreementNonce"`
 	}
 
 	var assetTransferInput assetTransferTransientInput
@@ -294,19 +374,62 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("TransferAsset cannot be performed: Error %v", err)
 	}
 
+	// Get collection names for this organization and the buyer organization
+	ownersCollection, err := getCollectionName(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+	}
+
+	buyersCollection, err := getCollectionNameForMSP(ctx, assetTransferInput.BuyerMSP)
+	if err != nil {
+		return fmt.Errorf("failed to infer private collection name for the buyer org: %v", err)
+	}
+
 	// Verify transfer details and transfer owner
-	err = s.verifyAgreement(ctx, assetTransferInput.ID, asset.Owner, assetTransferInput.BuyerMSP)
+	err = s.verifyAgreement(ctx, assetTransferInput.ID, asset.Owner, ownersCollection, buyersCollection)
 	if err != nil {
 		return fmt.Errorf("failed transfer verification: %v", err)
 	}
 
+	ownerMSP, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
+	if assetTransferInput.RequireVerification {
+		// The buyer must have verified the owner's details, and the owner the buyer's details.
+		// The reason is only logged, so that the error does not reveal details of either organization.
+		err = verifyAssetVerification(ctx, assetTransferInput.ID, assetTransferInput.BuyerMSP, ownersCollection)
+		if err == nil {
+			err = verifyAssetVerification(ctx, assetTransferInput.ID, ownerMSP, buyersCollection)
+		}
+		if err != nil {
+			log.Printf("TransferAsset verification failed: %v", err)
+			return fmt.Errorf("failed transfer verification: private details of %v do not match the verified details", assetTransferInput.ID)
+		}
+	}
+
 	transferAgreement, err := s.ReadTransferAgreement(ctx, assetTransferInput.ID)
 	if err != nil {
 		return fmt.Errorf("failed ReadTransferAgreement to find buyerID: %v", err)
 	}
-	if transferAgreement.BuyerID == "" {
+	if transferAgreement == nil || transferAgreement.BuyerID == "" {
 		return fmt.Errorf("BuyerID not found in TransferAgreement for %v", assetTransferInput.ID)
 	}
+	if transferAgreement.BuyerMSP != assetTransferInput.BuyerMSP {
+		return fmt.Errorf("TransferAgreement for %v was made by a buyer from %v, not %v", assetTransferInput.ID, transferAgreement.BuyerMSP, assetTransferInput.BuyerMSP)
+	}
+	if assetTransferInput.AgreementNonce != "" && transferAgreement.Nonce != assetTransferInput.AgreementNonce {
+		return fmt.Errorf("TransferAgreement for %v has been replaced, nonce %v does not match %v", assetTransferInput.ID, transferAgreement.Nonce, assetTransferInput.AgreementNonce)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return err
+	}
+	if !now.Before(transferAgreement.ExpiresAt) {
+		return fmt.Errorf("TransferAgreement for %v expired at %v", assetTransferInput.ID, transferAgreement.ExpiresAt.Format(time.RFC3339))
+	}
 
 	// Transfer asset in private data collection to new owner
 	asset.Owner = transferAgreement.BuyerID
@@ -322,12 +445,6 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return err
 	}
 
-	// Get collection name for this organization
-	ownersCollection, err := getCollectionName(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
-	}
-
 	// Delete the asset appraised value from this organization's private data collection
 	err = ctx.GetStub().DelPrivateData(ownersCollection, assetTransferInput.ID)
 	if err != nil {
@@ -345,6 +462,19 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return err
 	}
 
+	// Delete any verifications, which do not apply to a future transfer
+	for _, verifierMSP := range []string{ownerMSP, assetTransferInput.BuyerMSP} {
+		verificationKey, err := ctx.GetStub().CreateCompositeKey(assetVerificationObjectType, []string{assetTransferInput.ID, verifierMSP})
+		if err != nil {
+			return fmt.Errorf("failed to create composite key: %v", err)
+		}
+
+		err = ctx.GetStub().DelPrivateData(assetCollection, verificationKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 
 }
@@ -352,7 +482,7 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 // verifyAgreement is an internal helper function used by TransferAsset to verify
 // that the transfer is being initiated by the owner and that the buyer has agreed
 // to the same appraisal value as the owner
-func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterface, assetID string, owner string, buyerMSP string) error {
+func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterface, assetID string, owner string, collectionOwner string, collectionBuyer string) error {
 
 	// Check 1: verify that the transfer is being initiatied by the owner
 
@@ -368,14 +498,6 @@ func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterf
 
 	// Check 2: verify that the buyer has agreed to the appraised value
 
-	// Get collection names
-	collectionOwner, err := getCollectionName(ctx) // get owner collection from caller identity
-	if err != nil {
-		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
-	}
-
-	collectionBuyer := buyerMSP + "PrivateCollection" // get buyers collection
-
 	// Get hash of owners agreed to value
 	ownerAppraisedValueHash, err := ctx.GetStub().GetPrivateDataHash(collectionOwner, assetID)
 	if err != nil {
@@ -402,6 +524,121 @@ func (s *SmartContract) verifyAgreement(ctx contractapi.TransactionContextInterf
 	return nil
 }
 
+// VerifyAssetPrivateDetails allows an organization to check that the asset details it was given
+// off-chain match the details stored in another organization's collection, without reading them.
+// The expected details are passed in the transient field as the exact JSON bytes stored by the
+// other organization, and their SHA-256 hash is compared with the on-chain hash of the private data.
+// A mismatch returns false rather than an error, so that the passed details are never echoed back.
+// When submitted, a successful verification is recorded in the asset collection so that it can
+// be required by TransferAsset.
+func (s *SmartContract) VerifyAssetPrivateDetails(ctx contractapi.TransactionContextInterface, assetID string, ownerCollection string) (bool, error) {
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return false, fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Details are private, therefore they get passed in transient field
+	assetPrivateDetailsJSON, ok := transientMap["asset_value"]
+	if !ok {
+		return false, fmt.Errorf("asset_value key not found in the transient map")
+	}
+
+	var assetPrivateDetails AssetPrivateDetails
+	err = json.Unmarshal(assetPrivateDetailsJSON, &assetPrivateDetails)
+	if err != nil {
+		return false, fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if assetPrivateDetails.ID != assetID {
+		return false, nil
+	}
+
+	// Get hash of the details stored by the owner
+	onChainHash, err := ctx.GetStub().GetPrivateDataHash(ownerCollection, assetID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get hash of private details from collection %v: %v", ownerCollection, err)
+	}
+	if onChainHash == nil {
+		return false, fmt.Errorf("hash of private details for %v does not exist in collection %v", assetID, ownerCollection)
+	}
+
+	calculatedHash := sha256.Sum256(assetPrivateDetailsJSON)
+	if !bytes.Equal(onChainHash, calculatedHash[:]) {
+		return false, nil
+	}
+
+	clientID, err := submittingClientIdentity(ctx)
+	if err != nil {
+		return false, err
+	}
+	clientMSPID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, fmt.Errorf("failed to get verified MSPID: %v", err)
+	}
+
+	verification := AssetVerification{
+		ID:          assetID,
+		Collection:  ownerCollection,
+		VerifierMSP: clientMSPID,
+		VerifierID:  clientID,
+		Hash:        hex.EncodeToString(onChainHash),
+	}
+	verificationJSON, err := json.Marshal(verification)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal verification into JSON: %v", err)
+	}
+
+	verificationKey, err := ctx.GetStub().CreateCompositeKey(assetVerificationObjectType, []string{assetID, clientMSPID})
+	if err != nil {
+		return false, fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	log.Printf("VerifyAssetPrivateDetails Put: collection %v, ID %v, Key %v", assetCollection, assetID, verificationKey)
+	err = ctx.GetStub().PutPrivateData(assetCollection, verificationKey, verificationJSON)
+	if err != nil {
+		return false, fmt.Errorf("failed to put asset verification: %v", err)
+	}
+
+	return true, nil
+}
+
+// verifyAssetVerification is an internal helper function used by TransferAsset to check that an
+// organization has verified the private details of an asset in a collection, and that the details
+// have not changed since they were verified
+func verifyAssetVerification(ctx contractapi.TransactionContextInterface, assetID string, verifierMSP string, collection string) error {
+	verificationKey, err := ctx.GetStub().CreateCompositeKey(assetVerificationObjectType, []string{assetID, verifierMSP})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	verificationJSON, err := ctx.GetStub().GetPrivateData(assetCollection, verificationKey)
+	if err != nil {
+		return fmt.Errorf("failed to read asset verification: %v", err)
+	}
+	if verificationJSON == nil {
+		return fmt.Errorf("%v has not verified the private details of %v in collection %v", verifierMSP, assetID, collection)
+	}
+
+	var verification AssetVerification
+	err = json.Unmarshal(verificationJSON, &verification)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal JSON: %v", err)
+	}
+	if verification.Collection != collection {
+		return fmt.Errorf("%v verified the private details of %v in collection %v, not %v", verifierMSP, assetID, verification.Collection, collection)
+	}
+
+	onChainHash, err := ctx.GetStub().GetPrivateDataHash(collection, assetID)
+	if err != nil {
+		return fmt.Errorf("failed to get hash of private details from collection %v: %v", collection, err)
+	}
+	if hex.EncodeToString(onChainHash) != verification.Hash {
+		return fmt.Errorf("private details of %v in collection %v have changed since they were verified by %v", assetID, collection, verifierMSP)
+	}
+
+	return nil
+}
+
 // DeleteAsset can be used by the owner of the asset to delete the asset
 func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface) error {
 
@@ -459,6 +696,12 @@ func (s *SmartContract) DeleteAsset(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("asset not found in owner's private Collection %v: %v", ownerCollection, assetDeleteInput.ID)
 	}
 
+	// Record the delete before the private data is removed
+	err = writeAuditRecord(ctx, AuditOperationDelete, assetDeleteInput.ID, ownerCollection)
+	if err != nil {
+		return err
+	}
+
 	// delete the asset from state
 	err = ctx.GetStub().DelPrivateData(assetCollection, assetDeleteInput.ID)
 	if err != nil {
@@ -521,6 +764,12 @@ func (s *SmartContract) PurgeAsset(ctx contractapi.TransactionContextInterface)
 		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
 	}
 
+	// Record the purge before the private data is removed
+	err = writeAuditRecord(ctx, AuditOperationPurge, assetPurgeInput.ID, ownerCollection)
+	if err != nil {
+		return err
+	}
+
 	// delete the asset from state
 	err = ctx.GetStub().PurgePrivateData(assetCollection, assetPurgeInput.ID)
 	if err != nil {
@@ -538,7 +787,8 @@ func (s *SmartContract) PurgeAsset(ctx contractapi.TransactionContextInterface)
 }
 
 // DeleteTranferAgreement can be used by the buyer to withdraw a proposal from
-// the asset collection and from his own collection.
+// the asset collection and from their own collection. The owner of the asset can
+// also delete an expired agreement from the asset collection.
 func (s *SmartContract) DeleteTranferAgreement(ctx contractapi.TransactionContextInterface) error {
 
 	transientMap, err := ctx.GetStub().GetTransient()
@@ -571,31 +821,58 @@ func (s *SmartContract) DeleteTranferAgreement(ctx contractapi.TransactionContex
 	if err != nil {
 		return fmt.Errorf("DeleteTranferAgreement cannot be performed: Error %v", err)
 	}
-	// Delete private details of agreement
-	orgCollection, err := getCollectionName(ctx) // Get proposers collection.
-	if err != nil {
-		return fmt.Errorf("failed to infer private collection name for the org: %v", err)
-	}
 	tranferAgreeKey, err := ctx.GetStub().CreateCompositeKey(transferAgreementObjectType, []string{assetDeleteInput.
 		ID}) // Create composite key
 	if err != nil {
 		return fmt.Errorf("failed to create composite key: %v", err)
 	}
 
-	valAsbytes, err := ctx.GetStub().GetPrivateData(assetCollection, tranferAgreeKey) //get the transfer_agreement
+	transferAgreement, err := s.ReadTransferAgreement(ctx, assetDeleteInput.ID)
 	if err != nil {
 		return fmt.Errorf("failed to read transfer_agreement: %v", err)
 	}
-	if valAsbytes == nil {
+	if transferAgreement == nil {
 		return fmt.Errorf("asset's transfer_agreement does not exist: %v", assetDeleteInput.ID)
 	}
 
-	log.Printf("Deleting TranferAgreement: %v", assetDeleteInput.ID)
-	err = ctx.GetStub().DelPrivateData(orgCollection, assetDeleteInput.ID) // Delete the asset
+	clientID, err := submittingClientIdentity(ctx)
 	if err != nil {
 		return err
 	}
 
+	if clientID == transferAgreement.BuyerID {
+		// Delete private details of agreement
+		orgCollection, err := getCollectionName(ctx) // Get proposers collection.
+		if err != nil {
+			return fmt.Errorf("failed to infer private collection name for the org: %v", err)
+		}
+
+		log.Printf("Deleting TranferAgreement: %v", assetDeleteInput.ID)
+		err = ctx.GetStub().DelPrivateData(orgCollection, assetDeleteInput.ID) // Delete the asset
+		if err != nil {
+			return err
+		}
+	} else {
+		// Only the owner may delete another buyer's agreement, once it has expired
+		asset, err := s.ReadAsset(ctx, assetDeleteInput.ID)
+		if err != nil {
+			return fmt.Errorf("error reading asset: %v", err)
+		}
+		if asset == nil || asset.Owner != clientID {
+			return fmt.Errorf("transfer_agreement for %v can only be deleted by the buyer who made it", assetDeleteInput.ID)
+		}
+
+		now, err := getTxTime(ctx)
+		if err != nil {
+			return err
+		}
+		if now.Before(transferAgreement.ExpiresAt) {
+			return fmt.Errorf("transfer_agreement for %v has not expired and can only be deleted by the buyer who made it", assetDeleteInput.ID)
+		}
+
+		log.Printf("Deleting expired TranferAgreement: %v", assetDeleteInput.ID)
+	}
+
 	// Delete transfer agreement record
 	err = ctx.GetStub().DelPrivateData(assetCollection, tranferAgreeKey) // remove agreement from state
 	if err != nil {
@@ -606,6 +883,16 @@ func (s *SmartContract) DeleteTranferAgreement(ctx contractapi.TransactionContex
 
 }
 
+// getTxTime is an internal helper function to get the transaction timestamp, which is the same
+// for all endorsing peers.
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+	return txTimestamp.AsTime(), nil
+}
+
 // getCollectionName is an internal helper function to get collection of submitting client identity.
 func getCollectionName(ctx contractapi.TransactionContextInterface) (string, error) {
 
@@ -615,8 +902,23 @@ func getCollectionName(ctx contractapi.TransactionContextInterface) (string, err
 		return "", fmt.Errorf("failed to get verified MSPID: %v", err)
 	}
 
+	return getCollectionNameForMSP(ctx, clientMSPID)
+}
+
+// getCollectionNameForMSP is an internal helper function to get the collection of an organization.
+// The collection name is inferred from the MSP ID, so it is checked against the collection
+// configuration of the chaincode definition to report organizations that have not been onboarded.
+func getCollectionNameForMSP(ctx contractapi.TransactionContextInterface, mspID string) (string, error) {
+
 	// Create the collection name
-	orgCollection := clientMSPID + "PrivateCollection"
+	orgCollection := mspID + "PrivateCollection"
+
+	// Reading a hash fails if the collection is not defined for this chaincode
+	_, err := ctx.GetStub().GetPrivateDataHash(orgCollection, collectionProbeKey)
+	if err != nil {
+		return "", fmt.Errorf("collection %v for organization %v is not defined in the chaincode collection configuration, "+
+			"generate a collection configuration that includes %v and update the chaincode definition: %v", orgCollection, mspID, mspID, err)
+	}
 
 	return orgCollection, nil
 }
@@ -6,10 +6,15 @@ SPDX-License-Identifier: Apache-2.0
 package chaincode_test
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
 	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
@@ -18,6 +23,7 @@ import (
 	"github.com/hyperledger/fabric-samples/asset-transfer-private-data/chaincode-go/chaincode"
 	"github.com/hyperledger/fabric-samples/asset-transfer-private-data/chaincode-go/chaincode/mocks"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 /*
@@ -49,6 +55,7 @@ type clientIdentity interface {
 
 const assetCollectionName = "assetCollection"
 const transferAgreementObjectType = "transferAgreement"
+const assetVerificationObjectType = "assetVerification"
 const myOrg1Msp = "Org1Testmsp"
 const myOrg1Clientid = "myOrg1Userid"
 const myOrg1PrivCollection = "Org1TestmspPrivateCollection"
@@ -56,6 +63,8 @@ const myOrg2Msp = "Org2Testmsp"
 const myOrg2Clientid = "myOrg2Userid"
 const myOrg2PrivCollection = "Org2TestmspPrivateCollection"
 
+var txTime = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
 type assetTransientInput struct {
 	Type           string `json:"objectType"`
 	ID             string `json:"assetID"`
@@ -65,8 +74,10 @@ type assetTransientInput struct {
 }
 
 type assetTransferTransientInput struct {
-	ID       string `json:"assetID"`
-	BuyerMSP string `json:"buyerMSP"`
+	ID                  string `json:"assetID"`
+	BuyerMSP            string `json:"buyerMSP"`
+	RequireVerification bool   `json:"requireVerification"`
+	AgreementNonce      string `json:"agreementNonce"`
 }
 
 func TestCreateAssetBadInput(t *testing.T) {
@@ -200,7 +211,10 @@ func TestAgreeToTransferSuccessful(t *testing.T) {
 		Owner: myOrg1Clientid,
 	}
 	setReturnPrivateDataInStub(t, chaincodeStub, &origAsset)
+	// no existing transfer agreement
+	chaincodeStub.GetPrivateDataReturnsOnCall(1, nil, nil)
 	chaincodeStub.CreateCompositeKeyReturns(transferAgreementObjectType+"id1", nil)
+	chaincodeStub.GetTxIDReturns("tx1")
 	err := assetTransferCC.AgreeToTransfer(transactionContext)
 	require.NoError(t, err)
 
@@ -213,7 +227,53 @@ func TestAgreeToTransferSuccessful(t *testing.T) {
 	calledCollection, calledId, calledWithDataBytes = chaincodeStub.PutPrivateDataArgsForCall(1)
 	require.Equal(t, assetCollectionName, calledCollection)
 	require.Equal(t, transferAgreementObjectType+"id1", calledId)
-	require.Equal(t, []byte(myOrg1Clientid), calledWithDataBytes)
+	expectedAgreementBytes, err := json.Marshal(chaincode.TransferAgreement{
+		ID:        "id1",
+		BuyerID:   myOrg1Clientid,
+		BuyerMSP:  myOrg1Msp,
+		Nonce:     "tx1",
+		ExpiresAt: txTime.Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	require.Equal(t, expectedAgreementBytes, calledWithDataBytes)
+}
+
+func TestAgreeToTransferReplacingAgreement(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg2()
+	assetTransferCC := chaincode.SmartContract{}
+	assetPrivDetail := &chaincode.AssetPrivateDetails{
+		ID:             "id1",
+		AppraisedValue: 500,
+	}
+	assetValueBytes, err := json.Marshal(assetPrivDetail)
+	require.NoError(t, err)
+	chaincodeStub.GetTransientReturns(map[string][]byte{
+		"asset_value":     assetValueBytes,
+		"agreement_terms": []byte(`{"expiresAt":"2024-01-01T11:00:00Z"}`),
+	}, nil)
+	setReturnPrivateDataInStub(t, chaincodeStub, &chaincode.Asset{ID: "id1", Owner: myOrg1Clientid})
+	chaincodeStub.GetPrivateDataReturnsOnCall(1, transferAgreementBytes(t, "anotherBuyer", myOrg2Msp, txTime.Add(time.Hour)), nil)
+
+	err = assetTransferCC.AgreeToTransfer(transactionContext)
+	require.EqualError(t, err, "a transfer agreement for id1 already exists and can only be replaced by the buyer who made it")
+
+	chaincodeStub.GetPrivateDataReturnsOnCall(3, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Hour)), nil)
+	err = assetTransferCC.AgreeToTransfer(transactionContext)
+	require.EqualError(t, err, "expiresAt field must be later than the transaction timestamp 2024-01-01T12:00:00Z")
+
+	chaincodeStub.GetTransientReturns(map[string][]byte{
+		"asset_value":     assetValueBytes,
+		"agreement_terms": []byte(`{"expiresAt":"2024-01-02T12:00:00+01:00"}`),
+	}, nil)
+	chaincodeStub.GetPrivateDataReturnsOnCall(5, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Hour)), nil)
+	err = assetTransferCC.AgreeToTransfer(transactionContext)
+	require.NoError(t, err)
+
+	_, _, calledWithDataBytes := chaincodeStub.PutPrivateDataArgsForCall(1)
+	var agreement chaincode.TransferAgreement
+	require.NoError(t, json.Unmarshal(calledWithDataBytes, &agreement))
+	require.Equal(t, myOrg2Clientid, agreement.BuyerID)
+	require.Equal(t, time.Date(2024, time.January, 2, 11, 0, 0, 0, time.UTC), agreement.ExpiresAt)
 }
 func TestTransferAssetBadInput(t *testing.T) {
 	transactionContext, chaincodeStub := prepMocksAsOrg1()
@@ -258,7 +318,7 @@ func TestTransferAssetSuccessful(t *testing.T) {
 	// to ensure we pass data hash verification
 	chaincodeStub.GetPrivateDataHashReturns([]byte("datahash"), nil)
 	// to ensure that ReadTransferAgreement call returns org2 client ID
-	chaincodeStub.GetPrivateDataReturnsOnCall(1, []byte(myOrg2Clientid), nil)
+	chaincodeStub.GetPrivateDataReturnsOnCall(1, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Hour)), nil)
 	chaincodeStub.CreateCompositeKeyReturns(transferAgreementObjectType+"id1", nil)
 
 	err := assetTransferCC.TransferAsset(transactionContext)
@@ -347,15 +407,227 @@ func TestTransferAssetNonMatchingAppraisalValue(t *testing.T) {
 	}
 	setReturnPrivateDataInStub(t, chaincodeStub, &orgAsset)
 	chaincodeStub.CreateCompositeKeyReturns(transferAgreementObjectType+"id1", nil)
-	// data hash different in each collection
-	chaincodeStub.GetPrivateDataHashReturnsOnCall(0, []byte("datahash1"), nil)
-	chaincodeStub.GetPrivateDataHashReturnsOnCall(1, []byte("datahash2"), nil)
+	// data hash different in each collection, after checking that both collections exist
+	chaincodeStub.GetPrivateDataHashReturnsOnCall(2, []byte("datahash1"), nil)
+	chaincodeStub.GetPrivateDataHashReturnsOnCall(3, []byte("datahash2"), nil)
 
 	err := assetTransferCC.TransferAsset(transactionContext)
 	require.Error(t, err, "Expected failed hash verification")
 	require.Contains(t, err.Error(), "failed transfer verification: hash for appraised value")
 }
 
+func TestTransferAssetWithInvalidAgreement(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+	assetNewOwner := &assetTransferTransientInput{
+		ID:             "id1",
+		BuyerMSP:       myOrg2Msp,
+		AgreementNonce: "tx2",
+	}
+	setReturnAssetOwnerInTransientMap(t, chaincodeStub, assetNewOwner)
+	setReturnPrivateDataInStub(t, chaincodeStub, &chaincode.Asset{ID: "id1", Owner: myOrg1Clientid})
+	chaincodeStub.GetPrivateDataHashReturns([]byte("datahash"), nil)
+
+	chaincodeStub.GetPrivateDataReturnsOnCall(1, transferAgreementBytes(t, myOrg2Clientid, "Org3Testmsp", txTime.Add(time.Hour)), nil)
+	err := assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "TransferAgreement for id1 was made by a buyer from Org3Testmsp, not Org2Testmsp")
+
+	chaincodeStub.GetPrivateDataReturnsOnCall(3, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Hour)), nil)
+	err = assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "TransferAgreement for id1 has been replaced, nonce tx1 does not match tx2")
+
+	assetNewOwner.AgreementNonce = "tx1"
+	setReturnAssetOwnerInTransientMap(t, chaincodeStub, assetNewOwner)
+	chaincodeStub.GetPrivateDataReturnsOnCall(5, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime), nil)
+	err = assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "TransferAgreement for id1 expired at 2024-01-01T12:00:00Z")
+	require.Equal(t, 0, chaincodeStub.PutPrivateDataCallCount())
+}
+
+func TestDeleteTransferAgreement(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+	chaincodeStub.GetTransientReturns(map[string][]byte{"agreement_delete": []byte(`{"assetID":"id1"}`)}, nil)
+	chaincodeStub.CreateCompositeKeyReturns(transferAgreementObjectType+"id1", nil)
+	assetBytes, err := json.Marshal(chaincode.Asset{ID: "id1", Owner: myOrg1Clientid})
+	require.NoError(t, err)
+
+	// Owner cannot delete an agreement that has not expired
+	chaincodeStub.GetPrivateDataReturnsOnCall(0, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Second)), nil)
+	chaincodeStub.GetPrivateDataReturnsOnCall(1, assetBytes, nil)
+	err = assetTransferCC.DeleteTranferAgreement(transactionContext)
+	require.EqualError(t, err, "transfer_agreement for id1 has not expired and can only be deleted by the buyer who made it")
+
+	// Owner deletes an expired agreement, but not the buyer's private details
+	chaincodeStub.GetPrivateDataReturnsOnCall(2, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime), nil)
+	chaincodeStub.GetPrivateDataReturnsOnCall(3, assetBytes, nil)
+	err = assetTransferCC.DeleteTranferAgreement(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 1, chaincodeStub.DelPrivateDataCallCount())
+	calledCollection, calledId := chaincodeStub.DelPrivateDataArgsForCall(0)
+	require.Equal(t, assetCollectionName, calledCollection)
+	require.Equal(t, transferAgreementObjectType+"id1", calledId)
+
+	// Another client cannot delete an expired agreement
+	transactionContext, chaincodeStub = prepMocksAsOrg2()
+	chaincodeStub.GetTransientReturns(map[string][]byte{"agreement_delete": []byte(`{"assetID":"id1"}`)}, nil)
+	chaincodeStub.GetPrivateDataReturnsOnCall(0, transferAgreementBytes(t, "anotherBuyer", myOrg2Msp, txTime), nil)
+	chaincodeStub.GetPrivateDataReturnsOnCall(1, assetBytes, nil)
+	err = assetTransferCC.DeleteTranferAgreement(transactionContext)
+	require.EqualError(t, err, "transfer_agreement for id1 can only be deleted by the buyer who made it")
+
+	// Buyer deletes their agreement and private details
+	chaincodeStub.GetPrivateDataReturnsOnCall(2, transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Hour)), nil)
+	err = assetTransferCC.DeleteTranferAgreement(transactionContext)
+	require.NoError(t, err)
+	require.Equal(t, 2, chaincodeStub.DelPrivateDataCallCount())
+	calledCollection, calledId = chaincodeStub.DelPrivateDataArgsForCall(0)
+	require.Equal(t, myOrg2PrivCollection, calledCollection)
+	require.Equal(t, "id1", calledId)
+}
+
+func TestTransferAssetToUndefinedOrg(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+	assetNewOwner := &assetTransferTransientInput{
+		ID:       "id1",
+		BuyerMSP: "Org3Testmsp",
+	}
+	setReturnAssetOwnerInTransientMap(t, chaincodeStub, assetNewOwner)
+	setReturnPrivateDataInStub(t, chaincodeStub, &chaincode.Asset{ID: "id1", Owner: myOrg1Clientid})
+	chaincodeStub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+		if collection != myOrg1PrivCollection {
+			return nil, fmt.Errorf("collection [%v] not defined in the collection config for chaincode [private]", collection)
+		}
+		return nil, nil
+	}
+
+	err := assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "failed to infer private collection name for the buyer org: collection Org3TestmspPrivateCollection for organization Org3Testmsp "+
+		"is not defined in the chaincode collection configuration, generate a collection configuration that includes Org3Testmsp and update the chaincode definition: "+
+		"collection [Org3TestmspPrivateCollection] not defined in the collection config for chaincode [private]")
+	require.Equal(t, 0, chaincodeStub.PutPrivateDataCallCount())
+}
+
+func TestVerifyAssetPrivateDetails(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg2()
+	assetTransferCC := chaincode.SmartContract{}
+	chaincodeStub.CreateCompositeKeyReturns(assetVerificationObjectType+"id1"+myOrg2Msp, nil)
+
+	_, err := assetTransferCC.VerifyAssetPrivateDetails(transactionContext, "id1", myOrg1PrivCollection)
+	require.EqualError(t, err, "asset_value key not found in the transient map")
+
+	detailsBytes := setReturnAssetPrivateDetailsInTransientMap(t, chaincodeStub, &chaincode.AssetPrivateDetails{ID: "id2", AppraisedValue: 500})
+	verified, err := assetTransferCC.VerifyAssetPrivateDetails(transactionContext, "id1", myOrg1PrivCollection)
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	detailsBytes = setReturnAssetPrivateDetailsInTransientMap(t, chaincodeStub, &chaincode.AssetPrivateDetails{ID: "id1", AppraisedValue: 500})
+	_, err = assetTransferCC.VerifyAssetPrivateDetails(transactionContext, "id1", myOrg1PrivCollection)
+	require.EqualError(t, err, "hash of private details for id1 does not exist in collection "+myOrg1PrivCollection)
+
+	chaincodeStub.GetPrivateDataHashReturns([]byte("datahash"), nil)
+	verified, err = assetTransferCC.VerifyAssetPrivateDetails(transactionContext, "id1", myOrg1PrivCollection)
+	require.NoError(t, err)
+	require.False(t, verified)
+	require.Equal(t, 0, chaincodeStub.PutPrivateDataCallCount())
+
+	hash := sha256.Sum256(detailsBytes)
+	chaincodeStub.GetPrivateDataHashReturns(hash[:], nil)
+	verified, err = assetTransferCC.VerifyAssetPrivateDetails(transactionContext, "id1", myOrg1PrivCollection)
+	require.NoError(t, err)
+	require.True(t, verified)
+	// Verification reads only the hash of the private details
+	require.Equal(t, 0, chaincodeStub.GetPrivateDataCallCount())
+	collection, _ := chaincodeStub.GetPrivateDataHashArgsForCall(2)
+	require.Equal(t, myOrg1PrivCollection, collection)
+
+	expectedVerification, err := json.Marshal(chaincode.AssetVerification{
+		ID:          "id1",
+		Collection:  myOrg1PrivCollection,
+		VerifierMSP: myOrg2Msp,
+		VerifierID:  myOrg2Clientid,
+		Hash:        hex.EncodeToString(hash[:]),
+	})
+	require.NoError(t, err)
+	calledCollection, calledKey, calledWithBytes := chaincodeStub.PutPrivateDataArgsForCall(0)
+	require.Equal(t, assetCollectionName, calledCollection)
+	require.Equal(t, assetVerificationObjectType+"id1"+myOrg2Msp, calledKey)
+	require.Equal(t, expectedVerification, calledWithBytes)
+}
+
+func TestTransferAssetRequiringVerification(t *testing.T) {
+	transactionContext, chaincodeStub := prepMocksAsOrg1()
+	assetTransferCC := chaincode.SmartContract{}
+	assetNewOwner := &assetTransferTransientInput{
+		ID:                  "id1",
+		BuyerMSP:            myOrg2Msp,
+		RequireVerification: true,
+	}
+	setReturnAssetOwnerInTransientMap(t, chaincodeStub, assetNewOwner)
+	origAsset := chaincode.Asset{
+		ID:    "id1",
+		Type:  "testfulasset",
+		Color: "gray",
+		Size:  7,
+		Owner: myOrg1Clientid,
+	}
+	assetBytes, err := json.Marshal(origAsset)
+	require.NoError(t, err)
+	chaincodeStub.GetPrivateDataHashReturns([]byte("datahash"), nil)
+	chaincodeStub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return objectType + strings.Join(attributes, ""), nil
+	}
+
+	privateData := map[string][]byte{
+		"id1":                               assetBytes,
+		transferAgreementObjectType + "id1": transferAgreementBytes(t, myOrg2Clientid, myOrg2Msp, txTime.Add(time.Hour)),
+	}
+	chaincodeStub.GetPrivateDataStub = func(collection string, key string) ([]byte, error) {
+		return privateData[key], nil
+	}
+
+	err = assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "failed transfer verification: private details of id1 do not match the verified details")
+
+	setVerification := func(verifierMSP, collection, hash string) {
+		verificationBytes, err := json.Marshal(chaincode.AssetVerification{
+			ID:          "id1",
+			Collection:  collection,
+			VerifierMSP: verifierMSP,
+			Hash:        hash,
+		})
+		require.NoError(t, err)
+		privateData[assetVerificationObjectType+"id1"+verifierMSP] = verificationBytes
+	}
+
+	validHash := hex.EncodeToString([]byte("datahash"))
+	setVerification(myOrg2Msp, myOrg1PrivCollection, validHash)
+	err = assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "failed transfer verification: private details of id1 do not match the verified details")
+
+	setVerification(myOrg1Msp, myOrg2PrivCollection, hex.EncodeToString([]byte("stalehash")))
+	err = assetTransferCC.TransferAsset(transactionContext)
+	require.EqualError(t, err, "failed transfer verification: private details of id1 do not match the verified details")
+
+	setVerification(myOrg1Msp, myOrg2PrivCollection, validHash)
+	err = assetTransferCC.TransferAsset(transactionContext)
+	require.NoError(t, err)
+
+	// Verifications are deleted with the transfer agreement
+	deleted := []string{}
+	for i := 0; i < chaincodeStub.DelPrivateDataCallCount(); i++ {
+		_, key := chaincodeStub.DelPrivateDataArgsForCall(i)
+		deleted = append(deleted, key)
+	}
+	require.Equal(t, []string{
+		"id1",
+		transferAgreementObjectType + "id1",
+		assetVerificationObjectType + "id1" + myOrg1Msp,
+		assetVerificationObjectType + "id1" + myOrg2Msp,
+	}, deleted)
+}
+
 func prepMocksAsOrg1() (*mocks.TransactionContext, *mocks.ChaincodeStub) {
 	return prepMocks(myOrg1Msp, myOrg1Clientid)
 }
@@ -370,6 +642,7 @@ func prepMocks(orgMSP, clientId string) (*mocks.TransactionContext, *mocks.Chain
 	clientIdentity := &mocks.ClientIdentity{}
 	clientIdentity.GetMSPIDReturns(orgMSP, nil)
 	clientIdentity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(clientId)), nil)
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime), nil)
 	// set matching msp ID using peer shim env variable
 	os.Setenv("CORE_PEER_LOCALMSPID", orgMSP)
 	transactionContext.GetClientIdentityReturns(clientIdentity)
@@ -443,3 +716,15 @@ func setReturnAssetPrivateDetailsInStub(t *testing.T, chaincodeStub *mocks.Chain
 		return assetBytes
 	}
 }
+
+func transferAgreementBytes(t *testing.T, buyerID string, buyerMSP string, expiresAt time.Time) []byte {
+	agreementBytes, err := json.Marshal(chaincode.TransferAgreement{
+		ID:        "id1",
+		BuyerID:   buyerID,
+		BuyerMSP:  buyerMSP,
+		Nonce:     "tx1",
+		ExpiresAt: expiresAt,
+	})
+	require.NoError(t, err)
+	return agreementBytes
+}
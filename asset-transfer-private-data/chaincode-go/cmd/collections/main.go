@@ -0,0 +1,200 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+// Command collections generates the private data collection configuration for the asset transfer
+// private data chaincode. The configuration contains the assetCollection shared by all organizations,
+// and a <MSP ID>PrivateCollection for each organization, which is the collection name inferred by
+// the chaincode.
+//
+// Usage:
+//
+//	go run ./cmd/collections -orgs Org1MSP,Org2MSP,Org3MSP -output collections_config.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const assetCollection = "assetCollection"
+
+// CollectionConfig is a static collection definition, in the format accepted by the peer
+// lifecycle chaincode commands using the --collections-config flag.
+type CollectionConfig struct {
+	Name              string            `json:"name"`
+	Policy            string            `json:"policy"`
+	RequiredPeerCount int               `json:"requiredPeerCount"`
+	MaxPeerCount      int               `json:"maxPeerCount"`
+	BlockToLive       uint64            `json:"blockToLive"`
+	MemberOnlyRead    bool              `json:"memberOnlyRead"`
+	MemberOnlyWrite   bool              `json:"memberOnlyWrite"`
+	EndorsementPolicy EndorsementPolicy `json:"endorsementPolicy"`
+}
+
+// EndorsementPolicy is the collection level endorsement policy.
+type EndorsementPolicy struct {
+	SignaturePolicy string `json:"signaturePolicy"`
+}
+
+// Options control the generated collection configuration.
+type Options struct {
+	Orgs                    []string
+	SharedBlockToLive       uint64
+	SharedRequiredPeerCount int
+	SharedEndorsement       string
+	OrgBlockToLive          uint64
+	OrgRequiredPeerCount    int
+	MaxPeerCount            int
+}
+
+func main() {
+	orgs := flag.String("orgs", "Org1MSP,Org2MSP", "comma separated MSP IDs of the organizations")
+	output := flag.String("output", "-", "file to write the collection configuration to, or - for stdout")
+	sharedBlockToLive := flag.Uint64("shared-block-to-live", 1000000, "blockToLive of the shared asset collection, 0 to keep forever")
+	sharedRequiredPeers := flag.Int("shared-required-peers", 1, "requiredPeerCount of the shared asset collection")
+	sharedEndorsement := flag.String("shared-endorsement", "any", "endorsement policy of the shared asset collection: any, majority or all")
+	orgBlockToLive := flag.Uint64("org-block-to-live", 3, "blockToLive of the organization collections, 0 to keep forever")
+	orgRequiredPeers := flag.Int("org-required-peers", 0, "requiredPeerCount of the organization collections")
+	maxPeers := flag.Int("max-peers", 1, "maxPeerCount of all collections")
+	flag.Parse()
+
+	options := Options{
+		Orgs:                    splitOrgs(*orgs),
+		SharedBlockToLive:       *sharedBlockToLive,
+		SharedRequiredPeerCount: *sharedRequiredPeers,
+		SharedEndorsement:       *sharedEndorsement,
+		OrgBlockToLive:          *orgBlockToLive,
+		OrgRequiredPeerCount:    *orgRequiredPeers,
+		MaxPeerCount:            *maxPeers,
+	}
+
+	configs, err := Generate(options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating collection configuration: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := write(*output, configs); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing collection configuration: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Generate creates the shared asset collection followed by one private collection per organization.
+func Generate(options Options) ([]CollectionConfig, error) {
+	if len(options.Orgs) == 0 {
+		return nil, fmt.Errorf("at least one organization is required")
+	}
+	if options.MaxPeerCount < options.SharedRequiredPeerCount || options.MaxPeerCount < options.OrgRequiredPeerCount {
+		return nil, fmt.Errorf("maxPeerCount %d must not be less than requiredPeerCount", options.MaxPeerCount)
+	}
+
+	seen := make(map[string]bool)
+	members := make([]string, 0, len(options.Orgs))
+	for _, org := range options.Orgs {
+		if strings.ContainsAny(org, "'(), ") {
+			return nil, fmt.Errorf("invalid MSP ID %q", org)
+		}
+		if seen[org] {
+			return nil, fmt.Errorf("duplicate MSP ID %q", org)
+		}
+		seen[org] = true
+		members = append(members, member(org))
+	}
+
+	sharedEndorsement, err := endorsementPolicy(options.SharedEndorsement, members)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []CollectionConfig{{
+		Name:              assetCollection,
+		Policy:            orPolicy(members),
+		RequiredPeerCount: options.SharedRequiredPeerCount,
+		MaxPeerCount:      options.MaxPeerCount,
+		BlockToLive:       options.SharedBlockToLive,
+		MemberOnlyRead:    true,
+		MemberOnlyWrite:   true,
+		EndorsementPolicy: EndorsementPolicy{SignaturePolicy: sharedEndorsement},
+	}}
+
+	// Organization collections are written by other members during a transfer, but endorsed
+	// only by the owning organization
+	for _, org := range options.Orgs {
+		policy := orPolicy([]string{member(org)})
+		configs = append(configs, CollectionConfig{
+			Name:              org + "PrivateCollection",
+			Policy:            policy,
+			RequiredPeerCount: options.OrgRequiredPeerCount,
+			MaxPeerCount:      options.MaxPeerCount,
+			BlockToLive:       options.OrgBlockToLive,
+			MemberOnlyRead:    true,
+			MemberOnlyWrite:   false,
+			EndorsementPolicy: EndorsementPolicy{SignaturePolicy: policy},
+		})
+	}
+
+	return configs, nil
+}
+
+func endorsementPolicy(rule string, members []string) (string, error) {
+	switch rule {
+	case "any":
+		return orPolicy(members), nil
+	case "majority":
+		return fmt.Sprintf("OutOf(%d, %s)", len(members)/2+1, strings.Join(quote(members), ", ")), nil
+	case "all":
+		return fmt.Sprintf("AND(%s)", strings.Join(quote(members), ", ")), nil
+	default:
+		return "", fmt.Errorf("unknown endorsement policy %q, expected any, majority or all", rule)
+	}
+}
+
+func orPolicy(members []string) string {
+	return fmt.Sprintf("OR(%s)", strings.Join(quote(members), ", "))
+}
+
+func member(mspID string) string {
+	return mspID + ".member"
+}
+
+func quote(values []string) []string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, "'"+value+"'")
+	}
+	return quoted
+}
+
+func splitOrgs(orgs string) []string {
+	var result []string
+	for _, org := range strings.Split(orgs, ",") {
+		if org = strings.TrimSpace(org); org != "" {
+			result = append(result, org)
+		}
+	}
+	return result
+}
+
+func write(output string, configs []CollectionConfig) error {
+	var out io.Writer = os.Stdout
+	if output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(configs)
+}
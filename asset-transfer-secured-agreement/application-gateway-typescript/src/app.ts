@@ -203,6 +203,9 @@ async function main(): Promise<void> {
         // Read the public details by org2.
         await contractWrapperOrg2.readAsset(assetKey, mspIdOrg2);
 
+        // Org1 exports a statement of its receipts, signed by its peer, for an auditor.
+        await contractWrapperOrg1.exportReceipts('', '');
+
     } finally {
         gatewayOrg1.close();
         gatewayOrg2.close();
@@ -7,6 +7,7 @@ import { Contract } from '@hyperledger/fabric-gateway';
 import { TextDecoder } from 'util';
 import { GREEN, parse, RED, RESET } from './utils';
 import crypto from 'crypto';
+import { promises as fs } from 'fs';
 import { mspIdOrg2 } from './connect';
 
 const randomBytes = crypto.randomBytes(256).toString('hex');
@@ -31,6 +32,12 @@ interface AssetPriceJSON {
     tradeID: string;
 }
 
+interface ReceiptStatementJSON {
+    orgID: string;
+    txID: string;
+    entries: { type: string; key: string; hash: string }[];
+}
+
 export interface AssetPrivateData {
     ObjectType: string;
     Color: string;
@@ -268,4 +275,24 @@ export class ContractWrapper {
 
         console.log(`${GREEN}*** Result: committed, ${this.#org} has transfered the asset ${assetPrice.assetId} to ${buyerOrgID}.${RESET}`);
     }
+
+    public async exportReceipts(fromTime: string, toTime: string): Promise<string> {
+
+        console.log(`${GREEN}--> Endorse Transaction: ExportReceipts as ${this.#org} - endorsed by ${this.#org}, not submitted.${RESET}`);
+
+        // The endorsing peer signs the statement in its proposal response, so the endorsed transaction
+        // is kept as the verifiable export. It is not submitted since ExportReceipts does not update the ledger.
+        const proposal = this.#contract.newProposal('ExportReceipts', {
+            arguments: [fromTime, toTime],
+            endorsingOrganizations: [this.#org],
+        });
+        const transaction = await proposal.endorse();
+
+        const statement = parse<ReceiptStatementJSON>(this.#utf8Decoder.decode(transaction.getResult()));
+        const fileName = `receipts-${statement.orgID}-${statement.txID}.pb`;
+        await fs.writeFile(fileName, transaction.getBytes());
+
+        console.log(`*** Result: statement of ${statement.entries.length} receipts of ${statement.orgID}, endorsed transaction written to ${fileName}`);
+        return fileName;
+    }
 }
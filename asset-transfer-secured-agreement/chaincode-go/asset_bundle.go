@@ -0,0 +1,326 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const typeBundleAgreement = "BA"
+
+// BundleAgreement describes a trade of several assets between two orgs. The seller org transfers
+// the seller assets to the buyer org, and the buyer org transfers the buyer assets, if any, to the
+// seller org for the agreed price. Both orgs agree to the same bundle by storing it in their implicit
+// private data collection, so only the hash of the bundle is public.
+type BundleAgreement struct {
+	TradeID      string   `json:"trade_id"`
+	SellerOrg    string   `json:"seller_org"`
+	BuyerOrg     string   `json:"buyer_org"`
+	SellerAssets []string `json:"seller_assets"`
+	BuyerAssets  []string `json:"buyer_assets"`
+	Price        int      `json:"price"`
+}
+
+// AgreeToBundle adds the bundle agreement passed in the bundle transient field to the client's
+// implicit private data collection. The client org must be the seller or buyer org of the bundle and
+// own the assets that it transfers. The private properties of the assets that the client org
+// receives must be passed in the bundle_asset_properties transient field, as a JSON object of asset
+// IDs to properties, so that they can be verified against the properties of the current owner.
+func (s *SmartContract) AgreeToBundle(ctx contractapi.TransactionContextInterface, tradeID string) error {
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient: %v", err)
+	}
+
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Verify that this client belongs to the peer's org
+	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	if err != nil {
+		return err
+	}
+
+	bundleJSON, ok := transientMap["bundle"]
+	if !ok {
+		return fmt.Errorf("bundle key not found in the transient map")
+	}
+
+	bundle, err := parseBundleAgreement(bundleJSON, tradeID)
+	if err != nil {
+		return err
+	}
+
+	var givenAssets, receivedAssets []string
+	switch clientOrgID {
+	case bundle.SellerOrg:
+		givenAssets, receivedAssets = bundle.SellerAssets, bundle.BuyerAssets
+	case bundle.BuyerOrg:
+		givenAssets, receivedAssets = bundle.BuyerAssets, bundle.SellerAssets
+	default:
+		return fmt.Errorf("a client from %s cannot agree to bundle %s between %s and %s", clientOrgID, tradeID, bundle.SellerOrg, bundle.BuyerOrg)
+	}
+
+	// Verify that this clientOrgId actually owns the assets it gives
+	for _, assetID := range givenAssets {
+		asset, err := s.ReadAsset(ctx, assetID)
+		if err != nil {
+			return err
+		}
+		if clientOrgID != asset.OwnerOrg {
+			return fmt.Errorf("a client from %s cannot trade asset %s owned by %s", clientOrgID, assetID, asset.OwnerOrg)
+		}
+	}
+
+	collection := buildCollectionName(clientOrgID)
+
+	if len(receivedAssets) > 0 {
+		propertiesJSON, ok := transientMap["bundle_asset_properties"]
+		if !ok {
+			return fmt.Errorf("bundle_asset_properties key not found in the transient map")
+		}
+		var properties map[string]string
+		err = json.Unmarshal(propertiesJSON, &properties)
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal bundle asset properties JSON: %v", err)
+		}
+
+		// Persist private immutable asset properties of the received assets to the client's private data collection
+		for _, assetID := range receivedAssets {
+			immutableProperties, ok := properties[assetID]
+			if !ok {
+				return fmt.Errorf("private properties of asset %s not found in bundle_asset_properties", assetID)
+			}
+			hash := sha256.Sum256([]byte(immutableProperties))
+			if hex.EncodeToString(hash[:]) != assetID {
+				return fmt.Errorf("hash %x of the passed private properties does not match asset %s", hash, assetID)
+			}
+			err = ctx.GetStub().PutPrivateData(collection, assetID, []byte(immutableProperties))
+			if err != nil {
+				return fmt.Errorf("failed to put Asset private details: %v", err)
+			}
+		}
+	}
+
+	bundleKey, err := ctx.GetStub().CreateCompositeKey(typeBundleAgreement, []string{tradeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	// The bundle hash will be verified later, therefore persist the bundle bytes as is,
+	// so that there is no risk of nondeterministic marshaling.
+	err = ctx.GetStub().PutPrivateData(collection, bundleKey, bundleJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put bundle agreement: %v", err)
+	}
+
+	return nil
+}
+
+// GetBundleAgreement returns a bundle agreement from the client's implicit private data collection
+func (s *SmartContract) GetBundleAgreement(ctx contractapi.TransactionContextInterface, tradeID string) (string, error) {
+	collection, err := getClientImplicitCollectionNameAndVerifyClientOrg(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	bundleKey, err := ctx.GetStub().CreateCompositeKey(typeBundleAgreement, []string{tradeID})
+	if err != nil {
+		return "", fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	bundleJSON, err := ctx.GetStub().GetPrivateData(collection, bundleKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read bundle agreement from implicit private data collection: %v", err)
+	}
+	if bundleJSON == nil {
+		return "", fmt.Errorf("bundle agreement does not exist: %s", tradeID)
+	}
+
+	return string(bundleJSON), nil
+}
+
+// TransferBundle checks that both orgs agreed to the bundle passed in the bundle transient field,
+// and then transfers all of the assets in the bundle in a single transaction. Either org of the
+// bundle can submit the transfer, which must be endorsed by the peers of both orgs when both orgs
+// transfer assets. If any check fails, no asset is transferred.
+func (s *SmartContract) TransferBundle(ctx contractapi.TransactionContextInterface, tradeID string) error {
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return err
+	}
+
+	transMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return fmt.Errorf("error getting transient data: %v", err)
+	}
+
+	bundleJSON, ok := transMap["bundle"]
+	if !ok {
+		return fmt.Errorf("bundle key not found in the transient map")
+	}
+
+	bundle, err := parseBundleAgreement(bundleJSON, tradeID)
+	if err != nil {
+		return err
+	}
+
+	if clientOrgID != bundle.SellerOrg && clientOrgID != bundle.BuyerOrg {
+		return fmt.Errorf("a client from %s cannot transfer bundle %s between %s and %s", clientOrgID, tradeID, bundle.SellerOrg, bundle.BuyerOrg)
+	}
+
+	// Verify every asset and both agreements before any state is updated
+	sellerAssets, err := s.verifyBundleAssets(ctx, bundle.SellerAssets, bundle.SellerOrg, bundle.BuyerOrg)
+	if err != nil {
+		return fmt.Errorf("failed transfer verification: %v", err)
+	}
+	buyerAssets, err := s.verifyBundleAssets(ctx, bundle.BuyerAssets, bundle.BuyerOrg, bundle.SellerOrg)
+	if err != nil {
+		return fmt.Errorf("failed transfer verification: %v", err)
+	}
+
+	bundleKey, err := ctx.GetStub().CreateCompositeKey(typeBundleAgreement, []string{tradeID})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	hash := sha256.New()
+	hash.Write(bundleJSON)
+	calculatedBundleHash := hash.Sum(nil)
+
+	for _, orgID := range []string{bundle.SellerOrg, bundle.BuyerOrg} {
+		bundleHash, err := ctx.GetStub().GetPrivateDataHash(buildCollectionName(orgID), bundleKey)
+		if err != nil {
+			return fmt.Errorf("failed to get bundle agreement hash of %s: %v", orgID, err)
+		}
+		if bundleHash == nil {
+			return fmt.Errorf("failed transfer verification: %s has not agreed to bundle %s", orgID, tradeID)
+		}
+		if !bytes.Equal(calculatedBundleHash, bundleHash) {
+			return fmt.Errorf("failed transfer verification: hash %x for passed bundle JSON %s does not match on-chain hash %x, %s hasn't agreed to the passed bundle",
+				calculatedBundleHash,
+				bundleJSON,
+				bundleHash,
+				orgID,
+			)
+		}
+	}
+
+	for _, asset := range sellerAssets {
+		err = transferBundleAsset(ctx, asset, bundle.SellerOrg, bundle.BuyerOrg, bundle)
+		if err != nil {
+			return fmt.Errorf("failed asset transfer: %v", err)
+		}
+	}
+	for _, asset := range buyerAssets {
+		err = transferBundleAsset(ctx, asset, bundle.BuyerOrg, bundle.SellerOrg, bundle)
+		if err != nil {
+			return fmt.Errorf("failed asset transfer: %v", err)
+		}
+	}
+
+	// Delete the bundle agreements of both orgs
+	for _, orgID := range []string{bundle.SellerOrg, bundle.BuyerOrg} {
+		err = ctx.GetStub().DelPrivateData(buildCollectionName(orgID), bundleKey)
+		if err != nil {
+			return fmt.Errorf("failed to delete bundle agreement from implicit private data collection of %s: %v", orgID, err)
+		}
+	}
+
+	return nil
+}
+
+// transferBundleAsset transfers an asset in a bundle, closing the offers for the asset and deleting
+// its agreed prices. The receipts of the asset record the trade ID and price of the bundle.
+func transferBundleAsset(ctx contractapi.TransactionContextInterface, asset *Asset, fromOrgID string, toOrgID string, bundle *BundleAgreement) error {
+	err := closeOffers(ctx, asset.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	err = transferAssetOwnership(ctx, asset, fromOrgID, toOrgID)
+	if err != nil {
+		return err
+	}
+
+	err = deleteAssetPrices(ctx, asset.ID, fromOrgID, toOrgID)
+	if err != nil {
+		return err
+	}
+
+	return putAssetReceipts(ctx, &Receipt{
+		AssetID:     asset.ID,
+		SellerOrg:   fromOrgID,
+		BuyerOrg:    toOrgID,
+		TradeID:     bundle.TradeID,
+		BundlePrice: bundle.Price,
+	})
+}
+
+// verifyBundleAssets checks that the assets given by an org in a bundle are owned by the org, and
+// that the on-chain hashes of their private properties match in the collections of both orgs
+func (s *SmartContract) verifyBundleAssets(ctx contractapi.TransactionContextInterface, assetIDs []string, fromOrgID string, toOrgID string) ([]*Asset, error) {
+	var assets []*Asset
+	for _, assetID := range assetIDs {
+		asset, err := s.ReadAsset(ctx, assetID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get asset: %v", err)
+		}
+		if asset.OwnerOrg != fromOrgID {
+			return nil, fmt.Errorf("asset %s is owned by %s, not %s", assetID, asset.OwnerOrg, fromOrgID)
+		}
+
+		err = verifyAssetPropertiesHashes(ctx, assetID, fromOrgID, toOrgID)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+// parseBundleAgreement parses and validates a bundle agreement for a trade ID
+func parseBundleAgreement(bundleJSON []byte, tradeID string) (*BundleAgreement, error) {
+	var bundle BundleAgreement
+	err := json.Unmarshal(bundleJSON, &bundle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal bundle JSON: %v", err)
+	}
+
+	if bundle.TradeID != tradeID {
+		return nil, fmt.Errorf("bundle trade id %s does not match %s", bundle.TradeID, tradeID)
+	}
+	if bundle.SellerOrg == "" || bundle.BuyerOrg == "" {
+		return nil, fmt.Errorf("bundle %s must have a seller org and a buyer org", tradeID)
+	}
+	if bundle.SellerOrg == bundle.BuyerOrg {
+		return nil, fmt.Errorf("seller org and buyer org of bundle %s must be different", tradeID)
+	}
+	if len(bundle.SellerAssets) == 0 {
+		return nil, fmt.Errorf("bundle %s must have at least one seller asset", tradeID)
+	}
+	if bundle.Price < 0 {
+		return nil, fmt.Errorf("price of bundle %s must not be negative", tradeID)
+	}
+
+	seen := make(map[string]bool)
+	for _, assetID := range append(append([]string{}, bundle.SellerAssets...), bundle.BuyerAssets...) {
+		if seen[assetID] {
+			return nil, fmt.Errorf("asset %s appears more than once in bundle %s", assetID, tradeID)
+		}
+		seen[assetID] = true
+	}
+
+	return &bundle, nil
+}
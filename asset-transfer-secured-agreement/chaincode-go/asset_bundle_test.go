@@ -0,0 +1,158 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferBundle(t *testing.T) {
+	ledger, bundle := prepBundleLedger(t)
+	assetTransfer := SmartContract{}
+
+	sellerAsset1, sellerAsset2, buyerAsset := bundle.SellerAssets[0], bundle.SellerAssets[1], bundle.BuyerAssets[0]
+
+	// Prices agreed for a single asset before the bundle are no longer valid after the transfer
+	ledger.private[buildCollectionName(sellerMsp)][compositeKey(typeAssetForSale, sellerAsset1)] = []byte(sellPrice)
+	ledger.private[buildCollectionName(buyerMsp)][compositeKey(typeAssetBid, sellerAsset1)] = []byte(sellPrice)
+
+	ledger.setClient(sellerMsp)
+	err := assetTransfer.TransferBundle(ledger.ctx, bundle.TradeID)
+	require.NoError(t, err)
+
+	for assetID, ownerOrgID := range map[string]string{sellerAsset1: buyerMsp, sellerAsset2: buyerMsp, buyerAsset: sellerMsp} {
+		asset, err := assetTransfer.ReadAsset(ledger.ctx, assetID)
+		require.NoError(t, err)
+		require.Equal(t, ownerOrgID, asset.OwnerOrg)
+	}
+
+	require.NotContains(t, ledger.private[buildCollectionName(sellerMsp)], compositeKey(typeAssetForSale, sellerAsset1))
+	require.NotContains(t, ledger.private[buildCollectionName(buyerMsp)], compositeKey(typeAssetBid, sellerAsset1))
+	require.NotContains(t, ledger.private[buildCollectionName(sellerMsp)], compositeKey(typeBundleAgreement, bundle.TradeID))
+	require.NotContains(t, ledger.private[buildCollectionName(buyerMsp)], compositeKey(typeBundleAgreement, bundle.TradeID))
+
+	// Each asset has a receipt with the bundle price in the collections of both orgs
+	for _, assetID := range []string{sellerAsset1, sellerAsset2} {
+		receipt := bundleReceipt(t, ledger, sellerMsp, compositeKey(typeAssetSaleReceipt, "tx1", assetID))
+		require.Equal(t, assetID, receipt.AssetID)
+		require.Equal(t, sellerMsp, receipt.SellerOrg)
+		require.Equal(t, buyerMsp, receipt.BuyerOrg)
+		require.Equal(t, 0, receipt.Price)
+		require.Equal(t, bundle.TradeID, receipt.TradeID)
+		require.Equal(t, bundle.Price, receipt.BundlePrice)
+		require.Equal(t, txTime, receipt.Timestamp)
+		require.Equal(t, receipt, bundleReceipt(t, ledger, buyerMsp, compositeKey(typeAssetBuyReceipt, assetID, "tx1")))
+	}
+	receipt := bundleReceipt(t, ledger, buyerMsp, compositeKey(typeAssetSaleReceipt, "tx1", buyerAsset))
+	require.Equal(t, buyerMsp, receipt.SellerOrg)
+	require.Equal(t, sellerMsp, receipt.BuyerOrg)
+	require.Equal(t, bundle.TradeID, receipt.TradeID)
+	require.Equal(t, receipt, bundleReceipt(t, ledger, sellerMsp, compositeKey(typeAssetBuyReceipt, buyerAsset, "tx1")))
+}
+
+func TestTransferBundleClosesOffers(t *testing.T) {
+	ledger, bundle := prepBundleLedger(t)
+	assetTransfer := SmartContract{}
+
+	ledger.setClient(buyerMsp)
+	ledger.setPrice(counterPrice)
+	ledger.transient["asset_properties"] = ledger.private[buildCollectionName(sellerMsp)][bundle.SellerAssets[0]]
+	_, err := assetTransfer.MakeOffer(ledger.ctx, bundle.SellerAssets[0], "2024-01-02T00:00:00Z", 0)
+	require.NoError(t, err)
+
+	err = assetTransfer.TransferBundle(ledger.ctx, bundle.TradeID)
+	require.NoError(t, err)
+
+	offers, err := assetTransfer.ListOffers(ledger.ctx, bundle.SellerAssets[0])
+	require.NoError(t, err)
+	require.Equal(t, offerStatusClosed, offers[0].Status)
+}
+
+func TestTransferBundleNotAgreed(t *testing.T) {
+	ledger, bundle := prepBundleLedger(t)
+	assetTransfer := SmartContract{}
+
+	// The buyer agreed to a different price
+	changedBundle := *bundle
+	changedBundle.Price = 100
+	changedBundleJSON, err := json.Marshal(&changedBundle)
+	require.NoError(t, err)
+	ledger.setClient(buyerMsp)
+	ledger.transient["bundle"] = changedBundleJSON
+	err = assetTransfer.AgreeToBundle(ledger.ctx, bundle.TradeID)
+	require.NoError(t, err)
+
+	ledger.setClient(sellerMsp)
+	ledger.transient["bundle"], err = json.Marshal(bundle)
+	require.NoError(t, err)
+	err = assetTransfer.TransferBundle(ledger.ctx, bundle.TradeID)
+	require.ErrorContains(t, err, "Org2Testmsp hasn't agreed to the passed bundle")
+
+	asset, err := assetTransfer.ReadAsset(ledger.ctx, bundle.SellerAssets[0])
+	require.NoError(t, err)
+	require.Equal(t, sellerMsp, asset.OwnerOrg)
+
+	err = assetTransfer.TransferBundle(ledger.ctx, "trade2")
+	require.EqualError(t, err, "bundle trade id bundle1 does not match trade2")
+
+	ledger.setClient("Org3Testmsp")
+	err = assetTransfer.TransferBundle(ledger.ctx, bundle.TradeID)
+	require.EqualError(t, err, "a client from Org3Testmsp cannot transfer bundle bundle1 between Org1Testmsp and Org2Testmsp")
+}
+
+// prepBundleLedger returns a ledger with two seller assets and a buyer asset, and a bundle that both
+// orgs agreed to, which trades the assets between them
+func prepBundleLedger(t *testing.T) (*fakeLedger, *BundleAgreement) {
+	ledger := newFakeLedger(t)
+	properties := map[string]string{}
+	var assetIDs []string
+	for i, ownerOrgID := range []string{sellerMsp, sellerMsp, buyerMsp} {
+		immutableProperties := `{"object_type":"asset_properties","color":"blue","size":` + string(rune('1'+i)) + `}`
+		hash := sha256.Sum256([]byte(immutableProperties))
+		assetID := hex.EncodeToString(hash[:])
+		assetIDs = append(assetIDs, assetID)
+		properties[assetID] = immutableProperties
+
+		ledger.putAsset(t, assetID, ownerOrgID)
+		require.NoError(t, ledger.stub.PutPrivateData(buildCollectionName(ownerOrgID), assetID, []byte(immutableProperties)))
+	}
+
+	bundle := &BundleAgreement{
+		TradeID:      "bundle1",
+		SellerOrg:    sellerMsp,
+		BuyerOrg:     buyerMsp,
+		SellerAssets: assetIDs[:2],
+		BuyerAssets:  assetIDs[2:],
+		Price:        500,
+	}
+	bundleJSON, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	propertiesJSON, err := json.Marshal(properties)
+	require.NoError(t, err)
+	ledger.transient["bundle"] = bundleJSON
+	ledger.transient["bundle_asset_properties"] = propertiesJSON
+
+	assetTransfer := SmartContract{}
+	for _, orgID := range []string{sellerMsp, buyerMsp} {
+		ledger.setClient(orgID)
+		require.NoError(t, assetTransfer.AgreeToBundle(ledger.ctx, bundle.TradeID))
+	}
+
+	return ledger, bundle
+}
+
+func bundleReceipt(t *testing.T, ledger *fakeLedger, orgID string, key string) *Receipt {
+	receiptJSON, ok := ledger.private[buildCollectionName(orgID)][key]
+	require.True(t, ok, "receipt not found in the collection of %s", orgID)
+
+	var receipt Receipt
+	require.NoError(t, json.Unmarshal(receiptJSON, &receipt))
+	return &receipt
+}
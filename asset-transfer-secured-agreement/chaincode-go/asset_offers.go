@@ -0,0 +1,519 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"google.golang.org/protobuf/proto"
+)
+
+const typeOffer = "OF"
+
+// Offer types
+const (
+	offerTypeSell = "sell"
+	offerTypeBuy  = "buy"
+)
+
+// Offer statuses
+const (
+	offerStatusOpen       = "open"
+	offerStatusExpired    = "expired"
+	offerStatusCountered  = "countered"
+	offerStatusSuperseded = "superseded"
+	offerStatusAccepted   = "accepted"
+	offerStatusClosed     = "closed"
+)
+
+// Offer is a public record of an offer to sell or buy an asset. The offered price stays in the
+// implicit private data collection of the offering org, and only its hash is public. As the hash
+// covers the whole agreement JSON, the trade ID should be hard to guess so that the price cannot be
+// recovered from the hash.
+// Each offer can only be updated with the endorsement of the offering org or the owner org, so a
+// counter-offer or an acceptance is recorded as a new offer of the other org, with CounterTo or
+// Accepts set to the sequence number of the offer it answers.
+type Offer struct {
+	AssetID   string    `json:"assetID"`
+	Seq       int       `json:"seq"`
+	OfferOrg  string    `json:"offerOrg"`
+	Type      string    `json:"type"`
+	PriceHash string    `json:"priceHash"`
+	CounterTo int       `json:"counterTo,omitempty" metadata:",optional"`
+	Accepts   int       `json:"accepts,omitempty" metadata:",optional"`
+	Timestamp time.Time `json:"timestamp"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Status    string    `json:"status"`
+}
+
+// MakeOffer adds an offer to the offer log of an asset, and returns its sequence number. The
+// owner org makes offers to sell and other orgs make offers to buy. As for AgreeToSell and
+// AgreeToBuy, the price is passed in the asset_price transient field and stored in the client's
+// implicit private data collection, and an offer to buy also requires the asset_properties
+// transient field. A new offer replaces the open offers of the same org. To counter an open offer
+// from the other side, pass its sequence number as counterTo, or 0 for a new offer. The offer can
+// only be accepted until expiresAt, an RFC 3339 timestamp.
+func (s *SmartContract) MakeOffer(ctx contractapi.TransactionContextInterface, assetID string, expiresAt string, counterTo int) (int, error) {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return 0, err
+	}
+
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Verify that this client belongs to the peer's org
+	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	if err != nil {
+		return 0, err
+	}
+
+	expiry, err := time.Parse(time.RFC3339, expiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("expiresAt must be an RFC 3339 timestamp: %v", err)
+	}
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if !expiry.After(now) {
+		return 0, fmt.Errorf("expiresAt %s must be after the transaction time %s", expiresAt, now.Format(time.RFC3339))
+	}
+
+	offers, err := readOffers(ctx, assetID)
+	if err != nil {
+		return 0, err
+	}
+
+	if counterTo != 0 {
+		countered, err := findOffer(offers, counterTo)
+		if err != nil {
+			return 0, err
+		}
+		if countered.OfferOrg == clientOrgID {
+			return 0, fmt.Errorf("a client from %s cannot counter its own offer %d", clientOrgID, counterTo)
+		}
+		if err := verifyOfferOpen(countered, now); err != nil {
+			return 0, err
+		}
+	}
+
+	offerType, err := agreeToOffer(ctx, asset, clientOrgID)
+	if err != nil {
+		return 0, err
+	}
+
+	// The price agreed to by the org is replaced, so its previous open offers can no longer be accepted
+	err = supersedeOffers(ctx, offers, clientOrgID)
+	if err != nil {
+		return 0, err
+	}
+
+	priceHash, err := transientPriceHash(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	offer := &Offer{
+		AssetID:   assetID,
+		Seq:       nextOfferSeq(offers),
+		OfferOrg:  clientOrgID,
+		Type:      offerType,
+		PriceHash: priceHash,
+		CounterTo: counterTo,
+		Timestamp: now.UTC(),
+		ExpiresAt: expiry.UTC(),
+		Status:    offerStatusOpen,
+	}
+	err = addOffer(ctx, offer, asset.OwnerOrg)
+	if err != nil {
+		return 0, err
+	}
+
+	return offer.Seq, nil
+}
+
+// ListOffers returns the offer log of an asset, ordered by sequence number. Open offers that have
+// been countered or accepted are returned with the countered or accepted status, and open offers
+// that have passed their expiry with the expired status.
+func (s *SmartContract) ListOffers(ctx contractapi.TransactionContextInterface, assetID string) ([]*Offer, error) {
+	offers, err := readOffers(ctx, assetID)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, offer := range offers {
+		if offer.Status == offerStatusOpen && !now.Before(offer.ExpiresAt) {
+			offer.Status = offerStatusExpired
+		}
+	}
+
+	return offers, nil
+}
+
+// AcceptOffer accepts an open offer from the other side before it expires, and returns the sequence
+// number of the acceptance in the offer log. The price passed in the asset_price transient field must
+// match the hash of the offer, and is stored in the client's implicit private data collection in the
+// same way as AgreeToSell or AgreeToBuy. Accepting an offer to sell also requires the
+// asset_properties transient field. The owner org can then transfer the asset to the buyer org with
+// TransferAsset, passing the same price.
+func (s *SmartContract) AcceptOffer(ctx contractapi.TransactionContextInterface, assetID string, offerSeq int) (int, error) {
+	asset, err := s.ReadAsset(ctx, assetID)
+	if err != nil {
+		return 0, err
+	}
+
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	// Verify that this client belongs to the peer's org
+	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	if err != nil {
+		return 0, err
+	}
+
+	offers, err := readOffers(ctx, assetID)
+	if err != nil {
+		return 0, err
+	}
+	offer, err := findOffer(offers, offerSeq)
+	if err != nil {
+		return 0, err
+	}
+	if offer.OfferOrg == clientOrgID {
+		return 0, fmt.Errorf("a client from %s cannot accept its own offer %d", clientOrgID, offerSeq)
+	}
+
+	now, err := getTxTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyOfferOpen(offer, now); err != nil {
+		return 0, err
+	}
+
+	priceHash, err := transientPriceHash(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if priceHash != offer.PriceHash {
+		return 0, fmt.Errorf("hash %s for passed price JSON does not match the hash %s of offer %d", priceHash, offer.PriceHash, offerSeq)
+	}
+
+	// An offer to sell is accepted by a buyer, and an offer to buy by the owner
+	if (clientOrgID == asset.OwnerOrg) == (offer.Type == offerTypeSell) {
+		return 0, fmt.Errorf("a client from %s cannot accept an offer to %s asset %s", clientOrgID, offer.Type, assetID)
+	}
+	offerType, err := agreeToOffer(ctx, asset, clientOrgID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = supersedeOffers(ctx, offers, clientOrgID)
+	if err != nil {
+		return 0, err
+	}
+
+	acceptance := &Offer{
+		AssetID:   assetID,
+		Seq:       nextOfferSeq(offers),
+		OfferOrg:  clientOrgID,
+		Type:      offerType,
+		PriceHash: priceHash,
+		Accepts:   offerSeq,
+		Timestamp: now.UTC(),
+		ExpiresAt: offer.ExpiresAt,
+		Status:    offerStatusAccepted,
+	}
+	err = addOffer(ctx, acceptance, asset.OwnerOrg)
+	if err != nil {
+		return 0, err
+	}
+
+	return acceptance.Seq, nil
+}
+
+// closeOffers checks, when offers for an asset have been accepted, that the transferred price is the
+// price of an accepted offer, and then closes the open and accepted offers. The price is not checked
+// if priceJSON is nil, for assets transferred in a bundle.
+func closeOffers(ctx contractapi.TransactionContextInterface, assetID string, priceJSON []byte) error {
+	offers, err := readOffers(ctx, assetID)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.Sum256(priceJSON)
+	priceHash := hex.EncodeToString(hash[:])
+
+	hasAccepted := false
+	matchesAccepted := false
+	for _, offer := range offers {
+		if offer.Status == offerStatusAccepted {
+			hasAccepted = true
+			matchesAccepted = matchesAccepted || offer.PriceHash == priceHash
+		}
+	}
+	if priceJSON != nil && hasAccepted && !matchesAccepted {
+		return fmt.Errorf("passed price does not match the price of an accepted offer for asset %s", assetID)
+	}
+
+	for _, offer := range offers {
+		if offer.Status == offerStatusAccepted || offer.Status == offerStatusOpen {
+			offer.Status = offerStatusClosed
+			err = putOffer(ctx, offer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// agreeToOffer stores the price, and for buyers the asset properties, of an offer or accepted offer
+// in the client's implicit private data collection, and returns the offer type of the client
+func agreeToOffer(ctx contractapi.TransactionContextInterface, asset *Asset, clientOrgID string) (string, error) {
+	if clientOrgID == asset.OwnerOrg {
+		return offerTypeSell, agreeToPrice(ctx, asset.ID, typeAssetForSale)
+	}
+
+	transientMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("error getting transient: %v", err)
+	}
+
+	// Asset properties must be retrieved from the transient field as they are private
+	immutablePropertiesJSON, ok := transientMap["asset_properties"]
+	if !ok {
+		return "", fmt.Errorf("asset_properties key not found in the transient map")
+	}
+
+	collection := buildCollectionName(clientOrgID)
+	err = ctx.GetStub().PutPrivateData(collection, asset.ID, immutablePropertiesJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to put Asset private details: %v", err)
+	}
+
+	return offerTypeBuy, agreeToPrice(ctx, asset.ID, typeAssetBid)
+}
+
+// supersedeOffers marks the open offers of an org as superseded
+func supersedeOffers(ctx contractapi.TransactionContextInterface, offers []*Offer, orgID string) error {
+	for _, offer := range offers {
+		if offer.OfferOrg == orgID && offer.Status == offerStatusOpen {
+			offer.Status = offerStatusSuperseded
+			err := putOffer(ctx, offer)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func verifyOfferOpen(offer *Offer, now time.Time) error {
+	if offer.Status != offerStatusOpen {
+		return fmt.Errorf("offer %d for asset %s is %s", offer.Seq, offer.AssetID, offer.Status)
+	}
+	if !now.Before(offer.ExpiresAt) {
+		return fmt.Errorf("offer %d for asset %s expired at %s", offer.Seq, offer.AssetID, offer.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// transientPriceHash returns the hex encoded hash of the asset_price transient field
+func transientPriceHash(ctx contractapi.TransactionContextInterface) (string, error) {
+	transMap, err := ctx.GetStub().GetTransient()
+	if err != nil {
+		return "", fmt.Errorf("error getting transient: %v", err)
+	}
+
+	price, ok := transMap["asset_price"]
+	if !ok {
+		return "", fmt.Errorf("asset_price key not found in the transient map")
+	}
+
+	hash := sha256.Sum256(price)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func findOffer(offers []*Offer, seq int) (*Offer, error) {
+	for _, offer := range offers {
+		if offer.Seq == seq {
+			return offer, nil
+		}
+	}
+
+	return nil, fmt.Errorf("offer %d does not exist", seq)
+}
+
+// nextOfferSeq returns the sequence number of the next offer in an offer log
+func nextOfferSeq(offers []*Offer) int {
+	seq := 1
+	for _, offer := range offers {
+		if offer.Seq >= seq {
+			seq = offer.Seq + 1
+		}
+	}
+
+	return seq
+}
+
+// readOffers returns the offer log of an asset from public state, ordered by sequence number
+func readOffers(ctx contractapi.TransactionContextInterface, assetID string) ([]*Offer, error) {
+	offersIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(typeOffer, []string{assetID})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read offers from world state: %v", err)
+	}
+	defer offersIterator.Close()
+
+	offers := []*Offer{}
+	for offersIterator.HasNext() {
+		resp, err := offersIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var offer Offer
+		err = json.Unmarshal(resp.Value, &offer)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, &offer)
+	}
+
+	// Keys are ordered as strings, so order the offers by number
+	sort.Slice(offers, func(i, j int) bool {
+		return offers[i].Seq < offers[j].Seq
+	})
+
+	// Counter-offers and acceptances are recorded by the org that makes them, so derive the status
+	// of the open offers that they answer
+	for _, offer := range offers {
+		if offer.CounterTo != 0 {
+			setOpenOfferStatus(offers, offer.CounterTo, offerStatusCountered)
+		}
+		if offer.Accepts != 0 {
+			setOpenOfferStatus(offers, offer.Accepts, offerStatusAccepted)
+		}
+	}
+
+	return offers, nil
+}
+
+func setOpenOfferStatus(offers []*Offer, seq int, status string) {
+	offer, err := findOffer(offers, seq)
+	if err == nil && offer.Status == offerStatusOpen {
+		offer.Status = status
+	}
+}
+
+// addOffer adds a new offer to the offer log, with a state-based endorsement policy that allows the
+// offering org or the owner org to update it. The offering org supersedes its own offers, and the
+// owner org closes all offers when the asset is transferred.
+func addOffer(ctx contractapi.TransactionContextInterface, offer *Offer, ownerOrgID string) error {
+	err := putOffer(ctx, offer)
+	if err != nil {
+		return err
+	}
+
+	offerKey, err := ctx.GetStub().CreateCompositeKey(typeOffer, []string{offer.AssetID, strconv.Itoa(offer.Seq)})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	endorsingOrgs := []string{offer.OfferOrg}
+	if ownerOrgID != offer.OfferOrg {
+		endorsingOrgs = append(endorsingOrgs, ownerOrgID)
+	}
+	policy, err := anyOrgEndorsementPolicy(endorsingOrgs)
+	if err != nil {
+		return fmt.Errorf("failed to create endorsement policy for offer: %v", err)
+	}
+	err = ctx.GetStub().SetStateValidationParameter(offerKey, policy)
+	if err != nil {
+		return fmt.Errorf("failed to set validation parameter on offer: %v", err)
+	}
+
+	return nil
+}
+
+// anyOrgEndorsementPolicy returns a signature policy that is satisfied by a peer of any of the orgs.
+// The statebased package only creates policies that require all of the orgs.
+func anyOrgEndorsementPolicy(orgs []string) ([]byte, error) {
+	var identities []*msp.MSPPrincipal
+	var rules []*common.SignaturePolicy
+	for i, org := range orgs {
+		role, err := proto.Marshal(&msp.MSPRole{Role: msp.MSPRole_PEER, MspIdentifier: org})
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, &msp.MSPPrincipal{
+			PrincipalClassification: msp.MSPPrincipal_ROLE,
+			Principal:               role,
+		})
+		rules = append(rules, &common.SignaturePolicy{
+			Type: &common.SignaturePolicy_SignedBy{SignedBy: int32(i)},
+		})
+	}
+
+	return proto.Marshal(&common.SignaturePolicyEnvelope{
+		Version: 0,
+		Rule: &common.SignaturePolicy{
+			Type: &common.SignaturePolicy_NOutOf_{
+				NOutOf: &common.SignaturePolicy_NOutOf{N: 1, Rules: rules},
+			},
+		},
+		Identities: identities,
+	})
+}
+
+func putOffer(ctx contractapi.TransactionContextInterface, offer *Offer) error {
+	offerKey, err := ctx.GetStub().CreateCompositeKey(typeOffer, []string{offer.AssetID, strconv.Itoa(offer.Seq)})
+	if err != nil {
+		return fmt.Errorf("failed to create composite key: %v", err)
+	}
+
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return fmt.Errorf("failed to marshal offer: %v", err)
+	}
+
+	err = ctx.GetStub().PutState(offerKey, offerJSON)
+	if err != nil {
+		return fmt.Errorf("failed to put offer in public data: %v", err)
+	}
+
+	return nil
+}
+
+// getTxTime returns the transaction timestamp
+func getTxTime(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	txTimestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get transaction timestamp: %v", err)
+	}
+
+	return txTimestamp.AsTime(), nil
+}
@@ -0,0 +1,356 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-samples/chaincode/tradingMarbles/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	sellPrice    = `{"asset_id":"asset1","trade_id":"trade1","price":200}`
+	counterPrice = `{"asset_id":"asset1","trade_id":"trade2","price":150}`
+)
+
+func TestMakeOfferAndCounter(t *testing.T) {
+	ledger := newFakeLedger(t)
+	assetTransfer := SmartContract{}
+
+	ledger.setClient(sellerMsp)
+	ledger.setPrice(sellPrice)
+	seq, err := assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, seq)
+	require.Equal(t, []byte(sellPrice), ledger.private[buildCollectionName(sellerMsp)][compositeKey(typeAssetForSale, testAssetID)])
+
+	ledger.setClient(buyerMsp)
+	ledger.setPrice(counterPrice)
+	seq, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, seq)
+	require.Equal(t, []byte(counterPrice), ledger.private[buildCollectionName(buyerMsp)][compositeKey(typeAssetBid, testAssetID)])
+
+	offers, err := assetTransfer.ListOffers(ledger.ctx, testAssetID)
+	require.NoError(t, err)
+	require.Len(t, offers, 2)
+	require.Equal(t, offerTypeSell, offers[0].Type)
+	require.Equal(t, offerStatusCountered, offers[0].Status)
+	require.Equal(t, offerTypeBuy, offers[1].Type)
+	require.Equal(t, offerStatusOpen, offers[1].Status)
+	require.Equal(t, 1, offers[1].CounterTo)
+	require.Equal(t, priceHash(counterPrice), offers[1].PriceHash)
+
+	// The counter-offer is recorded without updating the offer of the seller
+	require.Equal(t, offerStatusOpen, ledger.storedOffer(t, 1).Status)
+
+	// Only the orgs of the offer and of the asset owner can update the offers
+	require.Equal(t, []string{sellerMsp}, ledger.offerEndorsers(t, 1))
+	require.Equal(t, []string{buyerMsp, sellerMsp}, ledger.offerEndorsers(t, 2))
+
+	_, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 1)
+	require.EqualError(t, err, "offer 1 for asset asset1 is countered")
+
+	_, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 2)
+	require.EqualError(t, err, "a client from Org2Testmsp cannot counter its own offer 2")
+
+	_, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 5)
+	require.EqualError(t, err, "offer 5 does not exist")
+}
+
+func TestMakeOfferSupersedes(t *testing.T) {
+	ledger := newFakeLedger(t)
+	assetTransfer := SmartContract{}
+
+	ledger.setClient(buyerMsp)
+	ledger.setPrice(counterPrice)
+	_, err := assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 0)
+	require.NoError(t, err)
+
+	ledger.setPrice(sellPrice)
+	seq, err := assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, seq)
+
+	offers, err := assetTransfer.ListOffers(ledger.ctx, testAssetID)
+	require.NoError(t, err)
+	require.Equal(t, offerStatusSuperseded, offers[0].Status)
+	require.Equal(t, offerStatusOpen, offers[1].Status)
+
+	ledger.setClient(sellerMsp)
+	_, err = assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.EqualError(t, err, "offer 1 for asset asset1 is superseded")
+}
+
+func TestOfferExpiry(t *testing.T) {
+	ledger := newFakeLedger(t)
+	assetTransfer := SmartContract{}
+
+	ledger.setClient(sellerMsp)
+	ledger.setPrice(sellPrice)
+	_, err := assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-01T11:00:00Z", 0)
+	require.EqualError(t, err, "expiresAt 2024-01-01T11:00:00Z must be after the transaction time 2024-01-01T12:00:00Z")
+
+	_, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "tomorrow", 0)
+	require.ErrorContains(t, err, "expiresAt must be an RFC 3339 timestamp")
+
+	_, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-01T13:00:00Z", 0)
+	require.NoError(t, err)
+
+	ledger.setTime(txTime.Add(2 * time.Hour))
+	offers, err := assetTransfer.ListOffers(ledger.ctx, testAssetID)
+	require.NoError(t, err)
+	require.Equal(t, offerStatusExpired, offers[0].Status)
+
+	ledger.setClient(buyerMsp)
+	_, err = assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.EqualError(t, err, "offer 1 for asset asset1 expired at 2024-01-01T13:00:00Z")
+
+	_, err = assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 1)
+	require.EqualError(t, err, "offer 1 for asset asset1 expired at 2024-01-01T13:00:00Z")
+}
+
+func TestAcceptOffer(t *testing.T) {
+	ledger := newFakeLedger(t)
+	assetTransfer := SmartContract{}
+
+	ledger.setClient(sellerMsp)
+	ledger.setPrice(sellPrice)
+	_, err := assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 0)
+	require.NoError(t, err)
+
+	_, err = assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.EqualError(t, err, "a client from Org1Testmsp cannot accept its own offer 1")
+
+	ledger.setClient(buyerMsp)
+	ledger.setPrice(counterPrice)
+	_, err = assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.ErrorContains(t, err, "does not match the hash")
+
+	ledger.setPrice(sellPrice)
+	seq, err := assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, seq)
+	require.Equal(t, []byte(sellPrice), ledger.private[buildCollectionName(buyerMsp)][compositeKey(typeAssetBid, testAssetID)])
+	require.Equal(t, []byte("{}"), ledger.private[buildCollectionName(buyerMsp)][testAssetID])
+
+	offers, err := assetTransfer.ListOffers(ledger.ctx, testAssetID)
+	require.NoError(t, err)
+	require.Len(t, offers, 2)
+	require.Equal(t, offerStatusAccepted, offers[0].Status)
+	require.Equal(t, offerStatusAccepted, offers[1].Status)
+	require.Equal(t, 1, offers[1].Accepts)
+	require.Equal(t, buyerMsp, offers[1].OfferOrg)
+	require.Equal(t, offerTypeBuy, offers[1].Type)
+	require.Equal(t, []string{buyerMsp, sellerMsp}, ledger.offerEndorsers(t, 2))
+
+	_, err = assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.EqualError(t, err, "offer 1 for asset asset1 is accepted")
+
+	// The asset can then only be transferred for the accepted price, which closes the offers
+	ledger.setClient(sellerMsp)
+	err = closeOffers(ledger.ctx, testAssetID, []byte(counterPrice))
+	require.EqualError(t, err, "passed price does not match the price of an accepted offer for asset asset1")
+
+	err = closeOffers(ledger.ctx, testAssetID, []byte(sellPrice))
+	require.NoError(t, err)
+
+	offers, err = assetTransfer.ListOffers(ledger.ctx, testAssetID)
+	require.NoError(t, err)
+	require.Equal(t, offerStatusClosed, offers[0].Status)
+	require.Equal(t, offerStatusClosed, offers[1].Status)
+}
+
+func TestAcceptBuyOffer(t *testing.T) {
+	ledger := newFakeLedger(t)
+	assetTransfer := SmartContract{}
+
+	ledger.setClient(buyerMsp)
+	ledger.setPrice(counterPrice)
+	_, err := assetTransfer.MakeOffer(ledger.ctx, testAssetID, "2024-01-02T00:00:00Z", 0)
+	require.NoError(t, err)
+
+	ledger.setClient(sellerMsp)
+	seq, err := assetTransfer.AcceptOffer(ledger.ctx, testAssetID, 1)
+	require.NoError(t, err)
+	require.Equal(t, 2, seq)
+	require.Equal(t, []byte(counterPrice), ledger.private[buildCollectionName(sellerMsp)][compositeKey(typeAssetForSale, testAssetID)])
+
+	offers, err := assetTransfer.ListOffers(ledger.ctx, testAssetID)
+	require.NoError(t, err)
+	require.Equal(t, offerStatusAccepted, offers[0].Status)
+	require.Equal(t, offerTypeSell, offers[1].Type)
+	require.Equal(t, []string{sellerMsp}, ledger.offerEndorsers(t, 2))
+}
+
+// fakeLedger keeps the world state and private data written through the mocks, so that several
+// transactions can be run against the same ledger
+type fakeLedger struct {
+	ctx            *mocks.TransactionContext
+	stub           *mocks.ChaincodeStub
+	clientIdentity *mocks.ClientIdentity
+	state          map[string][]byte
+	private        map[string]map[string][]byte
+	transient      map[string][]byte
+	policies       map[string][]byte
+}
+
+// newFakeLedger returns a ledger with the test asset owned by the seller
+func newFakeLedger(t *testing.T) *fakeLedger {
+	ledger := &fakeLedger{
+		ctx:            &mocks.TransactionContext{},
+		stub:           &mocks.ChaincodeStub{},
+		clientIdentity: &mocks.ClientIdentity{},
+		state:          map[string][]byte{},
+		private:        map[string]map[string][]byte{},
+		transient:      map[string][]byte{"asset_properties": []byte("{}")},
+		policies:       map[string][]byte{},
+	}
+	ledger.ctx.GetStubReturns(ledger.stub)
+	ledger.ctx.GetClientIdentityReturns(ledger.clientIdentity)
+	ledger.stub.GetTxIDReturns("tx1")
+	ledger.setTime(txTime)
+
+	ledger.stub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return compositeKey(objectType, attributes...), nil
+	}
+	ledger.stub.GetStateStub = func(key string) ([]byte, error) {
+		return ledger.state[key], nil
+	}
+	ledger.stub.PutStateStub = func(key string, value []byte) error {
+		ledger.state[key] = value
+		return nil
+	}
+	ledger.stub.SetStateValidationParameterStub = func(key string, policy []byte) error {
+		ledger.policies[key] = policy
+		return nil
+	}
+	ledger.stub.GetStateByPartialCompositeKeyStub = func(objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		prefix := compositeKey(objectType, attributes...)
+		var keys []string
+		for key := range ledger.state {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var results []*queryresult.KV
+		for _, key := range keys {
+			results = append(results, &queryresult.KV{Key: key, Value: ledger.state[key]})
+		}
+		return receiptIterator(results), nil
+	}
+	ledger.stub.GetPrivateDataStub = func(collection string, key string) ([]byte, error) {
+		return ledger.private[collection][key], nil
+	}
+	ledger.stub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+		value, ok := ledger.private[collection][key]
+		if !ok {
+			return nil, nil
+		}
+		hash := sha256.Sum256(value)
+		return hash[:], nil
+	}
+	ledger.stub.PutPrivateDataStub = func(collection string, key string, value []byte) error {
+		if ledger.private[collection] == nil {
+			ledger.private[collection] = map[string][]byte{}
+		}
+		ledger.private[collection][key] = value
+		return nil
+	}
+	ledger.stub.DelPrivateDataStub = func(collection string, key string) error {
+		delete(ledger.private[collection], key)
+		return nil
+	}
+	ledger.stub.GetTransientStub = func() (map[string][]byte, error) {
+		return ledger.transient, nil
+	}
+
+	ledger.putAsset(t, testAssetID, sellerMsp)
+
+	return ledger
+}
+
+// setClient makes the following calls from a client of an org, endorsed by a peer of the same org
+func (ledger *fakeLedger) setClient(orgID string) {
+	ledger.clientIdentity.GetMSPIDReturns(orgID, nil)
+	// set matching msp ID using peer shim env variable
+	os.Setenv("CORE_PEER_LOCALMSPID", orgID)
+}
+
+func (ledger *fakeLedger) setTime(now time.Time) {
+	ledger.stub.GetTxTimestampReturns(timestamppb.New(now), nil)
+}
+
+func (ledger *fakeLedger) setPrice(priceJSON string) {
+	ledger.transient["asset_price"] = []byte(priceJSON)
+}
+
+func (ledger *fakeLedger) putAsset(t *testing.T, assetID string, ownerOrgID string) {
+	assetJSON, err := json.Marshal(&Asset{ObjectType: "asset", ID: assetID, OwnerOrg: ownerOrgID, PublicDescription: "a test asset"})
+	require.NoError(t, err)
+	ledger.state[assetID] = assetJSON
+}
+
+// storedOffer returns an offer as stored in world state, without the derived status
+func (ledger *fakeLedger) storedOffer(t *testing.T, seq int) *Offer {
+	offerJSON, ok := ledger.state[compositeKey(typeOffer, testAssetID, strconv.Itoa(seq))]
+	require.True(t, ok, "offer %d not found", seq)
+
+	var offer Offer
+	require.NoError(t, json.Unmarshal(offerJSON, &offer))
+	return &offer
+}
+
+// offerEndorsers returns the orgs of the state-based endorsement policy of an offer, any one of
+// which can endorse an update of the offer
+func (ledger *fakeLedger) offerEndorsers(t *testing.T, seq int) []string {
+	policyBytes, ok := ledger.policies[compositeKey(typeOffer, testAssetID, strconv.Itoa(seq))]
+	require.True(t, ok, "endorsement policy of offer %d not found", seq)
+
+	var policy common.SignaturePolicyEnvelope
+	require.NoError(t, proto.Unmarshal(policyBytes, &policy))
+	require.Equal(t, int32(1), policy.GetRule().GetNOutOf().GetN())
+	require.Len(t, policy.GetRule().GetNOutOf().GetRules(), len(policy.GetIdentities()))
+
+	var orgs []string
+	for _, identity := range policy.GetIdentities() {
+		var role msp.MSPRole
+		require.NoError(t, proto.Unmarshal(identity.GetPrincipal(), &role))
+		require.Equal(t, msp.MSPRole_PEER, role.GetRole())
+		orgs = append(orgs, role.GetMspIdentifier())
+	}
+	return orgs
+}
+
+// compositeKey creates a composite key in the same way as the shim
+func compositeKey(objectType string, attributes ...string) string {
+	key := "\x00" + objectType + "\x00"
+	for _, attribute := range attributes {
+		key += attribute + "\x00"
+	}
+	return key
+}
+
+func priceHash(priceJSON string) string {
+	hash := sha256.Sum256([]byte(priceJSON))
+	return hex.EncodeToString(hash[:])
+}
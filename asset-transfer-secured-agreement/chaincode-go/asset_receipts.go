@@ -0,0 +1,299 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// maxReceiptPageSize is the largest page size of GetSaleReceipts and GetBuyReceipts
+const maxReceiptPageSize = 100
+
+// Receipt types in exported statements
+const (
+	receiptTypeSale = "sale"
+	receiptTypeBuy  = "buy"
+)
+
+// ReceiptPage is a page of receipts, ordered by timestamp. Bookmark is passed to get the next page,
+// and is empty if there are no more receipts.
+type ReceiptPage struct {
+	Receipts []*Receipt `json:"receipts"`
+	Bookmark string     `json:"bookmark"`
+}
+
+// ReceiptStatement is a statement of the receipts in the implicit private data collection of an org,
+// returned by ExportReceipts. Each entry contains the receipt bytes as stored, so that an auditor can
+// check that their hash matches the on-chain private data hash returned by GetReceiptHash for the
+// entry key. TxID is the ID of the ExportReceipts proposal that produced the statement.
+type ReceiptStatement struct {
+	OrgID      string                  `json:"orgID"`
+	Collection string                  `json:"collection"`
+	FromTime   string                  `json:"fromTime"`
+	ToTime     string                  `json:"toTime"`
+	TxID       string                  `json:"txID"`
+	Timestamp  time.Time               `json:"timestamp"`
+	Entries    []ReceiptStatementEntry `json:"entries"`
+}
+
+// ReceiptStatementEntry is a receipt in a receipt statement. Key is the base64 encoded private data
+// key of the receipt, Value the base64 encoded receipt bytes and Hash their hex encoded SHA-256 hash.
+type ReceiptStatementEntry struct {
+	Type    string  `json:"type"`
+	Key     string  `json:"key"`
+	Value   string  `json:"value"`
+	Hash    string  `json:"hash"`
+	Receipt Receipt `json:"receipt"`
+}
+
+// receiptRecord is a receipt read from an implicit private data collection
+type receiptRecord struct {
+	key     string
+	value   []byte
+	receipt *Receipt
+}
+
+// GetSaleReceipts returns a page of the receipts for assets sold by the client's org, with a
+// timestamp from fromTime, inclusive, to toTime, exclusive. Times are RFC 3339 timestamps, and an
+// empty time does not limit the range. Pass an empty bookmark for the first page.
+func (s *SmartContract) GetSaleReceipts(ctx contractapi.TransactionContextInterface, fromTime string, toTime string, pageSize int, bookmark string) (*ReceiptPage, error) {
+	return getReceiptPage(ctx, typeAssetSaleReceipt, fromTime, toTime, pageSize, bookmark)
+}
+
+// GetBuyReceipts returns a page of the receipts for assets bought by the client's org, in the same
+// way as GetSaleReceipts.
+func (s *SmartContract) GetBuyReceipts(ctx contractapi.TransactionContextInterface, fromTime string, toTime string, pageSize int, bookmark string) (*ReceiptPage, error) {
+	return getReceiptPage(ctx, typeAssetBuyReceipt, fromTime, toTime, pageSize, bookmark)
+}
+
+// ExportReceipts returns a statement of the sale and purchase receipts of the client's org with a
+// timestamp in the given range, as for GetSaleReceipts. The statement is only returned by a peer of
+// the client's org, which signs it as part of its proposal response. To give an auditor a statement
+// that they can verify, the client endorses an ExportReceipts proposal with a peer of its own org,
+// without submitting the transaction, and passes on the endorsed transaction. The auditor checks the
+// endorsement signature and that the endorsing peer belongs to the org of the statement, and then
+// compares each entry hash with the hash returned by GetReceiptHash.
+func (s *SmartContract) ExportReceipts(ctx contractapi.TransactionContextInterface, fromTime string, toTime string) (*ReceiptStatement, error) {
+	clientOrgID, err := getClientOrgID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify that this client belongs to the peer's org
+	err = verifyClientOrgMatchesPeerOrg(clientOrgID)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := parseTimeRange(fromTime, toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := getTxTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	collection := buildCollectionName(clientOrgID)
+	statement := ReceiptStatement{
+		OrgID:      clientOrgID,
+		Collection: collection,
+		FromTime:   fromTime,
+		ToTime:     toTime,
+		TxID:       ctx.GetStub().GetTxID(),
+		Timestamp:  timestamp.UTC(),
+		Entries:    []ReceiptStatementEntry{},
+	}
+
+	for _, receiptType := range []string{typeAssetSaleReceipt, typeAssetBuyReceipt} {
+		records, err := readReceipts(ctx, collection, receiptType, from, to)
+		if err != nil {
+			return nil, err
+		}
+
+		entryType := receiptTypeSale
+		if receiptType == typeAssetBuyReceipt {
+			entryType = receiptTypeBuy
+		}
+		for _, record := range records {
+			hash := sha256.Sum256(record.value)
+			statement.Entries = append(statement.Entries, ReceiptStatementEntry{
+				Type:    entryType,
+				Key:     base64.StdEncoding.EncodeToString([]byte(record.key)),
+				Value:   base64.StdEncoding.EncodeToString(record.value),
+				Hash:    hex.EncodeToString(hash[:]),
+				Receipt: *record.receipt,
+			})
+		}
+	}
+
+	return &statement, nil
+}
+
+// GetReceiptHash returns the hex encoded on-chain hash of a receipt in the implicit private data
+// collection of an org, given the base64 encoded key of a receipt statement entry, so that any org
+// can verify an exported receipt statement entry.
+func (s *SmartContract) GetReceiptHash(ctx contractapi.TransactionContextInterface, orgID string, receiptKey string) (string, error) {
+	key, err := base64.StdEncoding.DecodeString(receiptKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid receipt key: %v", err)
+	}
+
+	hash, err := ctx.GetStub().GetPrivateDataHash(buildCollectionName(orgID), string(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to read receipt hash: %v", err)
+	}
+	if hash == nil {
+		return "", fmt.Errorf("receipt hash does not exist for %s in the collection of %s", receiptKey, orgID)
+	}
+
+	return hex.EncodeToString(hash), nil
+}
+
+// getReceiptPage returns a page of the receipts of a type from the client's implicit private data
+// collection. Private data queries cannot be paginated, so the bookmark is the base64 encoded key of
+// the last receipt of the previous page.
+func getReceiptPage(ctx contractapi.TransactionContextInterface, receiptType string, fromTime string, toTime string, pageSize int, bookmark string) (*ReceiptPage, error) {
+	if pageSize <= 0 || pageSize > maxReceiptPageSize {
+		return nil, fmt.Errorf("pageSize must be between 1 and %d", maxReceiptPageSize)
+	}
+
+	collection, err := getClientImplicitCollectionNameAndVerifyClientOrg(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to, err := parseTimeRange(fromTime, toTime)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := readReceipts(ctx, collection, receiptType, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	start := 0
+	if bookmark != "" {
+		bookmarkKey, err := base64.StdEncoding.DecodeString(bookmark)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bookmark: %v", err)
+		}
+		start = -1
+		for i, record := range records {
+			if record.key == string(bookmarkKey) {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return nil, fmt.Errorf("invalid bookmark, receipt not found in the time range")
+		}
+	}
+
+	page := &ReceiptPage{Receipts: []*Receipt{}}
+	end := start + pageSize
+	if end > len(records) {
+		end = len(records)
+	}
+	for _, record := range records[start:end] {
+		page.Receipts = append(page.Receipts, record.receipt)
+	}
+	if end < len(records) {
+		page.Bookmark = base64.StdEncoding.EncodeToString([]byte(records[end-1].key))
+	}
+
+	return page, nil
+}
+
+// readReceipts returns the receipts of a type in a collection with a timestamp in the time range,
+// ordered by timestamp and key. A zero time does not limit the range.
+func readReceipts(ctx contractapi.TransactionContextInterface, collection string, receiptType string, from time.Time, to time.Time) ([]receiptRecord, error) {
+	receiptsIterator, err := ctx.GetStub().GetPrivateDataByPartialCompositeKey(collection, receiptType, []string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read from private data collection: %v", err)
+	}
+	defer receiptsIterator.Close()
+
+	var records []receiptRecord
+	for receiptsIterator.HasNext() {
+		resp, err := receiptsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var receipt Receipt
+		err = json.Unmarshal(resp.Value, &receipt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Receipts written by earlier versions of the chaincode only identify the asset and
+		// transaction in their key
+		if receipt.AssetID == "" || receipt.TxID == "" {
+			_, attributes, err := ctx.GetStub().SplitCompositeKey(resp.Key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to split composite key: %v", err)
+			}
+			if len(attributes) == 2 {
+				if receiptType == typeAssetSaleReceipt {
+					receipt.TxID, receipt.AssetID = attributes[0], attributes[1]
+				} else {
+					receipt.AssetID, receipt.TxID = attributes[0], attributes[1]
+				}
+			}
+		}
+
+		if !from.IsZero() && receipt.Timestamp.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !receipt.Timestamp.Before(to) {
+			continue
+		}
+
+		records = append(records, receiptRecord{key: resp.Key, value: resp.Value, receipt: &receipt})
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if !records[i].receipt.Timestamp.Equal(records[j].receipt.Timestamp) {
+			return records[i].receipt.Timestamp.Before(records[j].receipt.Timestamp)
+		}
+		return records[i].key < records[j].key
+	})
+
+	return records, nil
+}
+
+// parseTimeRange parses optional RFC 3339 timestamps, returning a zero time for an empty timestamp
+func parseTimeRange(fromTime string, toTime string) (time.Time, time.Time, error) {
+	var from, to time.Time
+	var err error
+	if fromTime != "" {
+		from, err = time.Parse(time.RFC3339, fromTime)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("fromTime must be an RFC 3339 timestamp: %v", err)
+		}
+	}
+	if toTime != "" {
+		to, err = time.Parse(time.RFC3339, toTime)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("toTime must be an RFC 3339 timestamp: %v", err)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("fromTime %s must be before toTime %s", fromTime, toTime)
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,176 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-samples/chaincode/tradingMarbles/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestGetSaleReceipts(t *testing.T) {
+	transactionContext, chaincodeStub := prepReceiptMocks(t)
+	assetTransfer := SmartContract{}
+
+	page, err := assetTransfer.GetSaleReceipts(transactionContext, "", "", 2, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset1", "asset2"}, receiptAssetIDs(page))
+	require.NotEmpty(t, page.Bookmark)
+
+	page, err = assetTransfer.GetSaleReceipts(transactionContext, "", "", 2, page.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset3"}, receiptAssetIDs(page))
+	require.Empty(t, page.Bookmark)
+
+	collection, objectType, _ := chaincodeStub.GetPrivateDataByPartialCompositeKeyArgsForCall(0)
+	require.Equal(t, buildCollectionName(sellerMsp), collection)
+	require.Equal(t, typeAssetSaleReceipt, objectType)
+
+	page, err = assetTransfer.GetSaleReceipts(transactionContext, "2024-01-02T00:00:00Z", "2024-01-03T00:00:00Z", 10, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"asset2"}, receiptAssetIDs(page))
+	require.Equal(t, 200, page.Receipts[0].Price)
+	require.Empty(t, page.Bookmark)
+
+	_, err = assetTransfer.GetSaleReceipts(transactionContext, "", "", 0, "")
+	require.EqualError(t, err, "pageSize must be between 1 and 100")
+
+	_, err = assetTransfer.GetSaleReceipts(transactionContext, "2024-01-03T00:00:00Z", "2024-01-02T00:00:00Z", 10, "")
+	require.EqualError(t, err, "fromTime 2024-01-03T00:00:00Z must be before toTime 2024-01-02T00:00:00Z")
+
+	_, err = assetTransfer.GetSaleReceipts(transactionContext, "", "", 10, base64.StdEncoding.EncodeToString([]byte("unknown")))
+	require.EqualError(t, err, "invalid bookmark, receipt not found in the time range")
+}
+
+func TestGetSaleReceiptsWithoutReceiptFields(t *testing.T) {
+	transactionContext, chaincodeStub := prepReceiptMocks(t)
+	chaincodeStub.GetPrivateDataByPartialCompositeKeyStub = func(collection string, objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		return receiptIterator([]*queryresult.KV{{Key: receiptKey(typeAssetSaleReceipt, "tx9", "asset9"), Value: []byte("{}")}}), nil
+	}
+
+	assetTransfer := SmartContract{}
+	page, err := assetTransfer.GetSaleReceipts(transactionContext, "", "", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Receipts, 1)
+	require.Equal(t, "asset9", page.Receipts[0].AssetID)
+	require.Equal(t, "tx9", page.Receipts[0].TxID)
+}
+
+func TestExportReceipts(t *testing.T) {
+	transactionContext, chaincodeStub := prepReceiptMocks(t)
+
+	assetTransfer := SmartContract{}
+	chaincodeStub.GetTxIDReturns("txexport")
+	statement, err := assetTransfer.ExportReceipts(transactionContext, "2024-01-02T00:00:00Z", "")
+	require.NoError(t, err)
+
+	require.Equal(t, sellerMsp, statement.OrgID)
+	require.Equal(t, "txexport", statement.TxID)
+	require.Len(t, statement.Entries, 2)
+	for _, entry := range statement.Entries {
+		require.Equal(t, receiptTypeSale, entry.Type)
+		value, err := base64.StdEncoding.DecodeString(entry.Value)
+		require.NoError(t, err)
+		hash := sha256.Sum256(value)
+		require.Equal(t, hex.EncodeToString(hash[:]), entry.Hash)
+	}
+	require.Equal(t, "asset2", statement.Entries[0].Receipt.AssetID)
+	require.Equal(t, "asset3", statement.Entries[1].Receipt.AssetID)
+
+	// Entry hashes can be verified against the on-chain hashes
+	chaincodeStub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+		if collection == buildCollectionName(sellerMsp) && key == receiptKey(typeAssetSaleReceipt, "tx2", "asset2") {
+			hash, _ := hex.DecodeString(statement.Entries[0].Hash)
+			return hash, nil
+		}
+		return nil, nil
+	}
+	onChainHash, err := assetTransfer.GetReceiptHash(transactionContext, sellerMsp, statement.Entries[0].Key)
+	require.NoError(t, err)
+	require.Equal(t, statement.Entries[0].Hash, onChainHash)
+}
+
+// prepReceiptMocks prepares the mocks for a seller client with three sale receipts
+func prepReceiptMocks(t *testing.T) (*mocks.TransactionContext, *mocks.ChaincodeStub) {
+	chaincodeStub := &mocks.ChaincodeStub{}
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+
+	clientIdentity := &mocks.ClientIdentity{}
+	clientIdentity.GetMSPIDReturns(sellerMsp, nil)
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime), nil)
+	// set matching msp ID using peer shim env variable
+	os.Setenv("CORE_PEER_LOCALMSPID", sellerMsp)
+
+	chaincodeStub.SplitCompositeKeyStub = func(key string) (string, []string, error) {
+		parts := strings.Split(key, "\x00")
+		return parts[1], parts[2 : len(parts)-1], nil
+	}
+
+	// Receipts are not returned in the order of their timestamps
+	receipts := []*queryresult.KV{
+		{Key: receiptKey(typeAssetSaleReceipt, "tx3", "asset3"), Value: receiptJSON(t, "asset3", "tx3", 300, "2024-01-03T10:00:00Z")},
+		{Key: receiptKey(typeAssetSaleReceipt, "tx1", "asset1"), Value: receiptJSON(t, "asset1", "tx1", 100, "2024-01-01T10:00:00Z")},
+		{Key: receiptKey(typeAssetSaleReceipt, "tx2", "asset2"), Value: receiptJSON(t, "asset2", "tx2", 200, "2024-01-02T10:00:00Z")},
+	}
+	chaincodeStub.GetPrivateDataByPartialCompositeKeyStub = func(collection string, objectType string, attributes []string) (shim.StateQueryIteratorInterface, error) {
+		if objectType != typeAssetSaleReceipt {
+			return receiptIterator(nil), nil
+		}
+		return receiptIterator(receipts), nil
+	}
+
+	return transactionContext, chaincodeStub
+}
+
+func receiptKey(objectType string, attributes ...string) string {
+	return "\x00" + objectType + "\x00" + strings.Join(attributes, "\x00") + "\x00"
+}
+
+func receiptJSON(t *testing.T, assetID string, txID string, price int, timestamp string) []byte {
+	receiptTime, err := time.Parse(time.RFC3339, timestamp)
+	require.NoError(t, err)
+	value, err := json.Marshal(&Receipt{
+		AssetID:   assetID,
+		TxID:      txID,
+		Price:     price,
+		SellerOrg: sellerMsp,
+		BuyerOrg:  buyerMsp,
+		Timestamp: receiptTime,
+	})
+	require.NoError(t, err)
+	return value
+}
+
+// receiptIterator returns an iterator over the passed results
+func receiptIterator(results []*queryresult.KV) *mocks.StateQueryIterator {
+	iterator := &mocks.StateQueryIterator{}
+	for i, result := range results {
+		iterator.HasNextReturnsOnCall(i, true)
+		iterator.NextReturnsOnCall(i, result, nil)
+	}
+	iterator.HasNextReturnsOnCall(len(results), false)
+	return iterator
+}
+
+func receiptAssetIDs(page *ReceiptPage) []string {
+	var assetIDs []string
+	for _, receipt := range page.Receipts {
+		assetIDs = append(assetIDs, receipt.AssetID)
+	}
+	return assetIDs
+}
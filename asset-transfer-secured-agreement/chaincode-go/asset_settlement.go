@@ -0,0 +1,73 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Settlement describes how the price of an agreement is paid when the asset is transferred. The
+// price is transferred from the buyer account to the seller account by calling TransferFrom on a
+// token-erc-20 chaincode on the same channel, using the allowance that the buyer account approved
+// for the client that submits the transfer. Accounts are client account IDs of the token chaincode.
+type Settlement struct {
+	TokenChaincode string `json:"token_chaincode"`
+	BuyerAccount   string `json:"buyer_account"`
+	SellerAccount  string `json:"seller_account"`
+}
+
+// validate checks that the settlement can be used to pay a price
+func (settlement *Settlement) validate(price int) error {
+	if settlement.TokenChaincode == "" {
+		return fmt.Errorf("settlement token chaincode must not be empty")
+	}
+	if settlement.BuyerAccount == "" || settlement.SellerAccount == "" {
+		return fmt.Errorf("settlement buyer and seller accounts must not be empty")
+	}
+	if price <= 0 {
+		return fmt.Errorf("settlement price must be positive, got %d", price)
+	}
+
+	return nil
+}
+
+// settlePayment pays the price of an agreement through the token chaincode of its settlement. The
+// token chaincode is called in the same transaction, so the payment and the ownership change are
+// either both committed or both rejected.
+func settlePayment(ctx contractapi.TransactionContextInterface, settlement *Settlement, price int) error {
+	err := settlement.validate(price)
+	if err != nil {
+		return err
+	}
+
+	args := [][]byte{
+		[]byte("TransferFrom"),
+		[]byte(settlement.BuyerAccount),
+		[]byte(settlement.SellerAccount),
+		[]byte(strconv.Itoa(price)),
+	}
+
+	// An empty channel name calls the chaincode on the same channel, which is required for the
+	// token chaincode to update its state in this transaction
+	response := ctx.GetStub().InvokeChaincode(settlement.TokenChaincode, args, "")
+	if response == nil {
+		return fmt.Errorf("no response from token chaincode %s", settlement.TokenChaincode)
+	}
+	if response.Status != shim.OK {
+		return fmt.Errorf("payment of %d from %s to %s through token chaincode %s failed: %s",
+			price,
+			settlement.BuyerAccount,
+			settlement.SellerAccount,
+			settlement.TokenChaincode,
+			response.Message,
+		)
+	}
+
+	return nil
+}
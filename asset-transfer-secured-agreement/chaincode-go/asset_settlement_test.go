@@ -0,0 +1,270 @@
+/*
+ SPDX-License-Identifier: Apache-2.0
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/hyperledger/fabric-samples/chaincode/tradingMarbles/mocks"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+/*
+These unit tests use mocks to simulate chaincode-api & fabric interactions, and a stubbed token
+chaincode to simulate the token-erc-20 chaincode called for payment settlement.
+The mocks are generated using counterfeiter directives in the comments (starting with "go:generate counterfeiter")
+All files in mocks/* are generated by running following, in the directory with your directive:
+	`go generate`
+*/
+
+//go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
+type transactionContext interface {
+	contractapi.TransactionContextInterface
+}
+
+//go:generate counterfeiter -o mocks/chaincodestub.go -fake-name ChaincodeStub . chaincodeStub
+type chaincodeStub interface {
+	shim.ChaincodeStubInterface
+}
+
+//go:generate counterfeiter -o mocks/statequeryiterator.go -fake-name StateQueryIterator . stateQueryIterator
+type stateQueryIterator interface {
+	shim.StateQueryIteratorInterface
+}
+
+//go:generate counterfeiter -o mocks/clientIdentity.go -fake-name ClientIdentity . clientIdentity
+type clientIdentity interface {
+	cid.ClientIdentity
+}
+
+const (
+	sellerMsp      = "Org1Testmsp"
+	sellerClientID = "sellerUserid"
+	buyerMsp       = "Org2Testmsp"
+	testAssetID    = "asset1"
+	tokenChaincode = "token_erc20"
+	buyerAccount   = "buyerAccount"
+	sellerAccount  = "sellerAccount"
+)
+
+var txTime = time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+// tokenChaincodeStub simulates the TransferFrom function of the token-erc-20 chaincode
+type tokenChaincodeStub struct {
+	balances   map[string]int
+	allowances map[string]int // allowance of the spender for each owner account
+	spender    string
+}
+
+func (token *tokenChaincodeStub) invoke(name string, args [][]byte, channel string) *peer.Response {
+	if name != tokenChaincode {
+		return &peer.Response{Status: shim.ERROR, Message: fmt.Sprintf("chaincode %s not found", name)}
+	}
+	if len(args) != 4 || string(args[0]) != "TransferFrom" {
+		return &peer.Response{Status: shim.ERROR, Message: "unexpected function call"}
+	}
+
+	from, to := string(args[1]), string(args[2])
+	value, err := strconv.Atoi(string(args[3]))
+	if err != nil {
+		return &peer.Response{Status: shim.ERROR, Message: err.Error()}
+	}
+	if token.allowances[from] < value {
+		return &peer.Response{Status: shim.ERROR, Message: "spender does not have enough allowance for transfer"}
+	}
+	if token.balances[from] < value {
+		return &peer.Response{Status: shim.ERROR, Message: fmt.Sprintf("client account %s has insufficient funds", from)}
+	}
+
+	token.allowances[from] -= value
+	token.balances[from] -= value
+	token.balances[to] += value
+	return &peer.Response{Status: shim.OK}
+}
+
+func TestTransferAssetWithSettlement(t *testing.T) {
+	transactionContext, chaincodeStub := prepTransferMocks(t, &Agreement{
+		ID:      testAssetID,
+		Price:   150,
+		TradeID: "trade1",
+		Settlement: &Settlement{
+			TokenChaincode: tokenChaincode,
+			BuyerAccount:   buyerAccount,
+			SellerAccount:  sellerAccount,
+		},
+	})
+	token := &tokenChaincodeStub{
+		balances:   map[string]int{buyerAccount: 500},
+		allowances: map[string]int{buyerAccount: 200},
+	}
+	chaincodeStub.InvokeChaincodeStub = token.invoke
+
+	assetTransfer := SmartContract{}
+	err := assetTransfer.TransferAsset(transactionContext, testAssetID, buyerMsp)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, chaincodeStub.InvokeChaincodeCallCount())
+	name, args, channel := chaincodeStub.InvokeChaincodeArgsForCall(0)
+	require.Equal(t, tokenChaincode, name)
+	require.Equal(t, "", channel)
+	require.Equal(t, [][]byte{[]byte("TransferFrom"), []byte(buyerAccount), []byte(sellerAccount), []byte("150")}, args)
+	require.Equal(t, 350, token.balances[buyerAccount])
+	require.Equal(t, 150, token.balances[sellerAccount])
+	require.Equal(t, 50, token.allowances[buyerAccount])
+
+	require.Equal(t, buyerMsp, assetOwnerWritten(t, chaincodeStub))
+}
+
+func TestTransferAssetSettlementFails(t *testing.T) {
+	transactionContext, chaincodeStub := prepTransferMocks(t, &Agreement{
+		ID:      testAssetID,
+		Price:   150,
+		TradeID: "trade1",
+		Settlement: &Settlement{
+			TokenChaincode: tokenChaincode,
+			BuyerAccount:   buyerAccount,
+			SellerAccount:  sellerAccount,
+		},
+	})
+	assetTransfer := SmartContract{}
+
+	// Allowance lower than the price
+	token := &tokenChaincodeStub{
+		balances:   map[string]int{buyerAccount: 500},
+		allowances: map[string]int{buyerAccount: 100},
+	}
+	chaincodeStub.InvokeChaincodeStub = token.invoke
+	err := assetTransfer.TransferAsset(transactionContext, testAssetID, buyerMsp)
+	require.ErrorContains(t, err, "failed payment settlement")
+	require.ErrorContains(t, err, "spender does not have enough allowance for transfer")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+	require.Equal(t, 500, token.balances[buyerAccount])
+
+	// Balance lower than the price
+	token = &tokenChaincodeStub{
+		balances:   map[string]int{buyerAccount: 100},
+		allowances: map[string]int{buyerAccount: 200},
+	}
+	chaincodeStub.InvokeChaincodeStub = token.invoke
+	err = assetTransfer.TransferAsset(transactionContext, testAssetID, buyerMsp)
+	require.ErrorContains(t, err, "insufficient funds")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+
+	// Token chaincode not found
+	chaincodeStub.InvokeChaincodeReturns(&peer.Response{Status: shim.ERROR, Message: "chaincode token_erc20 not found"})
+	chaincodeStub.InvokeChaincodeStub = nil
+	err = assetTransfer.TransferAsset(transactionContext, testAssetID, buyerMsp)
+	require.ErrorContains(t, err, "not found")
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestTransferAssetInvalidSettlement(t *testing.T) {
+	transactionContext, chaincodeStub := prepTransferMocks(t, &Agreement{
+		ID:      testAssetID,
+		Price:   150,
+		TradeID: "trade1",
+		Settlement: &Settlement{
+			TokenChaincode: tokenChaincode,
+			SellerAccount:  sellerAccount,
+		},
+	})
+
+	assetTransfer := SmartContract{}
+	err := assetTransfer.TransferAsset(transactionContext, testAssetID, buyerMsp)
+	require.EqualError(t, err, "failed payment settlement: settlement buyer and seller accounts must not be empty")
+	require.Equal(t, 0, chaincodeStub.InvokeChaincodeCallCount())
+	require.Equal(t, 0, chaincodeStub.PutStateCallCount())
+}
+
+func TestTransferAssetWithoutSettlement(t *testing.T) {
+	transactionContext, chaincodeStub := prepTransferMocks(t, &Agreement{
+		ID:      testAssetID,
+		Price:   150,
+		TradeID: "trade1",
+	})
+
+	assetTransfer := SmartContract{}
+	err := assetTransfer.TransferAsset(transactionContext, testAssetID, buyerMsp)
+	require.NoError(t, err)
+	require.Equal(t, 0, chaincodeStub.InvokeChaincodeCallCount())
+	require.Equal(t, buyerMsp, assetOwnerWritten(t, chaincodeStub))
+}
+
+// prepTransferMocks prepares the mocks for the seller to transfer the test asset to the buyer, with
+// both orgs having agreed to the passed agreement and asset properties
+func prepTransferMocks(t *testing.T, agreement *Agreement) (*mocks.TransactionContext, *mocks.ChaincodeStub) {
+	chaincodeStub := &mocks.ChaincodeStub{}
+	transactionContext := &mocks.TransactionContext{}
+	transactionContext.GetStubReturns(chaincodeStub)
+
+	clientIdentity := &mocks.ClientIdentity{}
+	clientIdentity.GetMSPIDReturns(sellerMsp, nil)
+	clientIdentity.GetIDReturns(base64.StdEncoding.EncodeToString([]byte(sellerClientID)), nil)
+	transactionContext.GetClientIdentityReturns(clientIdentity)
+	chaincodeStub.GetTxTimestampReturns(timestamppb.New(txTime), nil)
+	chaincodeStub.GetTxIDReturns("tx1")
+	// set matching msp ID using peer shim env variable
+	os.Setenv("CORE_PEER_LOCALMSPID", sellerMsp)
+
+	priceJSON, err := json.Marshal(agreement)
+	require.NoError(t, err)
+	chaincodeStub.GetTransientReturns(map[string][]byte{"asset_price": priceJSON}, nil)
+
+	assetJSON, err := json.Marshal(&Asset{ObjectType: "asset", ID: testAssetID, OwnerOrg: sellerMsp, PublicDescription: "a test asset"})
+	require.NoError(t, err)
+	chaincodeStub.GetStateStub = func(key string) ([]byte, error) {
+		if key == testAssetID {
+			return assetJSON, nil
+		}
+		return nil, nil
+	}
+
+	chaincodeStub.CreateCompositeKeyStub = func(objectType string, attributes []string) (string, error) {
+		return objectType + strings.Join(attributes, ""), nil
+	}
+	chaincodeStub.GetStateByPartialCompositeKeyReturns(&mocks.StateQueryIterator{}, nil)
+
+	propertiesHash := sha256.Sum256([]byte(`{"object_type":"asset_properties","asset_id":"asset1"}`))
+	priceHash := sha256.Sum256(priceJSON)
+	privateDataHashes := map[string][]byte{
+		buildCollectionName(sellerMsp) + testAssetID:                    propertiesHash[:],
+		buildCollectionName(buyerMsp) + testAssetID:                     propertiesHash[:],
+		buildCollectionName(sellerMsp) + typeAssetForSale + testAssetID: priceHash[:],
+		buildCollectionName(buyerMsp) + typeAssetBid + testAssetID:      priceHash[:],
+	}
+	chaincodeStub.GetPrivateDataHashStub = func(collection string, key string) ([]byte, error) {
+		return privateDataHashes[collection+key], nil
+	}
+
+	return transactionContext, chaincodeStub
+}
+
+// assetOwnerWritten returns the owner of the test asset written to public state
+func assetOwnerWritten(t *testing.T, chaincodeStub *mocks.ChaincodeStub) string {
+	for i := 0; i < chaincodeStub.PutStateCallCount(); i++ {
+		key, value := chaincodeStub.PutStateArgsForCall(i)
+		if key == testAssetID {
+			var asset Asset
+			require.NoError(t, json.Unmarshal(value, &asset))
+			return asset.OwnerOrg
+		}
+	}
+
+	require.Fail(t, "asset was not written to public state")
+	return ""
+}
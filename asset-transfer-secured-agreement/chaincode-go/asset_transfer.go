@@ -37,9 +37,18 @@ type Asset struct {
 	PublicDescription string `json:"publicDescription"`
 }
 
-type receipt struct {
-	price     int
-	timestamp time.Time
+// Receipt records the sale or purchase of an asset in the implicit private data collections of the
+// seller and buyer orgs. Assets transferred in a bundle have no price of their own, so their receipts
+// record the trade ID and price of the bundle instead.
+type Receipt struct {
+	AssetID     string    `json:"assetID"`
+	TxID        string    `json:"txID"`
+	Price       int       `json:"price"`
+	SellerOrg   string    `json:"sellerOrg"`
+	BuyerOrg    string    `json:"buyerOrg"`
+	Timestamp   time.Time `json:"timestamp"`
+	TradeID     string    `json:"tradeID,omitempty" metadata:",optional"`
+	BundlePrice int       `json:"bundlePrice,omitempty" metadata:",optional"`
 }
 
 // CreateAsset creates an asset, sets it as owned by the client's org and returns its id
@@ -287,6 +296,9 @@ func (s *SmartContract) VerifyAssetProperties(ctx contractapi.TransactionContext
 }
 
 // TransferAsset checks transfer conditions and then transfers asset state to buyer.
+// If offers for the asset have been accepted, the price must be the price of an accepted offer.
+// If the agreed price includes a settlement, the price is paid to the seller in the same transaction,
+// and the asset is not transferred if the payment fails.
 // TransferAsset can only be called by current owner
 func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterface, assetID string, buyerOrgID string) error {
 	clientOrgID, err := getClientOrgID(ctx)
@@ -320,6 +332,18 @@ func (s *SmartContract) TransferAsset(ctx contractapi.TransactionContextInterfac
 		return fmt.Errorf("failed transfer verification: %v", err)
 	}
 
+	err = closeOffers(ctx, assetID, priceJSON)
+	if err != nil {
+		return fmt.Errorf("failed transfer verification: %v", err)
+	}
+
+	if agreement.Settlement != nil {
+		err = settlePayment(ctx, agreement.Settlement, agreement.Price)
+		if err != nil {
+			return fmt.Errorf("failed payment settlement: %v", err)
+		}
+	}
+
 	err = transferAssetState(ctx, asset, clientOrgID, buyerOrgID, agreement.Price)
 	if err != nil {
 		return fmt.Errorf("failed asset transfer: %v", err)
@@ -344,33 +368,16 @@ func verifyTransferConditions(ctx contractapi.TransactionContextInterface,
 
 	// CHECK2: Verify that buyer and seller on-chain asset defintion hash matches
 
-	collectionSeller := buildCollectionName(clientOrgID)
-	collectionBuyer := buildCollectionName(buyerOrgID)
-	sellerPropertiesOnChainHash, err := ctx.GetStub().GetPrivateDataHash(collectionSeller, asset.ID)
-	if err != nil {
-		return fmt.Errorf("failed to read asset private properties hash from seller's collection: %v", err)
-	}
-	if sellerPropertiesOnChainHash == nil {
-		return fmt.Errorf("asset private properties hash does not exist: %s", asset.ID)
-	}
-	buyerPropertiesOnChainHash, err := ctx.GetStub().GetPrivateDataHash(collectionBuyer, asset.ID)
+	err := verifyAssetPropertiesHashes(ctx, asset.ID, clientOrgID, buyerOrgID)
 	if err != nil {
-		return fmt.Errorf("failed to read asset private properties hash from seller's collection: %v", err)
-	}
-	if buyerPropertiesOnChainHash == nil {
-		return fmt.Errorf("asset private properties hash does not exist: %s", asset.ID)
-	}
-
-	// verify that buyer and seller on-chain asset defintion hash matches
-	if !bytes.Equal(sellerPropertiesOnChainHash, buyerPropertiesOnChainHash) {
-		return fmt.Errorf("on chain hash of seller %x does not match on-chain hash of buyer %x",
-			sellerPropertiesOnChainHash,
-			buyerPropertiesOnChainHash,
-		)
+		return err
 	}
 
 	// CHECK3: Verify that seller and buyer agreed on the same price
 
+	collectionSeller := buildCollectionName(clientOrgID)
+	collectionBuyer := buildCollectionName(buyerOrgID)
+
 	// Get sellers asking price
 	assetForSaleKey, err := ctx.GetStub().CreateCompositeKey(typeAssetForSale, []string{asset.ID})
 	if err != nil {
@@ -422,37 +429,64 @@ func verifyTransferConditions(ctx contractapi.TransactionContextInterface,
 	return nil
 }
 
+// verifyAssetPropertiesHashes checks that the on-chain hashes of the asset private properties in the
+// seller and buyer collections exist and match
+func verifyAssetPropertiesHashes(ctx contractapi.TransactionContextInterface, assetID string, sellerOrgID string, buyerOrgID string) error {
+	collectionSeller := buildCollectionName(sellerOrgID)
+	collectionBuyer := buildCollectionName(buyerOrgID)
+	sellerPropertiesOnChainHash, err := ctx.GetStub().GetPrivateDataHash(collectionSeller, assetID)
+	if err != nil {
+		return fmt.Errorf("failed to read asset private properties hash from seller's collection: %v", err)
+	}
+	if sellerPropertiesOnChainHash == nil {
+		return fmt.Errorf("asset private properties hash does not exist: %s", assetID)
+	}
+	buyerPropertiesOnChainHash, err := ctx.GetStub().GetPrivateDataHash(collectionBuyer, assetID)
+	if err != nil {
+		return fmt.Errorf("failed to read asset private properties hash from buyer's collection: %v", err)
+	}
+	if buyerPropertiesOnChainHash == nil {
+		return fmt.Errorf("asset private properties hash does not exist: %s", assetID)
+	}
+
+	// verify that buyer and seller on-chain asset defintion hash matches
+	if !bytes.Equal(sellerPropertiesOnChainHash, buyerPropertiesOnChainHash) {
+		return fmt.Errorf("on chain hash of seller %x does not match on-chain hash of buyer %x",
+			sellerPropertiesOnChainHash,
+			buyerPropertiesOnChainHash,
+		)
+	}
+
+	return nil
+}
+
 // transferAssetState performs the public and private state updates for the transferred asset
 // changes the endorsement for the transferred asset sbe to the new owner org
 func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asset, clientOrgID string, buyerOrgID string, price int) error {
 
-	// Update ownership in public state
-	asset.OwnerOrg = buyerOrgID
-	updatedAsset, err := json.Marshal(asset)
+	err := transferAssetOwnership(ctx, asset, clientOrgID, buyerOrgID)
 	if err != nil {
 		return err
 	}
-	err = ctx.GetStub().PutState(asset.ID, updatedAsset)
-	if err != nil {
-		return fmt.Errorf("failed to write asset for buyer: %v", err)
-	}
 
-	// Changes the endorsement policy to the new owner org
-	endorsingOrgs := []string{buyerOrgID}
-	err = setAssetStateBasedEndorsement(ctx, asset.ID, endorsingOrgs)
+	err = deleteAssetPrices(ctx, asset.ID, clientOrgID, buyerOrgID)
 	if err != nil {
-		return fmt.Errorf("failed setting state based endorsement for new owner: %v", err)
+		return err
 	}
 
-	// Delete asset description from seller collection
-	collectionSeller := buildCollectionName(clientOrgID)
-	err = ctx.GetStub().DelPrivateData(collectionSeller, asset.ID)
-	if err != nil {
-		return fmt.Errorf("failed to delete Asset private details from seller: %v", err)
-	}
+	return putAssetReceipts(ctx, &Receipt{
+		AssetID:   asset.ID,
+		Price:     price,
+		SellerOrg: clientOrgID,
+		BuyerOrg:  buyerOrgID,
+	})
+}
 
+// deleteAssetPrices deletes the price agreed by the seller and the price agreed by the buyer of an asset
+func deleteAssetPrices(ctx contractapi.TransactionContextInterface, assetID string, sellerOrgID string, buyerOrgID string) error {
 	// Delete the price records for seller
-	assetPriceKey, err := ctx.GetStub().CreateCompositeKey(typeAssetForSale, []string{asset.ID})
+	collectionSeller := buildCollectionName(sellerOrgID)
+	assetPriceKey, err := ctx.GetStub().CreateCompositeKey(typeAssetForSale, []string{assetID})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key for seller: %v", err)
 	}
@@ -463,7 +497,7 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 
 	// Delete the price records for buyer
 	collectionBuyer := buildCollectionName(buyerOrgID)
-	assetPriceKey, err = ctx.GetStub().CreateCompositeKey(typeAssetBid, []string{asset.ID})
+	assetPriceKey, err = ctx.GetStub().CreateCompositeKey(typeAssetBid, []string{assetID})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key for buyer: %v", err)
 	}
@@ -472,9 +506,15 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return fmt.Errorf("failed to delete asset price from implicit private data collection for buyer: %v", err)
 	}
 
+	return nil
+}
+
+// putAssetReceipts stores a receipt for the transfer of an asset in the implicit private data
+// collections of the seller and buyer orgs, with the transaction ID and timestamp of the transfer
+func putAssetReceipts(ctx contractapi.TransactionContextInterface, assetReceipt *Receipt) error {
 	// Keep record for a 'receipt' in both buyers and sellers private data collection to record the sale price and date.
 	// Persist the agreed to price in a collection sub-namespace based on receipt key prefix.
-	receiptBuyKey, err := ctx.GetStub().CreateCompositeKey(typeAssetBuyReceipt, []string{asset.ID, ctx.GetStub().GetTxID()})
+	receiptBuyKey, err := ctx.GetStub().CreateCompositeKey(typeAssetBuyReceipt, []string{assetReceipt.AssetID, ctx.GetStub().GetTxID()})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key for receipt: %v", err)
 	}
@@ -484,26 +524,24 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 		return fmt.Errorf("failed to create timestamp for receipt: %v", err)
 	}
 
-	assetReceipt := receipt{
-		price:     price,
-		timestamp: txTimestamp.AsTime(),
-	}
+	assetReceipt.TxID = ctx.GetStub().GetTxID()
+	assetReceipt.Timestamp = txTimestamp.AsTime().UTC()
 	receipt, err := json.Marshal(assetReceipt)
 	if err != nil {
 		return fmt.Errorf("failed to marshal receipt: %v", err)
 	}
 
-	err = ctx.GetStub().PutPrivateData(collectionBuyer, receiptBuyKey, receipt)
+	err = ctx.GetStub().PutPrivateData(buildCollectionName(assetReceipt.BuyerOrg), receiptBuyKey, receipt)
 	if err != nil {
 		return fmt.Errorf("failed to put private asset receipt for buyer: %v", err)
 	}
 
-	receiptSaleKey, err := ctx.GetStub().CreateCompositeKey(typeAssetSaleReceipt, []string{ctx.GetStub().GetTxID(), asset.ID})
+	receiptSaleKey, err := ctx.GetStub().CreateCompositeKey(typeAssetSaleReceipt, []string{ctx.GetStub().GetTxID(), assetReceipt.AssetID})
 	if err != nil {
 		return fmt.Errorf("failed to create composite key for receipt: %v", err)
 	}
 
-	err = ctx.GetStub().PutPrivateData(collectionSeller, receiptSaleKey, receipt)
+	err = ctx.GetStub().PutPrivateData(buildCollectionName(assetReceipt.SellerOrg), receiptSaleKey, receipt)
 	if err != nil {
 		return fmt.Errorf("failed to put private asset receipt for seller: %v", err)
 	}
@@ -511,6 +549,38 @@ func transferAssetState(ctx contractapi.TransactionContextInterface, asset *Asse
 	return nil
 }
 
+// transferAssetOwnership updates the owner of an asset in public state, changes the endorsement for
+// the asset sbe to the new owner org and deletes the asset description from the seller collection
+func transferAssetOwnership(ctx contractapi.TransactionContextInterface, asset *Asset, sellerOrgID string, buyerOrgID string) error {
+
+	// Update ownership in public state
+	asset.OwnerOrg = buyerOrgID
+	updatedAsset, err := json.Marshal(asset)
+	if err != nil {
+		return err
+	}
+	err = ctx.GetStub().PutState(asset.ID, updatedAsset)
+	if err != nil {
+		return fmt.Errorf("failed to write asset for buyer: %v", err)
+	}
+
+	// Changes the endorsement policy to the new owner org
+	endorsingOrgs := []string{buyerOrgID}
+	err = setAssetStateBasedEndorsement(ctx, asset.ID, endorsingOrgs)
+	if err != nil {
+		return fmt.Errorf("failed setting state based endorsement for new owner: %v", err)
+	}
+
+	// Delete asset description from seller collection
+	collectionSeller := buildCollectionName(sellerOrgID)
+	err = ctx.GetStub().DelPrivateData(collectionSeller, asset.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete Asset private details from seller: %v", err)
+	}
+
+	return nil
+}
+
 // getClientOrgID gets the client org ID.
 func getClientOrgID(ctx contractapi.TransactionContextInterface) (string, error) {
 	clientOrgID, err := ctx.GetClientIdentity().GetMSPID()
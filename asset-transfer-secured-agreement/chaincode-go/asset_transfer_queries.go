@@ -19,10 +19,13 @@ type QueryResult struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// Agreement is the price agreed to by the seller and buyer of an asset. If it includes a settlement,
+// the price is paid when the asset is transferred.
 type Agreement struct {
-	ID      string `json:"asset_id"`
-	Price   int    `json:"price"`
-	TradeID string `json:"trade_id"`
+	ID         string      `json:"asset_id"`
+	Price      int         `json:"price"`
+	TradeID    string      `json:"trade_id"`
+	Settlement *Settlement `json:"settlement,omitempty" metadata:",optional"`
 }
 
 // ReadAsset returns the public asset data
@@ -40,7 +40,7 @@ createNetwork
 print "Initializing Go gateway application"
 pushd ../asset-transfer-events/application-gateway-go
 print "Executing application"
-go run .
+go run . -listen=false
 popd
 stopNetwork
 
@@ -23,6 +23,14 @@ function stopNetwork() {
   ./network.sh down
 }
 
+# Check that the packaged CouchDB indexes match the chaincode
+if [[ "${CHAINCODE_LANGUAGE}" == "go" ]]; then
+  print "Checking CouchDB indexes"
+  pushd "${CHAINCODE_PATH}/chaincode-go"
+  go run ./cmd/indexgen -check
+  popd
+fi
+
 # Run Java application
 createNetwork
 print "Initializing Java application"
@@ -150,7 +150,8 @@ func (s *SmartContract) Mint(ctx contractapi.TransactionContextInterface, accoun
 }
 
 // MintBatch creates amount tokens for each token type id and assigns them to account.
-// This function emits a TransferBatch event.
+// This function emits a CompoundEvent containing a TransferBatch event followed by a TransferSingle
+// event for each token type id.
 func (s *SmartContract) MintBatch(ctx contractapi.TransactionContextInterface, account string, ids []uint64, amounts []uint64) error {
 
 	// Check if contract has been intilized first
@@ -200,7 +201,7 @@ func (s *SmartContract) MintBatch(ctx contractapi.TransactionContextInterface, a
 		}
 	}
 
-	// Emit TransferBatch event
+	// Emit TransferBatch and TransferSingle events in a single compound event
 	transferBatchEvent := TransferBatch{operator, "0x0", account, ids, amounts}
 	return emitTransferBatch(ctx, transferBatchEvent)
 }
@@ -245,7 +246,8 @@ func (s *SmartContract) Burn(ctx contractapi.TransactionContextInterface, accoun
 }
 
 // BurnBatch destroys amount tokens of for each token type id from account.
-// This function emits a TransferBatch event.
+// This function emits a CompoundEvent containing a TransferBatch event followed by a TransferSingle
+// event for each token type id.
 func (s *SmartContract) BurnBatch(ctx contractapi.TransactionContextInterface, account string, ids []uint64, amounts []uint64) error {
 
 	// Check if contract has been intilized first
@@ -344,7 +346,8 @@ func (s *SmartContract) TransferFrom(ctx contractapi.TransactionContextInterface
 
 // BatchTransferFrom transfers multiple tokens from sender account to recipient account
 // recipient account must be a valid clientID as returned by the ClientID() function
-// This function triggers a TransferBatch event
+// This function triggers a CompoundEvent containing a TransferBatch event followed by a TransferSingle
+// event for each token type id
 func (s *SmartContract) BatchTransferFrom(ctx contractapi.TransactionContextInterface, sender string, recipient string, ids []uint64, amounts []uint64) error {
 
 	// Check if contract has been intilized first
@@ -419,7 +422,8 @@ func (s *SmartContract) BatchTransferFrom(ctx contractapi.TransactionContextInte
 
 // BatchTransferFromMultiRecipient transfers multiple tokens from sender account to multiple recipient accounts
 // recipient account must be a valid clientID as returned by the ClientID() function
-// This function triggers a TransferBatchMultiRecipient event
+// This function triggers a CompoundEvent containing a TransferBatchMultiRecipient event followed by a
+// TransferSingle event for each recipient and token type id
 func (s *SmartContract) BatchTransferFromMultiRecipient(ctx contractapi.TransactionContextInterface, sender string, recipients []string, ids []uint64, amounts []uint64) error {
 
 	// Check if contract has been intilized first
@@ -491,7 +495,7 @@ func (s *SmartContract) BatchTransferFromMultiRecipient(ctx contractapi.Transact
 		}
 	}
 
-	// Emit TransferBatchMultiRecipient event
+	// Emit TransferBatchMultiRecipient and TransferSingle events in a single compound event
 	transferBatchMultiRecipientEvent := TransferBatchMultiRecipient{operator, sender, recipients, ids, amounts}
 	return emitTransferBatchMultiRecipient(ctx, transferBatchMultiRecipientEvent)
 }
@@ -1019,33 +1023,7 @@ func emitTransferSingle(ctx contractapi.TransactionContextInterface, transferSin
 		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
 	}
 
-	err = ctx.GetStub().SetEvent("TransferSingle", transferSingleEventJSON)
-	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
-	}
-
-	return nil
-}
-
-func emitTransferBatch(ctx contractapi.TransactionContextInterface, transferBatchEvent TransferBatch) error {
-	transferBatchEventJSON, err := json.Marshal(transferBatchEvent)
-	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-	}
-	err = ctx.GetStub().SetEvent("TransferBatch", transferBatchEventJSON)
-	if err != nil {
-		return fmt.Errorf("failed to set event: %v", err)
-	}
-
-	return nil
-}
-
-func emitTransferBatchMultiRecipient(ctx contractapi.TransactionContextInterface, transferBatchMultiRecipientEvent TransferBatchMultiRecipient) error {
-	transferBatchMultiRecipientEventJSON, err := json.Marshal(transferBatchMultiRecipientEvent)
-	if err != nil {
-		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
-	}
-	err = ctx.GetStub().SetEvent("TransferBatchMultiRecipient", transferBatchMultiRecipientEventJSON)
+	err = ctx.GetStub().SetEvent(transferSingleEventName, transferSingleEventJSON)
 	if err != nil {
 		return fmt.Errorf("failed to set event: %v", err)
 	}
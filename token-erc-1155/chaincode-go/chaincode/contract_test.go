@@ -0,0 +1,226 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/stretchr/testify/require"
+)
+
+const minter = "minter"
+
+// MockStub keeps the world state in a map, and records the chaincode event of the transaction
+type MockStub struct {
+	shim.ChaincodeStubInterface
+	state      map[string][]byte
+	eventName  string
+	eventBytes []byte
+}
+
+func (ms *MockStub) GetState(key string) ([]byte, error) {
+	return ms.state[key], nil
+}
+
+func (ms *MockStub) PutState(key string, value []byte) error {
+	ms.state[key] = value
+	return nil
+}
+
+func (ms *MockStub) DelState(key string) error {
+	delete(ms.state, key)
+	return nil
+}
+
+func (ms *MockStub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return shim.CreateCompositeKey(objectType, attributes)
+}
+
+func (ms *MockStub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	return (&shim.ChaincodeStub{}).SplitCompositeKey(compositeKey)
+}
+
+func (ms *MockStub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	prefix, err := shim.CreateCompositeKey(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	iterator := &MockIterator{}
+	for key, value := range ms.state {
+		if strings.HasPrefix(key, prefix) {
+			iterator.results = append(iterator.results, &queryresult.KV{Key: key, Value: value})
+		}
+	}
+	sort.Slice(iterator.results, func(i, j int) bool {
+		return iterator.results[i].Key < iterator.results[j].Key
+	})
+	return iterator, nil
+}
+
+func (ms *MockStub) SetEvent(name string, payload []byte) error {
+	ms.eventName = name
+	ms.eventBytes = payload
+	return nil
+}
+
+type MockIterator struct {
+	shim.StateQueryIteratorInterface
+	results []*queryresult.KV
+}
+
+func (it *MockIterator) HasNext() bool {
+	return len(it.results) > 0
+}
+
+func (it *MockIterator) Next() (*queryresult.KV, error) {
+	result := it.results[0]
+	it.results = it.results[1:]
+	return result, nil
+}
+
+func (it *MockIterator) Close() error {
+	return nil
+}
+
+type MockClientIdentity struct {
+	cid.ClientIdentity
+	id    string
+	mspID string
+}
+
+func (mci *MockClientIdentity) GetID() (string, error) {
+	return mci.id, nil
+}
+
+func (mci *MockClientIdentity) GetMSPID() (string, error) {
+	return mci.mspID, nil
+}
+
+type MockContext struct {
+	contractapi.TransactionContextInterface
+	stub           *MockStub
+	clientIdentity *MockClientIdentity
+}
+
+func (mc *MockContext) GetStub() shim.ChaincodeStubInterface {
+	return mc.stub
+}
+
+func (mc *MockContext) GetClientIdentity() cid.ClientIdentity {
+	return mc.clientIdentity
+}
+
+// setupContext returns a context for the minter of an initialized contract
+func setupContext(t *testing.T) *MockContext {
+	ctx := &MockContext{
+		stub:           &MockStub{state: map[string][]byte{}},
+		clientIdentity: &MockClientIdentity{id: minter, mspID: minterMSPID},
+	}
+	_, err := (&SmartContract{}).Initialize(ctx, "token", "TKN")
+	require.NoError(t, err)
+	return ctx
+}
+
+// compoundEventJSON returns the expected payload of a compound event with the given events
+func compoundEventJSON(t *testing.T, events ...interface{}) string {
+	var entries []map[string]interface{}
+	for _, event := range events {
+		var name string
+		switch event.(type) {
+		case TransferSingle:
+			name = "TransferSingle"
+		case TransferBatch:
+			name = "TransferBatch"
+		case TransferBatchMultiRecipient:
+			name = "TransferBatchMultiRecipient"
+		}
+		entries = append(entries, map[string]interface{}{"name": name, "payload": event})
+	}
+
+	eventJSON, err := json.Marshal(map[string]interface{}{"events": entries})
+	require.NoError(t, err)
+	return string(eventJSON)
+}
+
+func TestMintBatchEmitsCompoundEvent(t *testing.T) {
+	ctx := setupContext(t)
+
+	err := (&SmartContract{}).MintBatch(ctx, "alice", []uint64{1, 2, 1}, []uint64{10, 20, 5})
+	require.NoError(t, err)
+
+	require.Equal(t, "CompoundEvent", ctx.stub.eventName)
+	require.JSONEq(t, compoundEventJSON(t,
+		TransferBatch{minter, "0x0", "alice", []uint64{1, 2, 1}, []uint64{10, 20, 5}},
+		TransferSingle{minter, "0x0", "alice", 1, 10},
+		TransferSingle{minter, "0x0", "alice", 2, 20},
+		TransferSingle{minter, "0x0", "alice", 1, 5},
+	), string(ctx.stub.eventBytes))
+}
+
+func TestBurnBatchEmitsCompoundEvent(t *testing.T) {
+	ctx := setupContext(t)
+	err := (&SmartContract{}).MintBatch(ctx, minter, []uint64{1, 2}, []uint64{10, 20})
+	require.NoError(t, err)
+
+	err = (&SmartContract{}).BurnBatch(ctx, minter, []uint64{1, 2}, []uint64{3, 4})
+	require.NoError(t, err)
+
+	require.Equal(t, "CompoundEvent", ctx.stub.eventName)
+	require.JSONEq(t, compoundEventJSON(t,
+		TransferBatch{minter, minter, "0x0", []uint64{1, 2}, []uint64{3, 4}},
+		TransferSingle{minter, minter, "0x0", 1, 3},
+		TransferSingle{minter, minter, "0x0", 2, 4},
+	), string(ctx.stub.eventBytes))
+}
+
+func TestBatchTransferFromEmitsCompoundEvent(t *testing.T) {
+	ctx := setupContext(t)
+	err := (&SmartContract{}).MintBatch(ctx, minter, []uint64{1, 2}, []uint64{10, 20})
+	require.NoError(t, err)
+
+	err = (&SmartContract{}).BatchTransferFrom(ctx, minter, "bob", []uint64{2, 1}, []uint64{5, 6})
+	require.NoError(t, err)
+
+	require.Equal(t, "CompoundEvent", ctx.stub.eventName)
+	require.JSONEq(t, compoundEventJSON(t,
+		TransferBatch{minter, minter, "bob", []uint64{2, 1}, []uint64{5, 6}},
+		TransferSingle{minter, minter, "bob", 2, 5},
+		TransferSingle{minter, minter, "bob", 1, 6},
+	), string(ctx.stub.eventBytes))
+
+	balance, err := (&SmartContract{}).BalanceOf(ctx, "bob", 1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), balance)
+}
+
+func TestBatchTransferFromMultiRecipientEmitsCompoundEvent(t *testing.T) {
+	ctx := setupContext(t)
+	err := (&SmartContract{}).MintBatch(ctx, minter, []uint64{1, 2}, []uint64{10, 20})
+	require.NoError(t, err)
+
+	recipients := []string{"bob", "carol", "bob"}
+	err = (&SmartContract{}).BatchTransferFromMultiRecipient(ctx, minter, recipients, []uint64{1, 1, 2}, []uint64{1, 2, 3})
+	require.NoError(t, err)
+
+	require.Equal(t, "CompoundEvent", ctx.stub.eventName)
+	require.JSONEq(t, compoundEventJSON(t,
+		TransferBatchMultiRecipient{minter, minter, recipients, []uint64{1, 1, 2}, []uint64{1, 2, 3}},
+		TransferSingle{minter, minter, "bob", 1, 1},
+		TransferSingle{minter, minter, "carol", 1, 2},
+		TransferSingle{minter, minter, "bob", 2, 3},
+	), string(ctx.stub.eventBytes))
+}
+
+func TestFailedBatchTransferEmitsNoEvent(t *testing.T) {
+	ctx := setupContext(t)
+
+	err := (&SmartContract{}).BatchTransferFrom(ctx, minter, "bob", []uint64{1}, []uint64{5})
+	require.EqualError(t, err, "sender has insufficient funds for token 1, needed funds: 5, available fund: 0")
+	require.Empty(t, ctx.stub.eventName)
+}
@@ -0,0 +1,110 @@
+/*
+	SPDX-License-Identifier: Apache-2.0
+*/
+
+package chaincode
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// Define names for chaincode events
+const transferSingleEventName = "TransferSingle"
+const transferBatchEventName = "TransferBatch"
+const transferBatchMultiRecipientEventName = "TransferBatchMultiRecipient"
+const compoundEventName = "CompoundEvent"
+
+// compoundEventEntry is a single logical event within a compound event
+type compoundEventEntry struct {
+	Name    string          `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// eventBatch collects the logical events of a batch function. Fabric keeps only one chaincode
+// event per transaction, so the events are emitted together as a single CompoundEvent,
+// {"events":[{"name":...,"payload":...}]}, once all balances have been updated.
+type eventBatch struct {
+	events []compoundEventEntry
+}
+
+// add appends an event with the JSON encoding of payload to the batch
+func (batch *eventBatch) add(name string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding of %s event: %v", name, err)
+	}
+
+	batch.events = append(batch.events, compoundEventEntry{Name: name, Payload: payloadJSON})
+	return nil
+}
+
+// addTransfers appends a TransferSingle event for each token transferred by a batch, in the order
+// of the ids and values of the batch
+func (batch *eventBatch) addTransfers(operator string, from string, to []string, ids []uint64, values []uint64) error {
+	for i := range ids {
+		err := batch.add(transferSingleEventName, TransferSingle{operator, from, to[i], ids[i], values[i]})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// emit sets the compound event of the transaction
+func (batch *eventBatch) emit(ctx contractapi.TransactionContextInterface) error {
+	eventJSON, err := json.Marshal(struct {
+		Events []compoundEventEntry `json:"events"`
+	}{batch.events})
+	if err != nil {
+		return fmt.Errorf("failed to obtain JSON encoding: %v", err)
+	}
+
+	err = ctx.GetStub().SetEvent(compoundEventName, eventJSON)
+	if err != nil {
+		return fmt.Errorf("failed to set event: %v", err)
+	}
+
+	return nil
+}
+
+// emitTransferBatch emits a TransferBatch event followed by a TransferSingle event for each
+// transferred token, in a single compound event
+func emitTransferBatch(ctx contractapi.TransactionContextInterface, transferBatchEvent TransferBatch) error {
+	var events eventBatch
+	err := events.add(transferBatchEventName, transferBatchEvent)
+	if err != nil {
+		return err
+	}
+
+	recipients := make([]string, len(transferBatchEvent.IDs))
+	for i := range recipients {
+		recipients[i] = transferBatchEvent.To
+	}
+	err = events.addTransfers(transferBatchEvent.Operator, transferBatchEvent.From, recipients, transferBatchEvent.IDs, transferBatchEvent.Values)
+	if err != nil {
+		return err
+	}
+
+	return events.emit(ctx)
+}
+
+// emitTransferBatchMultiRecipient emits a TransferBatchMultiRecipient event followed by a
+// TransferSingle event for each transferred token, in a single compound event
+func emitTransferBatchMultiRecipient(ctx contractapi.TransactionContextInterface, transferBatchMultiRecipientEvent TransferBatchMultiRecipient) error {
+	var events eventBatch
+	err := events.add(transferBatchMultiRecipientEventName, transferBatchMultiRecipientEvent)
+	if err != nil {
+		return err
+	}
+
+	err = events.addTransfers(transferBatchMultiRecipientEvent.Operator, transferBatchMultiRecipientEvent.From, transferBatchMultiRecipientEvent.To, transferBatchMultiRecipientEvent.IDs, transferBatchMultiRecipientEvent.Values)
+	if err != nil {
+		return err
+	}
+
+	return events.emit(ctx)
+}